@@ -6,8 +6,16 @@ require (
 	github.com/allegro/bigcache v1.2.1
 	github.com/glycerine/goconvey v0.0.0-20190410193231-58a59202ab31
 	github.com/go-redis/redis v6.15.9+incompatible
+	github.com/golang/snappy v0.0.4
 	github.com/gopherjs/gopherjs v0.0.0-20210825203111-a709d8e111b3 // indirect
 	github.com/json-iterator/go v1.1.10
+	github.com/klauspost/compress v1.13.6
 	github.com/onsi/gomega v1.16.0 // indirect
 	github.com/patrickmn/go-cache v2.1.0+incompatible
+	github.com/prometheus/client_golang v1.11.0
+	github.com/vmihailenko/msgpack/v5 v5.3.4
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	go.uber.org/zap v1.19.1
+	google.golang.org/protobuf v1.27.1
 )
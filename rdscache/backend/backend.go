@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// IBackend 缓存存储后端抽象, fcache及mcache均通过该接口读写缓存
+// 组件内置了redis单机/哨兵/集群/ring的实现, 业务方也可自行实现该接口接入其它存储
+// 实现方需遵循ctx的超时及取消, ctx结束后需尽快返回ctx.Err()
+type IBackend interface {
+	// Get 获取string缓存, 数据不存在时需返回ErrCacheNotExist
+	Get(ctx context.Context, key string) (string, error)
+	// Set 设置string缓存, expTime <= 0代表不过期
+	Set(ctx context.Context, key, value string, expTime time.Duration) error
+	// HGet 获取hash中field对应的缓存, 数据不存在时需返回ErrCacheNotExist
+	HGet(ctx context.Context, key, field string) (string, error)
+	// HSet 设置hash中field对应的缓存
+	HSet(ctx context.Context, key, field, value string) error
+	// MGet 批量获取string缓存, 返回结果和keys一一对应, 不存在的数据对应位置为nil, 存在的数据为string
+	MGet(ctx context.Context, keys ...string) ([]interface{}, error)
+	// HMGet 批量获取hash中的缓存, 返回结果和fields一一对应, 不存在的数据对应位置为nil, 存在的数据为string
+	HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error)
+	// Expire 设置key的过期时间
+	Expire(ctx context.Context, key string, expTime time.Duration) error
+	// Del 删除key
+	Del(ctx context.Context, keys ...string) error
+	// HDel 删除hash中的field, key或field不存在时不返回错误
+	HDel(ctx context.Context, key string, fields ...string) error
+	// Incr 将key的值加1并返回加1后的值, key不存在时视为0
+	Incr(ctx context.Context, key string) (int64, error)
+	// SAddWithExpire 向集合中添加成员, 集合的过期时间只延长不缩短, expTime <= 0代表集合不过期, 需保证原子性
+	SAddWithExpire(ctx context.Context, key string, expTime time.Duration, members ...string) error
+	// SMembers 获取集合中的全部成员, key不存在时返回空
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// SScan 从cursor开始分批遍历集合的成员, 返回本批成员及下一次遍历的cursor, cursor为0代表遍历结束
+	// count只是每批成员数的参考值; 遍历期间一直存在的成员至少返回一次, 可能重复返回
+	SScan(ctx context.Context, key string, cursor uint64, count int64) ([]string, uint64, error)
+	// SRem 删除集合中的成员, 成员全部删除后key被删除
+	SRem(ctx context.Context, key string, members ...string) error
+	// Pipeline 开启一个管道, 管道中的命令在Exec时一次性发送
+	Pipeline(ctx context.Context) IPipeline
+
+	// SetNX key不存在时设置string缓存, 返回是否设置成功, 用于实现分布式锁
+	SetNX(ctx context.Context, key, value string, expTime time.Duration) (bool, error)
+	// CompareAndDel key的值等于value时删除key, 返回是否删除, 需保证比较及删除的原子性
+	CompareAndDel(ctx context.Context, key, value string) (bool, error)
+	// CompareAndExpire key的值等于value时更新过期时间, 返回是否更新, 需保证比较及更新的原子性
+	CompareAndExpire(ctx context.Context, key, value string, expTime time.Duration) (bool, error)
+
+	// LeaseSet 租约leaseKey的值等于token时设置string缓存并删除租约, 返回是否设置, 需保证比较、设置及删除的原子性
+	// 租约已被撤销或过期时不设置, 用于防止数据变更后回源的请求写入旧数据; 集群模式下leaseKey需和key在同一个slot
+	LeaseSet(ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (bool, error)
+	// LeaseHSet 同LeaseSet, 设置hash中field对应的缓存, expTime > 0时同时设置key的过期时间
+	LeaseHSet(ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (bool, error)
+}
+
+// IPipeline 存储后端的管道抽象, 用于批量写入时减少网络往返
+type IPipeline interface {
+	Set(key, value string, expTime time.Duration)
+	HSet(key, field, value string)
+	HMSet(key string, fields map[string]interface{})
+	Expire(key string, expTime time.Duration)
+	Del(keys ...string)
+	HDel(key string, fields ...string)
+	SAddWithExpire(key string, expTime time.Duration, members ...string)
+	// Exec 执行管道中的全部命令, 任一命令执行失败则返回错误
+	Exec() error
+	// Close 释放管道, 未执行的命令将被丢弃
+	Close() error
+}
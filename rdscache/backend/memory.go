@@ -0,0 +1,577 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+)
+
+var (
+	errWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+)
+
+// memSweepInterval 过期数据的清理间隔, 过期数据在访问时惰性删除, 写入时按该间隔批量清理
+const memSweepInterval = time.Minute
+
+type memEntry struct {
+	str      string
+	hash     map[string]string   // hash != nil代表该key为hash类型
+	set      map[string]struct{} // set != nil代表该key为集合类型
+	expireAt time.Time           // 零值代表不过期
+}
+
+func (e *memEntry) isString() bool {
+	return e.hash == nil && e.set == nil
+}
+
+func (e *memEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// MemoryBackend 进程内存储后端, 语义和redis保持一致(包括过期时间)，无需redis即可运行fcache及mcache
+// 主要用于单元测试或单机场景
+type MemoryBackend struct {
+	mu        sync.Mutex
+	data      map[string]*memEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{data: map[string]*memEntry{}, now: time.Now, lastSweep: time.Now()}
+}
+
+func (b *MemoryBackend) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.getEntry(key)
+	if e == nil {
+		return "", rdscache.ErrCacheNotExist
+	}
+	if !e.isString() {
+		return "", errWrongType
+	}
+	return e.str, nil
+}
+
+func (b *MemoryBackend) Set(ctx context.Context, key, value string, expTime time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.set(key, value, expTime)
+	return nil
+}
+
+func (b *MemoryBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.getEntry(key)
+	if e == nil {
+		return "", rdscache.ErrCacheNotExist
+	}
+	if e.hash == nil {
+		return "", errWrongType
+	}
+	v, ok := e.hash[field]
+	if !ok {
+		return "", rdscache.ErrCacheNotExist
+	}
+	return v, nil
+}
+
+func (b *MemoryBackend) HSet(ctx context.Context, key, field, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.hMSet(key, map[string]interface{}{field: value})
+}
+
+func (b *MemoryBackend) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// 和redis一致, 非string类型的key返回nil
+	ret := make([]interface{}, len(keys))
+	for idx, key := range keys {
+		if e := b.getEntry(key); e != nil && e.isString() {
+			ret[idx] = e.str
+		}
+	}
+	return ret, nil
+}
+
+func (b *MemoryBackend) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ret := make([]interface{}, len(fields))
+	e := b.getEntry(key)
+	if e == nil {
+		return ret, nil
+	}
+	if e.hash == nil {
+		return nil, errWrongType
+	}
+	for idx, field := range fields {
+		if v, ok := e.hash[field]; ok {
+			ret[idx] = v
+		}
+	}
+	return ret, nil
+}
+
+func (b *MemoryBackend) Expire(ctx context.Context, key string, expTime time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(key, expTime)
+	return nil
+}
+
+func (b *MemoryBackend) Del(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, key := range keys {
+		delete(b.data, key)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) HDel(ctx context.Context, key string, fields ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.hDel(key, fields...)
+}
+
+func (b *MemoryBackend) Incr(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var n int64
+	e := b.getEntry(key)
+	if e != nil {
+		if !e.isString() {
+			return 0, errWrongType
+		}
+		var err error
+		if n, err = strconv.ParseInt(e.str, 10, 64); err != nil {
+			return 0, errNotInteger
+		}
+	}
+	n++
+	if e == nil {
+		b.set(key, strconv.FormatInt(n, 10), 0)
+	} else {
+		// 和redis一致, 保留原有的过期时间
+		e.str = strconv.FormatInt(n, 10)
+	}
+	return n, nil
+}
+
+func (b *MemoryBackend) SAddWithExpire(
+	ctx context.Context, key string, expTime time.Duration, members ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sAddWithExpire(key, expTime, members...)
+}
+
+func (b *MemoryBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.getEntry(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.set == nil {
+		return nil, errWrongType
+	}
+	ret := make([]string, 0, len(e.set))
+	for m := range e.set {
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// SScan count只是参考值, 一次返回全部成员, 遍历期间删除成员不会导致遗漏
+func (b *MemoryBackend) SScan(
+	ctx context.Context, key string, cursor uint64, count int64) ([]string, uint64, error) {
+	members, err := b.SMembers(ctx, key)
+	return members, 0, err
+}
+
+func (b *MemoryBackend) SRem(ctx context.Context, key string, members ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.getEntry(key)
+	if e == nil {
+		return nil
+	}
+	if e.set == nil {
+		return errWrongType
+	}
+	for _, m := range members {
+		delete(e.set, m)
+	}
+	if len(e.set) == 0 {
+		delete(b.data, key)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) SetNX(ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.getEntry(key) != nil {
+		return false, nil
+	}
+	b.set(key, value, expTime)
+	return true, nil
+}
+
+func (b *MemoryBackend) CompareAndDel(ctx context.Context, key, value string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e := b.getEntry(key); e == nil || !e.isString() || e.str != value {
+		return false, nil
+	}
+	delete(b.data, key)
+	return true, nil
+}
+
+func (b *MemoryBackend) CompareAndExpire(
+	ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e := b.getEntry(key); e == nil || !e.isString() || e.str != value {
+		return false, nil
+	}
+	b.expire(key, expTime)
+	return true, nil
+}
+
+func (b *MemoryBackend) LeaseSet(
+	ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.holdLease(leaseKey, token) {
+		return false, nil
+	}
+	b.set(key, value, expTime)
+	delete(b.data, leaseKey)
+	return true, nil
+}
+
+func (b *MemoryBackend) LeaseHSet(
+	ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.holdLease(leaseKey, token) {
+		return false, nil
+	}
+	if err := b.hMSet(key, map[string]interface{}{field: value}); err != nil {
+		return false, err
+	}
+	if expTime > 0 {
+		b.expire(key, expTime)
+	}
+	delete(b.data, leaseKey)
+	return true, nil
+}
+
+func (b *MemoryBackend) Pipeline(ctx context.Context) IPipeline {
+	return &memPipeline{ctx: ctx, b: b}
+}
+
+// TTL 获取key的剩余过期时间, 和redis一致: key不存在返回-2s, 不过期返回-1s
+func (b *MemoryBackend) TTL(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.getEntry(key)
+	if e == nil {
+		return -2 * time.Second
+	}
+	if e.expireAt.IsZero() {
+		return -1 * time.Second
+	}
+	return e.expireAt.Sub(b.now())
+}
+
+// Flush 清空全部数据
+func (b *MemoryBackend) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = map[string]*memEntry{}
+}
+
+// getEntry 获取未过期的数据, 过期数据惰性删除, 调用方需持有锁
+func (b *MemoryBackend) getEntry(key string) *memEntry {
+	e, ok := b.data[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(b.now()) {
+		delete(b.data, key)
+		return nil
+	}
+	return e
+}
+
+func (b *MemoryBackend) set(key, value string, expTime time.Duration) {
+	b.sweep()
+	e := &memEntry{str: value}
+	if expTime > 0 {
+		e.expireAt = b.now().Add(expTime)
+	}
+	b.data[key] = e
+}
+
+// holdLease 租约leaseKey的值是否等于token, 调用方需持有锁
+func (b *MemoryBackend) holdLease(leaseKey, token string) bool {
+	e := b.getEntry(leaseKey)
+	return e != nil && e.isString() && e.str == token
+}
+
+// hMSet 写入hash中的多个field, 已存在的hash保留原有的过期时间
+func (b *MemoryBackend) hMSet(key string, fields map[string]interface{}) error {
+	b.sweep()
+	e := b.getEntry(key)
+	if e == nil {
+		e = &memEntry{hash: map[string]string{}}
+		b.data[key] = e
+	}
+	if e.hash == nil {
+		return errWrongType
+	}
+	for field, v := range fields {
+		switch v := v.(type) {
+		case string:
+			e.hash[field] = v
+		case []byte:
+			e.hash[field] = string(v)
+		default:
+			return errors.New("memory backend only support string value")
+		}
+	}
+	return nil
+}
+
+// sAddWithExpire 和redis脚本一致, 集合的过期时间只延长不缩短
+func (b *MemoryBackend) sAddWithExpire(key string, expTime time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	b.sweep()
+	e := b.getEntry(key)
+	isNew := e == nil
+	if isNew {
+		e = &memEntry{set: map[string]struct{}{}}
+		b.data[key] = e
+	}
+	if e.set == nil {
+		return errWrongType
+	}
+	for _, m := range members {
+		e.set[m] = struct{}{}
+	}
+
+	switch {
+	case expTime <= 0:
+		e.expireAt = time.Time{}
+	case isNew, !e.expireAt.IsZero() && e.expireAt.Before(b.now().Add(expTime)):
+		e.expireAt = b.now().Add(expTime)
+	}
+	return nil
+}
+
+// hDel 删除hash中的field, 和redis一致, field全部删除后删除key
+func (b *MemoryBackend) hDel(key string, fields ...string) error {
+	e := b.getEntry(key)
+	if e == nil {
+		return nil
+	}
+	if e.hash == nil {
+		return errWrongType
+	}
+	for _, field := range fields {
+		delete(e.hash, field)
+	}
+	if len(e.hash) == 0 {
+		delete(b.data, key)
+	}
+	return nil
+}
+
+// expire 和redis一致, 过期时间<=0时直接删除key
+func (b *MemoryBackend) expire(key string, expTime time.Duration) {
+	e := b.getEntry(key)
+	if e == nil {
+		return
+	}
+	if expTime <= 0 {
+		delete(b.data, key)
+		return
+	}
+	e.expireAt = b.now().Add(expTime)
+}
+
+// sweep 按间隔清理过期数据, 防止写入后不再访问的key一直占用内存
+func (b *MemoryBackend) sweep() {
+	now := b.now()
+	if now.Sub(b.lastSweep) < memSweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for key, e := range b.data {
+		if e.expired(now) {
+			delete(b.data, key)
+		}
+	}
+}
+
+// memPipeline 缓存管道中的命令, Exec时持有锁一次性执行
+type memPipeline struct {
+	ctx  context.Context
+	b    *MemoryBackend
+	cmds []func() error
+}
+
+func (p *memPipeline) Set(key, value string, expTime time.Duration) {
+	p.cmds = append(p.cmds, func() error {
+		p.b.set(key, value, expTime)
+		return nil
+	})
+}
+
+func (p *memPipeline) HSet(key, field, value string) {
+	p.HMSet(key, map[string]interface{}{field: value})
+}
+
+func (p *memPipeline) HMSet(key string, fields map[string]interface{}) {
+	p.cmds = append(p.cmds, func() error {
+		return p.b.hMSet(key, fields)
+	})
+}
+
+func (p *memPipeline) Expire(key string, expTime time.Duration) {
+	p.cmds = append(p.cmds, func() error {
+		p.b.expire(key, expTime)
+		return nil
+	})
+}
+
+func (p *memPipeline) Del(keys ...string) {
+	p.cmds = append(p.cmds, func() error {
+		for _, key := range keys {
+			delete(p.b.data, key)
+		}
+		return nil
+	})
+}
+
+func (p *memPipeline) HDel(key string, fields ...string) {
+	p.cmds = append(p.cmds, func() error {
+		return p.b.hDel(key, fields...)
+	})
+}
+
+func (p *memPipeline) SAddWithExpire(key string, expTime time.Duration, members ...string) {
+	p.cmds = append(p.cmds, func() error {
+		return p.b.sAddWithExpire(key, expTime, members...)
+	})
+}
+
+// Exec 和redis管道一致, 某条命令失败不影响其它命令执行, 返回第一个错误
+func (p *memPipeline) Exec() error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	p.b.mu.Lock()
+	defer p.b.mu.Unlock()
+
+	var firstErr error
+	for _, cmd := range p.cmds {
+		if err := cmd(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.cmds = nil
+	return firstErr
+}
+
+func (p *memPipeline) Close() error {
+	p.cmds = nil
+	return nil
+}
@@ -0,0 +1,254 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func Test_MemoryBackend(t *testing.T) {
+	Convey("进程内存储后端", t, func() {
+		mem := NewMemoryBackend()
+
+		Convey("string读写及过期", func() {
+			_, err := mem.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			So(mem.Set(ctx, rk, "v", time.Millisecond*100), ShouldBeNil)
+			v, err := mem.Get(ctx, rk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+			So(mem.TTL(rk), ShouldBeGreaterThan, 0)
+
+			time.Sleep(time.Millisecond * 150)
+			_, err = mem.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			So(mem.TTL(rk), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("不过期及过期时间<=0时删除key", func() {
+			So(mem.Set(ctx, rk, "v", 0), ShouldBeNil)
+			So(mem.TTL(rk), ShouldEqual, -1*time.Second)
+
+			So(mem.Expire(ctx, rk, 0), ShouldBeNil)
+			_, err := mem.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		})
+
+		Convey("hash读写", func() {
+			_, err := mem.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			So(mem.HSet(ctx, rk, sk, "v"), ShouldBeNil)
+			v, err := mem.HGet(ctx, rk, sk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+			_, err = mem.HGet(ctx, rk, "notExist")
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			// 类型不一致
+			_, err = mem.Get(ctx, rk)
+			So(err, ShouldNotBeNil)
+
+			// field全部删除后删除key
+			_ = mem.HSet(ctx, rk, "sk2", "v")
+			So(mem.HDel(ctx, rk, sk, "notExist"), ShouldBeNil)
+			_, err = mem.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			So(mem.HDel(ctx, rk, "sk2"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldEqual, -2*time.Second)
+			So(mem.HDel(ctx, rk, sk), ShouldBeNil)
+		})
+
+		Convey("批量获取", func() {
+			_ = mem.Set(ctx, rk, "v", 0)
+			ret, err := mem.MGet(ctx, rk, rk2)
+			So(err, ShouldBeNil)
+			So(ret[0], ShouldEqual, "v")
+			So(ret[1], ShouldBeNil)
+
+			_ = mem.HSet(ctx, rk2, sk, "v")
+			ret, err = mem.HMGet(ctx, rk2, sk, "notExist")
+			So(err, ShouldBeNil)
+			So(ret[0], ShouldEqual, "v")
+			So(ret[1], ShouldBeNil)
+		})
+
+		Convey("管道批量写入", func() {
+			p := mem.Pipeline(ctx)
+			p.Set(rk, "v", time.Second*10)
+			p.HMSet(rk2, map[string]interface{}{sk: "v"})
+			p.Expire(rk2, time.Second*10)
+
+			// 执行前数据不可见
+			_, err := mem.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			So(p.Exec(), ShouldBeNil)
+			So(p.Close(), ShouldBeNil)
+			v, _ := mem.Get(ctx, rk)
+			So(v, ShouldEqual, "v")
+			v, _ = mem.HGet(ctx, rk2, sk)
+			So(v, ShouldEqual, "v")
+			So(mem.TTL(rk2), ShouldBeGreaterThan, 9*time.Second)
+
+			p = mem.Pipeline(ctx)
+			p.HDel(rk2, sk)
+			p.Del(rk)
+			So(p.Exec(), ShouldBeNil)
+			So(mem.TTL(rk), ShouldEqual, -2*time.Second)
+			So(mem.TTL(rk2), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("分布式锁相关的原子操作", func() {
+			ok, err := mem.SetNX(ctx, rk, "token", time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			ok, _ = mem.SetNX(ctx, rk, "other", time.Second)
+			So(ok, ShouldBeFalse)
+
+			// 值不一致时不续期、不删除
+			ok, _ = mem.CompareAndExpire(ctx, rk, "other", time.Second*10)
+			So(ok, ShouldBeFalse)
+			ok, _ = mem.CompareAndDel(ctx, rk, "other")
+			So(ok, ShouldBeFalse)
+
+			ok, _ = mem.CompareAndExpire(ctx, rk, "token", time.Second*10)
+			So(ok, ShouldBeTrue)
+			So(mem.TTL(rk), ShouldBeGreaterThan, 9*time.Second)
+			ok, _ = mem.CompareAndDel(ctx, rk, "token")
+			So(ok, ShouldBeTrue)
+			So(mem.TTL(rk), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("集合读写, 过期时间只延长不缩短", func() {
+			So(mem.SAddWithExpire(ctx, rk, time.Second*10, "a", "b"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldBeGreaterThan, 9*time.Second)
+			So(mem.SAddWithExpire(ctx, rk, time.Second, "c"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldBeGreaterThan, 9*time.Second)
+			So(mem.SAddWithExpire(ctx, rk, time.Second*20, "a"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldBeGreaterThan, 19*time.Second)
+			members, err := mem.SMembers(ctx, rk)
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, 3)
+			So(members, ShouldContain, "c")
+
+			// 不过期的成员加入后集合不过期
+			So(mem.SAddWithExpire(ctx, rk, 0, "d"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldEqual, -1*time.Second)
+			So(mem.SAddWithExpire(ctx, rk, time.Second, "e"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldEqual, -1*time.Second)
+
+			// 集合不是string类型
+			_, err = mem.Get(ctx, rk)
+			So(err, ShouldNotBeNil)
+
+			So(mem.SRem(ctx, rk, "a", "b", "c"), ShouldBeNil)
+			members, _ = mem.SMembers(ctx, rk)
+			So(members, ShouldHaveLength, 2)
+			So(mem.SRem(ctx, rk, "d", "e"), ShouldBeNil)
+			So(mem.TTL(rk), ShouldEqual, -2*time.Second)
+			members, err = mem.SMembers(ctx, rk)
+			So(err, ShouldBeNil)
+			So(members, ShouldBeEmpty)
+
+			p := mem.Pipeline(ctx)
+			p.SAddWithExpire(rk2, time.Second*10, "a")
+			So(p.Exec(), ShouldBeNil)
+			members, _ = mem.SMembers(ctx, rk2)
+			So(members, ShouldResemble, []string{"a"})
+		})
+
+		Convey("租约有效时写入并删除租约", func() {
+			leaseKey := rk + ":lease"
+			// 租约不存在或token不一致时不写入
+			ok, err := mem.LeaseSet(ctx, leaseKey, "token", rk, "v", time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			_, _ = mem.SetNX(ctx, leaseKey, "token", time.Second)
+			ok, _ = mem.LeaseHSet(ctx, leaseKey, "other", rk2, sk, "v", time.Second)
+			So(ok, ShouldBeFalse)
+			So(mem.TTL(rk2), ShouldEqual, -2*time.Second)
+
+			ok, _ = mem.LeaseSet(ctx, leaseKey, "token", rk, "v", time.Second*10)
+			So(ok, ShouldBeTrue)
+			v, _ := mem.Get(ctx, rk)
+			So(v, ShouldEqual, "v")
+			So(mem.TTL(rk), ShouldBeGreaterThan, 9*time.Second)
+			So(mem.TTL(leaseKey), ShouldEqual, -2*time.Second)
+
+			_, _ = mem.SetNX(ctx, leaseKey, "token", time.Second)
+			ok, _ = mem.LeaseHSet(ctx, leaseKey, "token", rk2, sk, "v", time.Second*10)
+			So(ok, ShouldBeTrue)
+			v, _ = mem.HGet(ctx, rk2, sk)
+			So(v, ShouldEqual, "v")
+			So(mem.TTL(rk2), ShouldBeGreaterThan, 9*time.Second)
+			So(mem.TTL(leaseKey), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("计数器递增, 保留过期时间", func() {
+			n, err := mem.Incr(ctx, rk)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(mem.TTL(rk), ShouldEqual, -1*time.Second)
+
+			_ = mem.Expire(ctx, rk, time.Second*10)
+			n, _ = mem.Incr(ctx, rk)
+			So(n, ShouldEqual, 2)
+			So(mem.TTL(rk), ShouldBeGreaterThan, 9*time.Second)
+
+			_ = mem.Set(ctx, rk, "v", 0)
+			_, err = mem.Incr(ctx, rk)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("所有key加上前缀, 集合成员及存储值不加前缀", func() {
+			prefixed := NewPrefixBackend(mem, staticPrefix("ns:1:"))
+			So(prefixed.Set(ctx, rk, "v", 0), ShouldBeNil)
+			v, _ := mem.Get(ctx, "ns:1:"+rk)
+			So(v, ShouldEqual, "v")
+			_, err := mem.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			p := prefixed.Pipeline(ctx)
+			p.HSet(rk2, sk, "v")
+			p.SAddWithExpire(rk+":tag", time.Second, rk)
+			So(p.Exec(), ShouldBeNil)
+			v, _ = prefixed.HGet(ctx, rk2, sk)
+			So(v, ShouldEqual, "v")
+			members, _ := mem.SMembers(ctx, "ns:1:"+rk+":tag")
+			So(members, ShouldResemble, []string{rk})
+
+			_, _ = prefixed.SetNX(ctx, rk+":lease", "token", time.Second)
+			ok, _ := prefixed.LeaseSet(ctx, rk+":lease", "token", rk, "v2", 0)
+			So(ok, ShouldBeTrue)
+			v, _ = mem.Get(ctx, "ns:1:"+rk)
+			So(v, ShouldEqual, "v2")
+
+			// 获取前缀失败时不访问存储
+			failed := NewPrefixBackend(mem, staticPrefix(""))
+			So(failed.Set(ctx, rk, "v", 0), ShouldEqual, errNoPrefix)
+			p = failed.Pipeline(ctx)
+			p.Del("ns:1:" + rk)
+			So(p.Exec(), ShouldEqual, errNoPrefix)
+			v, _ = mem.Get(ctx, "ns:1:"+rk)
+			So(v, ShouldEqual, "v2")
+		})
+	})
+}
+
+var errNoPrefix = errors.New("no prefix")
+
+// staticPrefix 固定的key前缀, 为空时获取前缀失败
+type staticPrefix string
+
+func (p staticPrefix) Prefix(ctx context.Context) (string, error) {
+	if p == "" {
+		return "", errNoPrefix
+	}
+	return string(p), nil
+}
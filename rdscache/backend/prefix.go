@@ -0,0 +1,247 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// IKeyPrefix key前缀抽象, 前缀可以是动态的(例如包含命名空间的代数), 每次访问存储时获取
+type IKeyPrefix interface {
+	Prefix(ctx context.Context) (string, error)
+}
+
+// prefixBackend 为所有key加上前缀的存储后端, 集合中的成员及缓存值不加前缀
+// 前缀中不可包含{}, 防止集群模式下改变key的hash tag; 租约key(LeaseKey)的hash tag以加了前缀的缓存key重新生成
+type prefixBackend struct {
+	inner  IBackend
+	prefix IKeyPrefix
+}
+
+// NewPrefixBackend 包装存储后端, 访问inner时所有的key都加上prefix返回的前缀, 获取前缀失败时直接返回错误
+func NewPrefixBackend(inner IBackend, prefix IKeyPrefix) IBackend {
+	if prefix == nil {
+		return inner
+	}
+	return &prefixBackend{inner: inner, prefix: prefix}
+}
+
+// prefixKey 为key加上前缀, 租约key以加了前缀的缓存key重新生成hash tag, 保证集群模式下和缓存在同一个slot中
+func prefixKey(prefix, key string) string {
+	if prefix != "" && strings.HasPrefix(key, LeaseKeyPrefix) {
+		return prefixLeaseKey(prefix, key)
+	}
+	return prefix + key
+}
+
+func prefixKeys(prefix string, keys []string) []string {
+	ret := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, prefixKey(prefix, key))
+	}
+	return ret
+}
+
+func (b *prefixBackend) Get(ctx context.Context, key string) (string, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	return b.inner.Get(ctx, prefixKey(prefix, key))
+}
+
+func (b *prefixBackend) Set(ctx context.Context, key, value string, expTime time.Duration) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.Set(ctx, prefixKey(prefix, key), value, expTime)
+}
+
+func (b *prefixBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	return b.inner.HGet(ctx, prefixKey(prefix, key), field)
+}
+
+func (b *prefixBackend) HSet(ctx context.Context, key, field, value string) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.HSet(ctx, prefixKey(prefix, key), field, value)
+}
+
+func (b *prefixBackend) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.inner.MGet(ctx, prefixKeys(prefix, keys)...)
+}
+
+func (b *prefixBackend) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.inner.HMGet(ctx, prefixKey(prefix, key), fields...)
+}
+
+func (b *prefixBackend) Expire(ctx context.Context, key string, expTime time.Duration) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.Expire(ctx, prefixKey(prefix, key), expTime)
+}
+
+func (b *prefixBackend) Del(ctx context.Context, keys ...string) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.Del(ctx, prefixKeys(prefix, keys)...)
+}
+
+func (b *prefixBackend) HDel(ctx context.Context, key string, fields ...string) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.HDel(ctx, prefixKey(prefix, key), fields...)
+}
+
+func (b *prefixBackend) Incr(ctx context.Context, key string) (int64, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return b.inner.Incr(ctx, prefixKey(prefix, key))
+}
+
+func (b *prefixBackend) SAddWithExpire(
+	ctx context.Context, key string, expTime time.Duration, members ...string) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.SAddWithExpire(ctx, prefixKey(prefix, key), expTime, members...)
+}
+
+func (b *prefixBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.inner.SMembers(ctx, prefixKey(prefix, key))
+}
+
+func (b *prefixBackend) SScan(
+	ctx context.Context, key string, cursor uint64, count int64) ([]string, uint64, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b.inner.SScan(ctx, prefixKey(prefix, key), cursor, count)
+}
+
+func (b *prefixBackend) SRem(ctx context.Context, key string, members ...string) error {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return b.inner.SRem(ctx, prefixKey(prefix, key), members...)
+}
+
+func (b *prefixBackend) SetNX(ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return b.inner.SetNX(ctx, prefixKey(prefix, key), value, expTime)
+}
+
+func (b *prefixBackend) CompareAndDel(ctx context.Context, key, value string) (bool, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return b.inner.CompareAndDel(ctx, prefixKey(prefix, key), value)
+}
+
+func (b *prefixBackend) CompareAndExpire(
+	ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return b.inner.CompareAndExpire(ctx, prefixKey(prefix, key), value, expTime)
+}
+
+func (b *prefixBackend) LeaseSet(
+	ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (bool, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return b.inner.LeaseSet(ctx, prefixKey(prefix, leaseKey), token, prefixKey(prefix, key), value, expTime)
+}
+
+func (b *prefixBackend) LeaseHSet(
+	ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (bool, error) {
+	prefix, err := b.prefix.Prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return b.inner.LeaseHSet(ctx, prefixKey(prefix, leaseKey), token, prefixKey(prefix, key), field, value, expTime)
+}
+
+// Pipeline 创建管道时获取前缀, 管道中的命令均使用该前缀; 获取前缀失败时Exec返回该错误且不执行管道中的命令
+func (b *prefixBackend) Pipeline(ctx context.Context) IPipeline {
+	prefix, err := b.prefix.Prefix(ctx)
+	return &prefixPipeline{IPipeline: b.inner.Pipeline(ctx), prefix: prefix, err: err}
+}
+
+type prefixPipeline struct {
+	IPipeline
+	prefix string
+	err    error
+}
+
+func (p *prefixPipeline) Set(key, value string, expTime time.Duration) {
+	p.IPipeline.Set(prefixKey(p.prefix, key), value, expTime)
+}
+
+func (p *prefixPipeline) HSet(key, field, value string) {
+	p.IPipeline.HSet(prefixKey(p.prefix, key), field, value)
+}
+
+func (p *prefixPipeline) HMSet(key string, fields map[string]interface{}) {
+	p.IPipeline.HMSet(prefixKey(p.prefix, key), fields)
+}
+
+func (p *prefixPipeline) Expire(key string, expTime time.Duration) {
+	p.IPipeline.Expire(prefixKey(p.prefix, key), expTime)
+}
+
+func (p *prefixPipeline) Del(keys ...string) {
+	p.IPipeline.Del(prefixKeys(p.prefix, keys)...)
+}
+
+func (p *prefixPipeline) HDel(key string, fields ...string) {
+	p.IPipeline.HDel(prefixKey(p.prefix, key), fields...)
+}
+
+func (p *prefixPipeline) SAddWithExpire(key string, expTime time.Duration, members ...string) {
+	p.IPipeline.SAddWithExpire(prefixKey(p.prefix, key), expTime, members...)
+}
+
+func (p *prefixPipeline) Exec() error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.IPipeline.Exec()
+}
@@ -0,0 +1,419 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/go-redis/redis"
+)
+
+var (
+	// compareAndDelScript 值一致时才删除, 防止释放其它持有者的锁
+	compareAndDelScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	// compareAndExpireScript 值一致时才续期, ARGV[2]为毫秒
+	compareAndExpireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	// sAddWithExpireScript 添加成员并延长集合的过期时间, ARGV[1]为毫秒, <=0代表不过期
+	// 添加前集合不存在时设置过期时间; 已存在且不过期时保持不过期; 剩余过期时间较短时延长
+	sAddWithExpireScript = redis.NewScript(`
+local cur = redis.call("PTTL", KEYS[1])
+redis.call("SADD", KEYS[1], unpack(ARGV, 2))
+local ttl = tonumber(ARGV[1])
+if ttl <= 0 then
+	redis.call("PERSIST", KEYS[1])
+elseif cur == -2 or (cur >= 0 and cur < ttl) then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1`)
+	// leaseSetScript 租约有效时才写入并删除租约, ARGV[3]为毫秒, <=0代表不过期
+	leaseSetScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[2], ARGV[2])
+end
+redis.call("DEL", KEYS[1])
+return 1`)
+	// leaseHSetScript 租约有效时才写入hash并删除租约, ARGV[4]为毫秒, <=0代表不设置过期时间
+	leaseHSetScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[2], ARGV[2], ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	redis.call("PEXPIRE", KEYS[2], ARGV[4])
+end
+redis.call("DEL", KEYS[1])
+return 1`)
+)
+
+// rdsBackend 基于go-redis实现的存储后端
+type rdsBackend struct {
+	// withCtx 获取绑定了ctx的客户端, go-redis v6只保存ctx, 不会将其作用于网络读写, 超时控制见do
+	withCtx func(ctx context.Context) redis.Cmdable
+	// crossSlot 集群及ring模式下多个key可能分布在不同节点上, 多key命令需拆分成单key命令通过管道发送
+	crossSlot bool
+}
+
+// NewRedisBackend 单机redis存储后端, 哨兵模式(redis.NewFailoverClient创建的客户端)同样适用
+func NewRedisBackend(rds *redis.Client) IBackend {
+	return &rdsBackend{withCtx: func(ctx context.Context) redis.Cmdable { return rds.WithContext(ctx) }}
+}
+
+// NewClusterBackend redis集群存储后端
+func NewClusterBackend(rds *redis.ClusterClient) IBackend {
+	return &rdsBackend{
+		withCtx:   func(ctx context.Context) redis.Cmdable { return rds.WithContext(ctx) },
+		crossSlot: true,
+	}
+}
+
+// NewRingBackend redis ring(客户端分片)存储后端
+func NewRingBackend(rds *redis.Ring) IBackend {
+	return &rdsBackend{
+		withCtx:   func(ctx context.Context) redis.Cmdable { return rds.WithContext(ctx) },
+		crossSlot: true,
+	}
+}
+
+// do 执行redis命令, ctx已经超时或取消时不再发起请求
+// 命令执行过程中ctx超时或取消时立即返回ctx的错误, 命令所在协程在客户端读写超时(ReadTimeout/WriteTimeout)后退出,
+// 连接的释放仍然依赖客户端的读写超时配置
+func (b *rdsBackend) do(ctx context.Context, fn func(cmd redis.Cmdable) (interface{}, error)) (interface{}, error) {
+	return race(ctx, func() (interface{}, error) { return fn(b.withCtx(ctx)) })
+}
+
+// race fn与ctx竞争, 先完成者的结果作为返回值; ctx不会结束时直接在当前协程执行fn
+func race(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	type result struct {
+		v   interface{}
+		err error
+	}
+	// 带缓冲, ctx先结束时fn所在协程也能写入结果后退出
+	ch := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		ch <- result{v: v, err: err}
+	}()
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *rdsBackend) Get(ctx context.Context, key string) (string, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return cmd.Get(key).Result()
+	})
+	res, _ := v.(string)
+	return res, convertRdsErr(err)
+}
+
+func (b *rdsBackend) Set(ctx context.Context, key, value string, expTime time.Duration) error {
+	_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return nil, cmd.Set(key, value, expTime).Err()
+	})
+	return err
+}
+
+func (b *rdsBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return cmd.HGet(key, field).Result()
+	})
+	res, _ := v.(string)
+	return res, convertRdsErr(err)
+}
+
+func (b *rdsBackend) HSet(ctx context.Context, key, field, value string) error {
+	_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return nil, cmd.HSet(key, field, value).Err()
+	})
+	return err
+}
+
+func (b *rdsBackend) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		if !b.crossSlot {
+			return cmd.MGet(keys...).Result()
+		}
+		return pipelineGet(cmd, keys)
+	})
+	res, _ := v.([]interface{})
+	return res, err
+}
+
+// pipelineGet key可能分布在不同的节点上，拆分为多个get命令通过管道获取
+func pipelineGet(cmd redis.Cmdable, keys []string) ([]interface{}, error) {
+	p := cmd.Pipeline()
+	defer func() { _ = p.Close() }()
+	cmds := make([]*redis.StringCmd, 0, len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, p.Get(key))
+	}
+	// 部分key不存在时Exec会返回redis.Nil，需要逐个命令判断
+	if _, err := p.Exec(); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	ret := make([]interface{}, len(cmds))
+	for idx, cmd := range cmds {
+		v, err := cmd.Result()
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			return nil, err
+		}
+		ret[idx] = v
+	}
+	return ret, nil
+}
+
+func (b *rdsBackend) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return cmd.HMGet(key, fields...).Result()
+	})
+	res, _ := v.([]interface{})
+	return res, err
+}
+
+func (b *rdsBackend) Expire(ctx context.Context, key string, expTime time.Duration) error {
+	_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return nil, cmd.Expire(key, expTime).Err()
+	})
+	return err
+}
+
+func (b *rdsBackend) Del(ctx context.Context, keys ...string) error {
+	if !b.crossSlot || len(keys) <= 1 {
+		_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+			return nil, cmd.Del(keys...).Err()
+		})
+		return err
+	}
+
+	p := b.Pipeline(ctx)
+	defer func() { _ = p.Close() }()
+	p.Del(keys...)
+	return p.Exec()
+}
+
+func (b *rdsBackend) HDel(ctx context.Context, key string, fields ...string) error {
+	_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return nil, cmd.HDel(key, fields...).Err()
+	})
+	return err
+}
+
+func (b *rdsBackend) Incr(ctx context.Context, key string) (int64, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return cmd.Incr(key).Result()
+	})
+	res, _ := v.(int64)
+	return res, err
+}
+
+func (b *rdsBackend) SAddWithExpire(
+	ctx context.Context, key string, expTime time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return nil, sAddWithExpireScript.Run(cmd, []string{key}, sAddWithExpireArgs(expTime, members)...).Err()
+	})
+	return err
+}
+
+func (b *rdsBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return cmd.SMembers(key).Result()
+	})
+	res, _ := v.([]string)
+	return res, err
+}
+
+func (b *rdsBackend) SScan(
+	ctx context.Context, key string, cursor uint64, count int64) ([]string, uint64, error) {
+	type page struct {
+		members []string
+		cursor  uint64
+	}
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		members, next, err := cmd.SScan(key, cursor, "", count).Result()
+		return page{members: members, cursor: next}, err
+	})
+	res, _ := v.(page)
+	return res.members, res.cursor, err
+}
+
+func (b *rdsBackend) SRem(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		args = append(args, m)
+	}
+	_, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return nil, cmd.SRem(key, args...).Err()
+	})
+	return err
+}
+
+func (b *rdsBackend) SetNX(ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return cmd.SetNX(key, value, expTime).Result()
+	})
+	res, _ := v.(bool)
+	return res, err
+}
+
+func (b *rdsBackend) CompareAndDel(ctx context.Context, key, value string) (bool, error) {
+	return b.runScript(ctx, compareAndDelScript, []string{key}, value)
+}
+
+func (b *rdsBackend) CompareAndExpire(ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	return b.runScript(ctx, compareAndExpireScript, []string{key}, value, int64(expTime/time.Millisecond))
+}
+
+func (b *rdsBackend) LeaseSet(
+	ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (bool, error) {
+	return b.runScript(ctx, leaseSetScript,
+		[]string{leaseKey, key}, token, value, int64(expTime/time.Millisecond))
+}
+
+func (b *rdsBackend) LeaseHSet(
+	ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (bool, error) {
+	return b.runScript(ctx, leaseHSetScript,
+		[]string{leaseKey, key}, token, field, value, int64(expTime/time.Millisecond))
+}
+
+// runScript 执行返回0/1的脚本, 返回1时代表执行成功
+func (b *rdsBackend) runScript(
+	ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (bool, error) {
+	v, err := b.do(ctx, func(cmd redis.Cmdable) (interface{}, error) {
+		return script.Run(cmd, keys, args...).Int64()
+	})
+	n, _ := v.(int64)
+	return n == 1, err
+}
+
+func (b *rdsBackend) Pipeline(ctx context.Context) IPipeline {
+	return &rdsPipeline{ctx: ctx, p: b.withCtx(ctx).Pipeline(), crossSlot: b.crossSlot}
+}
+
+type rdsPipeline struct {
+	ctx       context.Context
+	p         redis.Pipeliner
+	crossSlot bool
+	// execDone Exec因ctx结束提前返回时, 管道仍在后台协程中使用, 关闭管道需等待其执行完毕
+	execDone chan struct{}
+}
+
+func (p *rdsPipeline) Set(key, value string, expTime time.Duration) {
+	p.p.Set(key, value, expTime)
+}
+
+func (p *rdsPipeline) HSet(key, field, value string) {
+	p.p.HSet(key, field, value)
+}
+
+func (p *rdsPipeline) HMSet(key string, fields map[string]interface{}) {
+	p.p.HMSet(key, fields)
+}
+
+func (p *rdsPipeline) Expire(key string, expTime time.Duration) {
+	p.p.Expire(key, expTime)
+}
+
+func (p *rdsPipeline) Del(keys ...string) {
+	if !p.crossSlot {
+		p.p.Del(keys...)
+		return
+	}
+	for _, key := range keys {
+		p.p.Del(key)
+	}
+}
+
+func (p *rdsPipeline) HDel(key string, fields ...string) {
+	p.p.HDel(key, fields...)
+}
+
+// SAddWithExpire 管道中无法在脚本未加载时重试, 直接发送脚本内容
+func (p *rdsPipeline) SAddWithExpire(key string, expTime time.Duration, members ...string) {
+	if len(members) == 0 {
+		return
+	}
+	sAddWithExpireScript.Eval(p.p, []string{key}, sAddWithExpireArgs(expTime, members)...)
+}
+
+// Exec 执行管道中的命令, 执行过程中ctx超时或取消时立即返回ctx的错误
+func (p *rdsPipeline) Exec() error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	p.execDone = done
+	_, err := race(p.ctx, func() (interface{}, error) {
+		defer close(done)
+		_, err := p.p.Exec()
+		return nil, err
+	})
+	return err
+}
+
+// Close 关闭管道, Exec提前返回时在管道执行完毕后异步关闭
+func (p *rdsPipeline) Close() error {
+	done := p.execDone
+	if done == nil {
+		return p.p.Close()
+	}
+	select {
+	case <-done:
+		return p.p.Close()
+	default:
+		go func() {
+			<-done
+			_ = p.p.Close()
+		}()
+		return nil
+	}
+}
+
+func sAddWithExpireArgs(expTime time.Duration, members []string) []interface{} {
+	args := make([]interface{}, 0, len(members)+1)
+	args = append(args, int64(expTime/time.Millisecond))
+	for _, m := range members {
+		args = append(args, m)
+	}
+	return args
+}
+
+// convertRdsErr 将redis.Nil转换为组件统一的数据不存在错误
+func convertRdsErr(err error) error {
+	if err == redis.Nil {
+		return rdscache.ErrCacheNotExist
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package backend
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+	"github.com/go-redis/redis"
+)
+
+var (
+	ctx = context.Background()
+	rds = redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	store = NewRedisBackend(rds)
+	rk    = "testBackend"
+	rk2   = "testBackend_02"
+	sk    = "subKey"
+)
+
+func delTestData() {
+	rds.Del(rk, rk2, rk+":lease")
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	delTestData()
+	os.Exit(code)
+}
+
+func Test_rdsBackend(t *testing.T) {
+	Convey("redis存储后端", t, func() {
+		delTestData()
+
+		Convey("string读写", func() {
+			_, err := store.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			So(store.Set(ctx, rk, "v", time.Second*10), ShouldBeNil)
+			v, err := store.Get(ctx, rk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+			ttl, _ := rds.TTL(rk).Result()
+			So(ttl, ShouldBeGreaterThan, 9*time.Second)
+
+			ret, err := store.MGet(ctx, rk, rk2)
+			So(err, ShouldBeNil)
+			So(ret[0], ShouldEqual, "v")
+			So(ret[1], ShouldBeNil)
+
+			So(store.Del(ctx, rk), ShouldBeNil)
+			_, err = store.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		})
+
+		Convey("hash读写", func() {
+			_, err := store.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			So(store.HSet(ctx, rk, sk, "v"), ShouldBeNil)
+			So(store.Expire(ctx, rk, time.Second*10), ShouldBeNil)
+			v, err := store.HGet(ctx, rk, sk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+
+			ret, err := store.HMGet(ctx, rk, sk, "notExist")
+			So(err, ShouldBeNil)
+			So(ret[0], ShouldEqual, "v")
+			So(ret[1], ShouldBeNil)
+
+			So(store.HDel(ctx, rk, sk, "notExist"), ShouldBeNil)
+			_, err = store.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		})
+
+		Convey("管道批量写入", func() {
+			p := store.Pipeline(ctx)
+			p.Set(rk, "v", time.Second*10)
+			p.HMSet(rk2, map[string]interface{}{sk: "v"})
+			p.Expire(rk2, time.Second*10)
+			So(p.Exec(), ShouldBeNil)
+			So(p.Close(), ShouldBeNil)
+
+			v, _ := rds.Get(rk).Result()
+			So(v, ShouldEqual, "v")
+			v, _ = rds.HGet(rk2, sk).Result()
+			So(v, ShouldEqual, "v")
+			ttl, _ := rds.TTL(rk2).Result()
+			So(ttl, ShouldBeGreaterThan, 9*time.Second)
+		})
+
+		Convey("分布式锁相关的原子操作", func() {
+			ok, err := store.SetNX(ctx, rk, "token", time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			ok, _ = store.SetNX(ctx, rk, "other", time.Second)
+			So(ok, ShouldBeFalse)
+
+			ok, err = store.CompareAndExpire(ctx, rk, "other", time.Second*10)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			ok, _ = store.CompareAndExpire(ctx, rk, "token", time.Second*10)
+			So(ok, ShouldBeTrue)
+			ttl, _ := rds.TTL(rk).Result()
+			So(ttl, ShouldBeGreaterThan, 9*time.Second)
+
+			ok, err = store.CompareAndDel(ctx, rk, "other")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			ok, _ = store.CompareAndDel(ctx, rk, "token")
+			So(ok, ShouldBeTrue)
+			_, err = store.Get(ctx, rk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		})
+
+		Convey("集合读写, 过期时间只延长不缩短", func() {
+			So(store.SAddWithExpire(ctx, rk, time.Second*10, "a", "b"), ShouldBeNil)
+			So(store.SAddWithExpire(ctx, rk, time.Second, "c"), ShouldBeNil)
+			ttl, _ := rds.TTL(rk).Result()
+			So(ttl, ShouldBeGreaterThan, 9*time.Second)
+			members, err := store.SMembers(ctx, rk)
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, 3)
+
+			p := store.Pipeline(ctx)
+			p.SAddWithExpire(rk, time.Second*20, "d")
+			So(p.Exec(), ShouldBeNil)
+			ttl, _ = rds.TTL(rk).Result()
+			So(ttl, ShouldBeGreaterThan, 19*time.Second)
+
+			So(store.SRem(ctx, rk, "a", "b", "c", "d"), ShouldBeNil)
+			members, err = store.SMembers(ctx, rk)
+			So(err, ShouldBeNil)
+			So(members, ShouldBeEmpty)
+		})
+
+		Convey("租约有效时写入并删除租约", func() {
+			leaseKey := rk + ":lease"
+			ok, err := store.LeaseSet(ctx, leaseKey, "token", rk2, "v", time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+
+			_, _ = store.SetNX(ctx, leaseKey, "token", time.Second)
+			ok, err = store.LeaseSet(ctx, leaseKey, "token", rk2, "v", time.Second*10)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			v, _ := store.Get(ctx, rk2)
+			So(v, ShouldEqual, "v")
+			ttl, _ := rds.PTTL(rk2).Result()
+			So(ttl, ShouldBeGreaterThan, 9*time.Second)
+			_, err = store.Get(ctx, leaseKey)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			rds.Del(rk2)
+			_, _ = store.SetNX(ctx, leaseKey, "token", time.Second)
+			ok, err = store.LeaseHSet(ctx, leaseKey, "token", rk2, sk, "v", 0)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			v, _ = store.HGet(ctx, rk2, sk)
+			So(v, ShouldEqual, "v")
+			ttl, _ = rds.TTL(rk2).Result()
+			So(ttl, ShouldEqual, -1*time.Second)
+			_, err = store.Get(ctx, leaseKey)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		})
+	})
+}
+
+func Test_race(t *testing.T) {
+	Convey("命令与ctx竞争", t, func() {
+		Convey("命令先完成时返回命令的结果", func() {
+			c, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			v, err := race(c, func() (interface{}, error) { return "v", nil })
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+		})
+
+		Convey("ctx先结束时立即返回ctx的错误", func() {
+			block := make(chan struct{})
+			defer close(block)
+			c, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+			defer cancel()
+			start := time.Now()
+			_, err := race(c, func() (interface{}, error) {
+				<-block
+				return nil, nil
+			})
+			So(err, ShouldEqual, context.DeadlineExceeded)
+			So(time.Since(start), ShouldBeLessThan, time.Millisecond*500)
+		})
+
+		Convey("ctx已经结束时不执行命令", func() {
+			c, cancel := context.WithCancel(ctx)
+			cancel()
+			called := false
+			_, err := race(c, func() (interface{}, error) {
+				called = true
+				return nil, nil
+			})
+			So(err, ShouldEqual, context.Canceled)
+			So(called, ShouldBeFalse)
+		})
+	})
+}
+
+func Test_rdsBackendStalledServer(t *testing.T) {
+	Convey("redis服务端无响应时, ctx超时后立即返回", t, func() {
+		// 只建立连接不回复任何数据的服务端
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer func() { _ = ln.Close() }()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer func() { _ = conn.Close() }()
+			}
+		}()
+
+		stalled := redis.NewClient(&redis.Options{
+			Addr:        ln.Addr().String(),
+			ReadTimeout: time.Second * 3,
+			MaxRetries:  0,
+		})
+		defer func() { _ = stalled.Close() }()
+		s := NewRedisBackend(stalled)
+
+		c, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+		defer cancel()
+		start := time.Now()
+		_, err = s.Get(c, rk)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+
+		c2, cancel2 := context.WithTimeout(ctx, time.Millisecond*100)
+		defer cancel2()
+		start = time.Now()
+		p := s.Pipeline(c2)
+		p.Set(rk, "v", time.Second)
+		err = p.Exec()
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+		So(p.Close(), ShouldBeNil)
+	})
+}
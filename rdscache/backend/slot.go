@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// clusterSlots redis集群的slot数量
+const clusterSlots = 16384
+
+var (
+	slotTagsOnce sync.Once
+	// slotTags 每个slot对应的一个hash tag, 用于无法直接作为hash tag的key
+	slotTags [clusterSlots]string
+)
+
+// hashTag redis集群计算slot时使用的部分, 和redis的规则完全一致:
+// key中第一个{和其后第一个}之间的内容, 不存在或为空({})时使用整个key
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// KeySlot key在redis集群中的slot
+func KeySlot(key string) int {
+	return int(crc16(hashTag(key)) % clusterSlots)
+}
+
+// LeaseKeyPrefix 租约key的前缀, 缓存key不可以此开头
+const LeaseKeyPrefix = "sponge:lease:"
+
+// LeaseKey 缓存key对应的租约key, 以和缓存key同slot的hash tag开头
+// 保证集群模式下租约和缓存在同一个slot中, 可以在同一个lua脚本中操作
+// prefixBackend为租约key加前缀时以加了前缀的缓存key重新生成hash tag, 见prefixKey
+func LeaseKey(key string) string {
+	return LeaseKeyPrefix + "{" + slotTag(key) + "}:" + key
+}
+
+// prefixLeaseKey 为租约key中的缓存key加上前缀并重新生成hash tag, 租约key之后以\x00分隔的部分(例如subKey)保持不变
+func prefixLeaseKey(prefix, leaseKey string) string {
+	rest := leaseKey[len(LeaseKeyPrefix):]
+	// hash tag中不包含}, 第一个}:之后为缓存key
+	end := strings.Index(rest, "}:")
+	if !strings.HasPrefix(rest, "{") || end < 0 {
+		return prefix + leaseKey
+	}
+	key, suffix := rest[end+2:], ""
+	if i := strings.IndexByte(key, '\x00'); i >= 0 {
+		key, suffix = key[:i], key[i:]
+	}
+	return LeaseKey(prefix+key) + suffix
+}
+
+// slotTag 和key在同一个slot中的hash tag, 拼接为{tag}后作为其它key的hash tag
+// 参与计算的部分不包含}时直接使用, 否则使用slot对应的预先计算的tag
+func slotTag(key string) string {
+	tag := hashTag(key)
+	if tag != "" && strings.IndexByte(tag, '}') < 0 {
+		return tag
+	}
+	slotTagsOnce.Do(initSlotTags)
+	return slotTags[KeySlot(key)]
+}
+
+// initSlotTags 为每个slot找到一个不包含{}的tag
+func initSlotTags() {
+	remain := clusterSlots
+	for n := int64(0); remain > 0; n++ {
+		tag := strconv.FormatInt(n, 36)
+		slot := crc16(tag) % clusterSlots
+		if slotTags[slot] == "" {
+			slotTags[slot] = tag
+			remain--
+		}
+	}
+}
+
+// crc16 redis集群使用的CRC16(XMODEM)
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
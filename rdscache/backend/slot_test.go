@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"testing"
+
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func Test_keySlot(t *testing.T) {
+	Convey("和redis集群的slot计算规则一致", t, func() {
+		So(crc16("123456789"), ShouldEqual, 0x31C3)
+		So(KeySlot("foo"), ShouldEqual, 12182)
+		So(KeySlot("{foo}.bar"), ShouldEqual, 12182)
+		So(KeySlot("bar{foo}"), ShouldEqual, 12182)
+		// 第一个{之后的第一个}
+		So(hashTag("{foo}}bar"), ShouldEqual, "foo")
+		So(hashTag("{a{b}c}"), ShouldEqual, "a{b")
+		// 空的{}或没有闭合时使用整个key
+		So(hashTag("foo{}{bar}"), ShouldEqual, "foo{}{bar}")
+		So(hashTag("foo{bar"), ShouldEqual, "foo{bar")
+	})
+
+	Convey("租约key和缓存key在同一个slot中", t, func() {
+		keys := []string{
+			"plain", "user:{1}:profile", "{foo}}bar", "{a{b}c}", "foo{}{bar}", "a}b{c", "}{", "{}", "{}}", "a{b",
+		}
+		for _, key := range keys {
+			So(KeySlot(LeaseKey(key)), ShouldEqual, KeySlot(key))
+			So(KeySlot(LeaseKey(key)+"\x00{sub}"), ShouldEqual, KeySlot(key))
+			// 加前缀后以加了前缀的缓存key重新生成hash tag
+			So(KeySlot(prefixLeaseKey("ns:0:", LeaseKey(key)+"\x00{sub}")), ShouldEqual, KeySlot("ns:0:"+key))
+			So(prefixLeaseKey("ns:0:", LeaseKey(key)+"\x00{sub}"), ShouldEqual, LeaseKey("ns:0:"+key)+"\x00{sub}")
+		}
+		// 可以直接作为hash tag时保持可读
+		So(LeaseKey("user:{1}:profile"), ShouldEqual, LeaseKeyPrefix+"{1}:user:{1}:profile")
+	})
+}
@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// IValueTransformer 存储值转换抽象, 写入存储前Encode, 从存储中读取后Decode, 可用于压缩、加密等
+// key为存储值所在的位置, string类型为key, hash类型为key和field以\x00拼接, 加密时可作为附加数据防止密文被挪用
+type IValueTransformer interface {
+	Encode(key, value string) (string, error)
+	// Decode 可按需兼容未经过Encode的原始值, 保证转换前后写入的数据可以共存
+	Decode(key, value string) (string, error)
+}
+
+// transformBackend 对存储值进行转换的存储后端, 写入时按顺序Encode, 读取时按逆序Decode
+// SetNX及CompareAndXxx用于分布式锁等组件内部数据, 不经过转换; LeaseXxx写入的缓存值同样经过转换
+type transformBackend struct {
+	IBackend
+	transformers []IValueTransformer
+}
+
+// NewTransformBackend 包装存储后端, 所有写入的值经过transformers转换后再写入inner
+// 批量获取时某个值Decode失败, 该值视为不存在, 由调用方回源后覆盖
+func NewTransformBackend(inner IBackend, transformers ...IValueTransformer) IBackend {
+	if len(transformers) == 0 {
+		return inner
+	}
+	return &transformBackend{IBackend: inner, transformers: transformers}
+}
+
+func (b *transformBackend) encode(key, value string) (string, error) {
+	var err error
+	for _, t := range b.transformers {
+		value, err = t.Encode(key, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+func (b *transformBackend) decode(key, value string) (string, error) {
+	var err error
+	for i := len(b.transformers) - 1; i >= 0; i-- {
+		value, err = b.transformers[i].Decode(key, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// decodeValues 批量解码, keys和values一一对应, Decode失败的值置为nil
+// 原样保留可能把未加密或被篡改的值当作正常数据返回
+func (b *transformBackend) decodeValues(keys []string, values []interface{}) {
+	for idx, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		decoded, err := b.decode(keys[idx], s)
+		if err != nil {
+			values[idx] = nil
+			continue
+		}
+		values[idx] = decoded
+	}
+}
+
+// fieldKey hash中field对应的存储值所在的位置
+func fieldKey(key, field string) string {
+	return key + "\x00" + field
+}
+
+func (b *transformBackend) Get(ctx context.Context, key string) (string, error) {
+	res, err := b.IBackend.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return b.decode(key, res)
+}
+
+func (b *transformBackend) Set(ctx context.Context, key, value string, expTime time.Duration) error {
+	value, err := b.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return b.IBackend.Set(ctx, key, value, expTime)
+}
+
+func (b *transformBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	res, err := b.IBackend.HGet(ctx, key, field)
+	if err != nil {
+		return "", err
+	}
+	return b.decode(fieldKey(key, field), res)
+}
+
+func (b *transformBackend) HSet(ctx context.Context, key, field, value string) error {
+	value, err := b.encode(fieldKey(key, field), value)
+	if err != nil {
+		return err
+	}
+	return b.IBackend.HSet(ctx, key, field, value)
+}
+
+func (b *transformBackend) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	ret, err := b.IBackend.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	b.decodeValues(keys, ret)
+	return ret, nil
+}
+
+func (b *transformBackend) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	ret, err := b.IBackend.HMGet(ctx, key, fields...)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, fieldKey(key, field))
+	}
+	b.decodeValues(keys, ret)
+	return ret, nil
+}
+
+func (b *transformBackend) LeaseSet(
+	ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (bool, error) {
+	value, err := b.encode(key, value)
+	if err != nil {
+		return false, err
+	}
+	return b.IBackend.LeaseSet(ctx, leaseKey, token, key, value, expTime)
+}
+
+func (b *transformBackend) LeaseHSet(
+	ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (bool, error) {
+	value, err := b.encode(fieldKey(key, field), value)
+	if err != nil {
+		return false, err
+	}
+	return b.IBackend.LeaseHSet(ctx, leaseKey, token, key, field, value, expTime)
+}
+
+func (b *transformBackend) Pipeline(ctx context.Context) IPipeline {
+	return &transformPipeline{IPipeline: b.IBackend.Pipeline(ctx), b: b}
+}
+
+// transformPipeline 管道中的命令无法直接返回错误, Encode失败时记录第一个错误, Exec时返回且不再执行管道中的命令
+type transformPipeline struct {
+	IPipeline
+	b   *transformBackend
+	err error
+}
+
+func (p *transformPipeline) Set(key, value string, expTime time.Duration) {
+	value, err := p.b.encode(key, value)
+	if err != nil {
+		p.setErr(err)
+		return
+	}
+	p.IPipeline.Set(key, value, expTime)
+}
+
+func (p *transformPipeline) HSet(key, field, value string) {
+	value, err := p.b.encode(fieldKey(key, field), value)
+	if err != nil {
+		p.setErr(err)
+		return
+	}
+	p.IPipeline.HSet(key, field, value)
+}
+
+func (p *transformPipeline) HMSet(key string, fields map[string]interface{}) {
+	encoded := make(map[string]interface{}, len(fields))
+	for field, v := range fields {
+		s, ok := v.(string)
+		if !ok {
+			encoded[field] = v
+			continue
+		}
+		s, err := p.b.encode(fieldKey(key, field), s)
+		if err != nil {
+			p.setErr(err)
+			return
+		}
+		encoded[field] = s
+	}
+	p.IPipeline.HMSet(key, encoded)
+}
+
+func (p *transformPipeline) Exec() error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.IPipeline.Exec()
+}
+
+func (p *transformPipeline) setErr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
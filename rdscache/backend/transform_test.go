@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/glycerine/goconvey/convey"
+)
+
+// prefixTransformer 测试用转换, 写入时添加前缀, 读取时去掉前缀
+type prefixTransformer struct {
+	prefix string
+}
+
+func (t *prefixTransformer) Encode(key, value string) (string, error) {
+	if value == "fail" {
+		return "", errors.New("encode fail")
+	}
+	return t.prefix + value, nil
+}
+
+func (t *prefixTransformer) Decode(key, value string) (string, error) {
+	if !strings.HasPrefix(value, t.prefix) {
+		return "", errors.New("decode fail")
+	}
+	return strings.TrimPrefix(value, t.prefix), nil
+}
+
+// keyTransformer 测试用转换, 写入时记录存储值所在的位置, 读取时校验位置一致
+type keyTransformer struct{}
+
+func (t *keyTransformer) Encode(key, value string) (string, error) {
+	return key + "|" + value, nil
+}
+
+func (t *keyTransformer) Decode(key, value string) (string, error) {
+	if !strings.HasPrefix(value, key+"|") {
+		return "", errors.New("key mismatch")
+	}
+	return strings.TrimPrefix(value, key+"|"), nil
+}
+
+func Test_transformBackend(t *testing.T) {
+	Convey("存储值转换", t, func() {
+		mem := NewMemoryBackend()
+		store := NewTransformBackend(mem, &prefixTransformer{prefix: "a:"}, &prefixTransformer{prefix: "b:"})
+
+		Convey("写入时按顺序转换, 读取时逆序还原", func() {
+			So(store.Set(ctx, rk, "v", 0), ShouldBeNil)
+			raw, _ := mem.Get(ctx, rk)
+			So(raw, ShouldEqual, "b:a:v")
+			v, err := store.Get(ctx, rk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+
+			So(store.HSet(ctx, rk2, sk, "v"), ShouldBeNil)
+			raw, _ = mem.HGet(ctx, rk2, sk)
+			So(raw, ShouldEqual, "b:a:v")
+			v, err = store.HGet(ctx, rk2, sk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "v")
+		})
+
+		Convey("批量获取时还原失败的值视为不存在", func() {
+			_ = store.Set(ctx, rk, "v", 0)
+			_ = mem.Set(ctx, rk2, "dirty", 0)
+			ret, err := store.MGet(ctx, rk, rk2, "notExist")
+			So(err, ShouldBeNil)
+			So(ret[0], ShouldEqual, "v")
+			So(ret[1], ShouldBeNil)
+			So(ret[2], ShouldBeNil)
+
+			_, err = store.Get(ctx, rk2)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("转换时传入存储值所在的位置, hash类型包含field", func() {
+			mem := NewMemoryBackend()
+			store := NewTransformBackend(mem, &keyTransformer{})
+			So(store.HSet(ctx, rk2, sk, "v"), ShouldBeNil)
+			raw, _ := mem.HGet(ctx, rk2, sk)
+			So(raw, ShouldEqual, rk2+"\x00"+sk+"|v")
+			ret, _ := store.HMGet(ctx, rk2, sk)
+			So(ret[0], ShouldEqual, "v")
+
+			// 存储值被复制到其它key下
+			_ = mem.Set(ctx, rk, raw, 0)
+			_, err := store.Get(ctx, rk)
+			So(err, ShouldNotBeNil)
+			ret, _ = store.MGet(ctx, rk)
+			So(ret[0], ShouldBeNil)
+		})
+
+		Convey("管道写入", func() {
+			p := store.Pipeline(ctx)
+			p.Set(rk, "v", time.Second)
+			p.HMSet(rk2, map[string]interface{}{sk: "v"})
+			So(p.Exec(), ShouldBeNil)
+			ret, _ := store.HMGet(ctx, rk2, sk)
+			So(ret[0], ShouldEqual, "v")
+			raw, _ := mem.Get(ctx, rk)
+			So(raw, ShouldEqual, "b:a:v")
+
+			// 转换失败时管道中的命令均不执行
+			mem.Flush()
+			p = store.Pipeline(ctx)
+			p.Set(rk, "v", time.Second)
+			p.Set(rk2, "fail", time.Second)
+			So(p.Exec(), ShouldNotBeNil)
+			_, err := mem.Get(ctx, rk)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
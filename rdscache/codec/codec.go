@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/693490554/sponge/rdscache"
+	json "github.com/json-iterator/go"
+	"github.com/vmihailenko/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// ICodec 序列化方式抽象, 缓存中存储的是序列化后的结果
+// 二进制序列化方式(msgpack/gob/protobuf)的结果同样以string的形式存储
+type ICodec interface {
+	Marshal(v interface{}) (string, error)
+	// Unmarshal 反序列化, v需传入非nil指针
+	Unmarshal(data string, v interface{}) error
+}
+
+// jsonCodec json序列化, 组件默认的序列化方式
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) (string, error) {
+	return json.MarshalToString(v)
+}
+
+func (jsonCodec) Unmarshal(data string, v interface{}) error {
+	return json.UnmarshalFromString(data, v)
+}
+
+func NewJSONCodec() ICodec {
+	return jsonCodec{}
+}
+
+// msgpackCodec msgpack序列化, 相比json体积更小, 编解码更快, 且可以和其它语言的服务共享缓存
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) (string, error) {
+	b, err := msgpack.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (msgpackCodec) Unmarshal(data string, v interface{}) error {
+	return msgpack.Unmarshal([]byte(data), v)
+}
+
+func NewMsgpackCodec() ICodec {
+	return msgpackCodec{}
+}
+
+// gobCodec gob序列化, 仅适用于go服务之间共享缓存, 不支持序列化nil
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (gobCodec) Unmarshal(data string, v interface{}) error {
+	return gob.NewDecoder(bytes.NewBufferString(data)).Decode(v)
+}
+
+func NewGobCodec() ICodec {
+	return gobCodec{}
+}
+
+// protoCodec protobuf序列化, 序列化及反序列化的数据均需实现proto.Message, 否则返回ErrNotProtoMessage
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) (string, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return "", rdscache.ErrNotProtoMessage
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (protoCodec) Unmarshal(data string, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return rdscache.ErrNotProtoMessage
+	}
+	return proto.Unmarshal([]byte(data), m)
+}
+
+func NewProtoCodec() ICodec {
+	return protoCodec{}
+}
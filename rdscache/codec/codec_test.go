@@ -0,0 +1,52 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testS struct {
+	A int    `json:"a" msgpack:"a"`
+	B string `json:"b" msgpack:"b"`
+}
+
+func TestCodec(t *testing.T) {
+	Convey("序列化及反序列化", t, func() {
+		src := &testS{A: 1, B: "test"}
+
+		Convey("json/msgpack/gob", func() {
+			for _, c := range []ICodec{NewJSONCodec(), NewMsgpackCodec(), NewGobCodec()} {
+				s, err := c.Marshal(src)
+				So(err, ShouldBeNil)
+				So(s, ShouldNotEqual, "")
+
+				dst := &testS{}
+				So(c.Unmarshal(s, dst), ShouldBeNil)
+				So(*dst, ShouldResemble, *src)
+			}
+		})
+
+		Convey("json序列化结果", func() {
+			s, _ := NewJSONCodec().Marshal(src)
+			So(s, ShouldEqual, `{"a":1,"b":"test"}`)
+		})
+
+		Convey("protobuf", func() {
+			c := NewProtoCodec()
+			s, err := c.Marshal(wrapperspb.String("test"))
+			So(err, ShouldBeNil)
+
+			dst := &wrapperspb.StringValue{}
+			So(c.Unmarshal(s, dst), ShouldBeNil)
+			So(dst.GetValue(), ShouldEqual, "test")
+
+			// 非proto.Message
+			_, err = c.Marshal(src)
+			So(err, ShouldEqual, rdscache.ErrNotProtoMessage)
+			So(c.Unmarshal(s, src), ShouldEqual, rdscache.ErrNotProtoMessage)
+		})
+	})
+}
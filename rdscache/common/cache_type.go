@@ -1,9 +1,15 @@
 package common
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 var CacheEmptyValue = "" // 空缓存值
 
+// tagKeyPrefix 标签集合的key前缀, 集合中记录了打上该标签的全部缓存的FullKey
+const tagKeyPrefix = "sponge:tag:"
+
 type ICacheInfo interface {
 	BaseInfo() CacheBase
 	UpdateCacheKey(key string)
@@ -12,6 +18,27 @@ type ICacheInfo interface {
 type CacheBase struct {
 	Key     string        // 缓存的Key
 	ExpTime time.Duration // key的过期时间
+	Jitter  IJitter       // 过期时间抖动策略, 优先级高于服务级别的抖动策略, 为nil时使用服务级别的抖动策略
+	// Tags 缓存的标签, 写入时在redis中记录标签和缓存的关系, 可通过InvalidateTags删除打上了标签的全部缓存
+	Tags []string
+}
+
+// JitterExpTime 获取写入缓存时实际使用的过期时间, 未指定抖动策略时使用defaultJitter, 均为nil时不抖动
+func (c CacheBase) JitterExpTime(defaultJitter IJitter) time.Duration {
+	jitter := c.Jitter
+	if jitter == nil {
+		jitter = defaultJitter
+	}
+	if jitter == nil {
+		return c.ExpTime
+	}
+	return jitter.Apply(c.ExpTime)
+}
+
+// NoDataExpTime 获取缓存数据不存在时实际使用的过期时间, 使用noDataTTL替代缓存信息中的过期时间, 同样按抖动策略抖动
+func (c CacheBase) NoDataExpTime(noDataTTL time.Duration, defaultJitter IJitter) time.Duration {
+	c.ExpTime = noDataTTL
+	return c.JitterExpTime(defaultJitter)
 }
 
 func NewCacheBase(key string, exp time.Duration) *CacheBase {
@@ -81,3 +108,39 @@ func NewMSetModel(key, value string, expTime time.Duration) *MSetModel {
 		Value:       value,
 	}
 }
+
+// CopyCacheInfo 拷贝缓存信息, 后台任务使用拷贝, 使用分片方案时修改缓存key不影响调用方的缓存信息
+func CopyCacheInfo(cacheInfo ICacheInfo) ICacheInfo {
+	switch c := cacheInfo.(type) {
+	case *StringCache:
+		cp := *c
+		return &cp
+	case *HashCache:
+		cp := *c
+		return &cp
+	default:
+		return cacheInfo
+	}
+}
+
+// FullKey 缓存的完整key, hash类型的缓存包含subKey, 可用于按缓存合并请求等场景
+func FullKey(cacheInfo ICacheInfo) string {
+	if c, ok := cacheInfo.(*HashCache); ok {
+		// subKey可能包含任意字符, 以\x00分隔防止和string类型的key冲突
+		return c.Key + "\x00" + c.SubKey
+	}
+	return cacheInfo.BaseInfo().Key
+}
+
+// ParseFullKey 解析FullKey, 返回的缓存信息只包含key(hash类型包含subKey), 可用于删除缓存
+func ParseFullKey(fullKey string) ICacheInfo {
+	if idx := strings.IndexByte(fullKey, '\x00'); idx >= 0 {
+		return &HashCache{CacheBase: CacheBase{Key: fullKey[:idx]}, SubKey: fullKey[idx+1:]}
+	}
+	return &StringCache{CacheBase: CacheBase{Key: fullKey}}
+}
+
+// TagKey 标签集合在redis中的key
+func TagKey(tag string) string {
+	return tagKeyPrefix + tag
+}
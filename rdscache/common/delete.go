@@ -0,0 +1,56 @@
+package common
+
+import (
+	"errors"
+
+	"github.com/693490554/sponge/rdscache/backend"
+)
+
+// DeleteEntry 批量删除时的单个缓存, HotKeyOption不为nil时同时删除当前实例的本地缓存及全部分片
+type DeleteEntry struct {
+	CacheInfo    ICacheInfo
+	HotKeyOption *HotKeyOption
+}
+
+// NewDeleteEntry 创建批量删除的单个缓存, hotKeyOption可为nil
+func NewDeleteEntry(cacheInfo ICacheInfo, hotKeyOption *HotKeyOption) *DeleteEntry {
+	return &DeleteEntry{CacheInfo: cacheInfo, HotKeyOption: hotKeyOption}
+}
+
+// DelKeys 缓存在redis中的全部副本(原始key及全部分片)
+// 热key使用本地缓存时同时删除当前实例的本地缓存, 并返回本地缓存的key用于通知其它实例
+// 使用了分片方案但未注册WithAllShardingKeys时返回ErrShardingKeysUnknown
+func DelKeys(cacheInfo ICacheInfo, hotKeyOption *HotKeyOption) (keys []string, localKey string, err error) {
+	keys = []string{cacheInfo.BaseInfo().Key}
+	if hotKeyOption == nil {
+		return keys, "", nil
+	}
+	// 热key的判断可能是动态的, 无论当前是否是热key均需删除
+	shardingKeys, err := hotKeyOption.AllShardingKeys()
+	if err != nil {
+		return nil, "", err
+	}
+	keys = append(keys, shardingKeys...)
+	if hotKeyOption.UseLocalCache() {
+		if err = hotKeyOption.DelFromLocalCache(); err != nil {
+			return nil, "", err
+		}
+		localKey = hotKeyOption.LocalCacheKey()
+	}
+	return keys, localKey, nil
+}
+
+// DelFromPipeline 在管道中删除keys对应的缓存, hash类型删除keys中subKey对应的field
+func DelFromPipeline(p backend.IPipeline, cacheInfo ICacheInfo, keys ...string) error {
+	switch cacheInfo := cacheInfo.(type) {
+	case *StringCache:
+		p.Del(keys...)
+	case *HashCache:
+		for _, key := range keys {
+			p.HDel(key, cacheInfo.SubKey)
+		}
+	default:
+		return errors.New("unknown KT")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+)
+
+const (
+	// envelopeFlag 信封格式存储值的前缀, 和压缩、加密一样以\x00开头, 不会和历史的原始存储值冲突
+	envelopeFlag = "\x00v"
+
+	EnvelopeVersion uint8 = 2 // 当前的信封格式版本
+
+	EnvelopeFlagNoData uint8 = 1 << 0 // 缓存的是数据不存在(预防缓存穿透), 而不是真实数据
+)
+
+// envelopeHeaderLens 各版本信封的头部长度
+// v1: 前缀 + 版本(1字节) + 标志位(1字节) + 创建时间(8字节, unix毫秒)
+// v2: v1 + 回源耗时(4字节, 毫秒) + 过期时间(8字节, unix毫秒, 0代表不过期)
+var envelopeHeaderLens = map[uint8]int{
+	1: len(envelopeFlag) + 1 + 1 + 8,
+	2: len(envelopeFlag) + 1 + 1 + 8 + 4 + 8,
+}
+
+// Envelope 存储值信封, 在真实数据之外记录了格式版本、标志位、创建时间、回源耗时及过期时间
+// 解决空缓存(CacheEmptyValue)和序列化结果恰好为空字符串的真实数据无法区分的问题
+type Envelope struct {
+	Version   uint8 // 格式版本, 0代表历史的原始存储值(非信封格式)
+	Flags     uint8
+	CreatedAt time.Time     // 写入缓存的时间, 原始存储值为零值
+	Delta     time.Duration // 回源耗时, 用于提前刷新, v2及以上版本记录
+	ExpireAt  time.Time     // 缓存的过期时间, 零值代表不过期或未记录, v2及以上版本记录
+	Value     string        // 缓存的真实数据, 数据不存在时为CacheEmptyValue
+}
+
+// NewEnvelope 创建当前版本的信封, noData代表缓存的是数据不存在
+func NewEnvelope(value string, noData bool) *Envelope {
+	e := &Envelope{Version: EnvelopeVersion, CreatedAt: time.Now(), Value: value}
+	if noData {
+		e.Flags |= EnvelopeFlagNoData
+		e.Value = CacheEmptyValue
+	}
+	return e
+}
+
+// NoData 是否缓存的是数据不存在
+func (e *Envelope) NoData() bool {
+	return e.Flags&EnvelopeFlagNoData != 0
+}
+
+// IsRaw 是否是历史的原始存储值
+func (e *Envelope) IsRaw() bool {
+	return e.Version == 0
+}
+
+// ShouldRefreshEarly 按XFetch算法判断是否需要提前刷新: now - delta * beta * ln(rand) >= expireAt
+// 回源越慢、越接近过期, 提前刷新的概率越大; beta越大越倾向于提前刷新, 一般取1
+// 未记录回源耗时或过期时间(原始存储值、v1信封、不过期的缓存)时不提前刷新
+func (e *Envelope) ShouldRefreshEarly(beta float64) bool {
+	if beta <= 0 || e.Delta <= 0 || e.ExpireAt.IsZero() {
+		return false
+	}
+	// 1-rand.Float64()取值为(0, 1], 防止ln(0)
+	gap := time.Duration(-float64(e.Delta) * beta * math.Log(1-rand.Float64()))
+	return !time.Now().Add(gap).Before(e.ExpireAt)
+}
+
+// Expired 是否已超过记录的过期时间, 未记录过期时间时始终未过期
+// hash类型无法单独指定field的过期时间, 数据不存在的field单独指定的过期时间依赖信封判断
+func (e *Envelope) Expired() bool {
+	return !e.ExpireAt.IsZero() && !time.Now().Before(e.ExpireAt)
+}
+
+// SoftExpired 写入缓存后是否已超过软过期时间softTTL, 原始存储值未记录创建时间, 始终视为未过期
+func (e *Envelope) SoftExpired(softTTL time.Duration) bool {
+	if softTTL <= 0 || e.IsRaw() {
+		return false
+	}
+	return time.Since(e.CreatedAt) >= softTTL
+}
+
+// Encode 编码为当前版本的存储值
+func (e *Envelope) Encode() string {
+	headerLen := envelopeHeaderLens[EnvelopeVersion]
+	buf := make([]byte, headerLen, headerLen+len(e.Value))
+	offset := copy(buf, envelopeFlag)
+	buf[offset] = EnvelopeVersion
+	buf[offset+1] = e.Flags
+	binary.BigEndian.PutUint64(buf[offset+2:], uint64(toUnixMs(e.CreatedAt)))
+	binary.BigEndian.PutUint32(buf[offset+10:], uint32(e.Delta/time.Millisecond))
+	binary.BigEndian.PutUint64(buf[offset+14:], uint64(toUnixMs(e.ExpireAt)))
+	return string(append(buf, e.Value...))
+}
+
+// DecodeEnvelope 解析存储值, 兼容历史的原始存储值: 原始值为CacheEmptyValue代表数据不存在, 其余均为真实数据
+// 信封格式不正确或版本高于当前支持的版本时返回ErrEnvelopeInvalid
+func DecodeEnvelope(raw string) (*Envelope, error) {
+	if !strings.HasPrefix(raw, envelopeFlag) {
+		e := &Envelope{Value: raw}
+		if raw == CacheEmptyValue {
+			e.Flags |= EnvelopeFlagNoData
+		}
+		return e, nil
+	}
+
+	offset := len(envelopeFlag)
+	if len(raw) <= offset {
+		return nil, rdscache.ErrEnvelopeInvalid
+	}
+	version := raw[offset]
+	headerLen, ok := envelopeHeaderLens[version]
+	if !ok || len(raw) < headerLen {
+		return nil, rdscache.ErrEnvelopeInvalid
+	}
+
+	header := []byte(raw[:headerLen])
+	e := &Envelope{
+		Version:   version,
+		Flags:     header[offset+1],
+		CreatedAt: fromUnixMs(int64(binary.BigEndian.Uint64(header[offset+2:]))),
+		Value:     raw[headerLen:],
+	}
+	if version >= 2 {
+		e.Delta = time.Duration(binary.BigEndian.Uint32(header[offset+10:])) * time.Millisecond
+		if ms := int64(binary.BigEndian.Uint64(header[offset+14:])); ms > 0 {
+			e.ExpireAt = fromUnixMs(ms)
+		}
+	}
+	return e, nil
+}
+
+func toUnixMs(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromUnixMs(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestEnvelope(t *testing.T) {
+	Convey("存储值信封", t, func() {
+
+		Convey("编码及解析, 区分空缓存和空字符串", func() {
+			for _, noData := range []bool{true, false} {
+				raw := NewEnvelope(CacheEmptyValue, noData).Encode()
+				So(raw, ShouldNotEqual, CacheEmptyValue)
+
+				e, err := DecodeEnvelope(raw)
+				So(err, ShouldBeNil)
+				So(e.IsRaw(), ShouldBeFalse)
+				So(e.Version, ShouldEqual, EnvelopeVersion)
+				So(e.NoData(), ShouldEqual, noData)
+				So(e.Value, ShouldEqual, "")
+				So(time.Since(e.CreatedAt), ShouldBeLessThan, time.Second)
+			}
+
+			e, err := DecodeEnvelope(NewEnvelope(`{"a":1}`, false).Encode())
+			So(err, ShouldBeNil)
+			So(e.Value, ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("兼容历史的原始存储值", func() {
+			e, err := DecodeEnvelope(CacheEmptyValue)
+			So(err, ShouldBeNil)
+			So(e.IsRaw(), ShouldBeTrue)
+			So(e.NoData(), ShouldBeTrue)
+
+			e, err = DecodeEnvelope(`{"a":1}`)
+			So(err, ShouldBeNil)
+			So(e.IsRaw(), ShouldBeTrue)
+			So(e.NoData(), ShouldBeFalse)
+			So(e.Value, ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("兼容v1版本的信封", func() {
+			ms := time.Now().UnixNano() / int64(time.Millisecond)
+			header := []byte(envelopeFlag + "\x01\x01")
+			header = append(header, make([]byte, 8)...)
+			binary.BigEndian.PutUint64(header[len(envelopeFlag)+2:], uint64(ms))
+			e, err := DecodeEnvelope(string(header) + "v")
+			So(err, ShouldBeNil)
+			So(e.Version, ShouldEqual, 1)
+			So(e.NoData(), ShouldBeTrue)
+			So(e.CreatedAt.UnixNano()/int64(time.Millisecond), ShouldEqual, ms)
+			So(e.Value, ShouldEqual, "v")
+			So(e.ShouldRefreshEarly(1), ShouldBeFalse)
+		})
+
+		Convey("记录回源耗时及过期时间, 按XFetch算法提前刷新", func() {
+			e := NewEnvelope("v", false)
+			e.Delta = time.Second
+			e.ExpireAt = time.Now().Add(time.Hour)
+			decoded, err := DecodeEnvelope(e.Encode())
+			So(err, ShouldBeNil)
+			So(decoded.Delta, ShouldEqual, time.Second)
+			So(decoded.ExpireAt.Sub(e.ExpireAt), ShouldBeLessThan, time.Millisecond)
+
+			// 距离过期还很久, 不会提前刷新
+			So(decoded.ShouldRefreshEarly(1), ShouldBeFalse)
+
+			// 已经过期, 一定提前刷新
+			decoded.ExpireAt = time.Now()
+			So(decoded.ShouldRefreshEarly(1), ShouldBeTrue)
+
+			// 接近过期时部分请求提前刷新
+			decoded.ExpireAt = time.Now().Add(time.Second)
+			refreshCnt := 0
+			for i := 0; i < 1000; i++ {
+				if decoded.ShouldRefreshEarly(1) {
+					refreshCnt++
+				}
+			}
+			So(refreshCnt, ShouldBeGreaterThan, 0)
+			So(refreshCnt, ShouldBeLessThan, 1000)
+
+			// 未记录过期时间(不过期)
+			decoded.ExpireAt = time.Time{}
+			So(decoded.ShouldRefreshEarly(1), ShouldBeFalse)
+		})
+
+		Convey("超过记录的过期时间", func() {
+			e := NewEnvelope("", true)
+			So(e.Expired(), ShouldBeFalse)
+			e.ExpireAt = time.Now().Add(time.Minute)
+			So(e.Expired(), ShouldBeFalse)
+			e.ExpireAt = time.Now()
+			So(e.Expired(), ShouldBeTrue)
+		})
+
+		Convey("软过期", func() {
+			e := NewEnvelope("v", false)
+			So(e.SoftExpired(time.Hour), ShouldBeFalse)
+			So(e.SoftExpired(0), ShouldBeFalse)
+
+			e.CreatedAt = time.Now().Add(-time.Hour)
+			decoded, err := DecodeEnvelope(e.Encode())
+			So(err, ShouldBeNil)
+			So(decoded.SoftExpired(time.Minute), ShouldBeTrue)
+
+			// 原始存储值未记录创建时间
+			raw, _ := DecodeEnvelope("v")
+			So(raw.SoftExpired(time.Nanosecond), ShouldBeFalse)
+		})
+
+		Convey("格式不正确或版本不支持", func() {
+			raw := NewEnvelope("v", false).Encode()
+			_, err := DecodeEnvelope(raw[:envelopeHeaderLens[EnvelopeVersion]-1])
+			So(err, ShouldEqual, rdscache.ErrEnvelopeInvalid)
+
+			newer := []byte(raw)
+			newer[len(envelopeFlag)] = EnvelopeVersion + 1
+			_, err = DecodeEnvelope(string(newer))
+			So(err, ShouldEqual, rdscache.ErrEnvelopeInvalid)
+		})
+	})
+}
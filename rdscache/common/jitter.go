@@ -0,0 +1,48 @@
+package common
+
+import (
+	"math/rand"
+	"time"
+)
+
+// IJitter 过期时间抖动策略, 在过期时间的基础上增加随机时长, 防止同一批写入的缓存同时过期导致缓存雪崩
+type IJitter interface {
+	// Apply 返回增加随机时长后的过期时间, expTime <= 0(不过期)时需原样返回
+	Apply(expTime time.Duration) time.Duration
+}
+
+type percentJitter struct {
+	percent float64
+}
+
+func (j *percentJitter) Apply(expTime time.Duration) time.Duration {
+	n := int64(float64(expTime) * j.percent)
+	if expTime <= 0 || n <= 0 {
+		return expTime
+	}
+	return expTime + time.Duration(rand.Int63n(n))
+}
+
+// NewPercentJitter 按比例抖动, 在过期时间的基础上随机增加[0, expTime*percent), 例如percent=0.1代表最多增加10%
+func NewPercentJitter(percent float64) IJitter {
+	return &percentJitter{percent: percent}
+}
+
+type rangeJitter struct {
+	min, max time.Duration
+}
+
+func (j *rangeJitter) Apply(expTime time.Duration) time.Duration {
+	if expTime <= 0 {
+		return expTime
+	}
+	if j.max <= j.min {
+		return expTime + j.min
+	}
+	return expTime + j.min + time.Duration(rand.Int63n(int64(j.max-j.min)))
+}
+
+// NewRangeJitter 按固定范围抖动, 在过期时间的基础上随机增加[min, max)
+func NewRangeJitter(min, max time.Duration) IJitter {
+	return &rangeJitter{min: min, max: max}
+}
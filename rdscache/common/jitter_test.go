@@ -0,0 +1,63 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/glycerine/goconvey/convey"
+)
+
+// recordLocalCache 记录写入时的过期时间
+type recordLocalCache struct {
+	expTime time.Duration
+}
+
+func (c *recordLocalCache) Get(key string) (string, error) { return "", nil }
+
+func (c *recordLocalCache) Set(cacheInfo *CacheBase, value string) error {
+	c.expTime = cacheInfo.ExpTime
+	return nil
+}
+
+func (c *recordLocalCache) Del(key string) error { return nil }
+
+func TestJitter(t *testing.T) {
+	Convey("过期时间抖动", t, func() {
+
+		Convey("按比例及固定范围抖动", func() {
+			for i := 0; i < 100; i++ {
+				exp := NewPercentJitter(0.1).Apply(time.Second * 10)
+				So(exp, ShouldBeGreaterThanOrEqualTo, time.Second*10)
+				So(exp, ShouldBeLessThan, time.Second*11)
+
+				exp = NewRangeJitter(time.Second, time.Second*2).Apply(time.Second * 10)
+				So(exp, ShouldBeGreaterThanOrEqualTo, time.Second*11)
+				So(exp, ShouldBeLessThan, time.Second*12)
+			}
+			So(NewRangeJitter(time.Second, time.Second).Apply(time.Second), ShouldEqual, time.Second*2)
+		})
+
+		Convey("不过期的缓存不抖动", func() {
+			So(NewPercentJitter(0.1).Apply(0), ShouldEqual, 0)
+			So(NewRangeJitter(time.Second, time.Second*2).Apply(0), ShouldEqual, 0)
+		})
+
+		Convey("缓存信息中的抖动策略优先", func() {
+			base := NewCacheBase(ck, time.Second*10)
+			So(base.JitterExpTime(nil), ShouldEqual, time.Second*10)
+			So(base.JitterExpTime(NewRangeJitter(time.Second, time.Second)), ShouldEqual, time.Second*11)
+
+			base.Jitter = NewRangeJitter(time.Second*5, time.Second*5)
+			So(base.JitterExpTime(NewRangeJitter(time.Second, time.Second)), ShouldEqual, time.Second*15)
+		})
+
+		Convey("本地缓存的过期时间同样抖动", func() {
+			localCache := &recordLocalCache{}
+			option, _ := NewHotKeyOption(WithLocalCache(localCache, NewCacheBase(ck, time.Second*10)))
+			So(option.SetToLocalCacheWithJitter("v", NewRangeJitter(time.Second, time.Second)), ShouldBeNil)
+			So(localCache.expTime, ShouldEqual, time.Second*11)
+			So(option.SetToLocalCache("v"), ShouldBeNil)
+			So(localCache.expTime, ShouldEqual, time.Second*10)
+		})
+	})
+}
@@ -0,0 +1,350 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/693490554/sponge/rdscache"
+)
+
+const defaultKeySeparator = ":"
+
+// globalKeySpace 全局的key空间, 未指定key空间的模板在生成key时使用
+var globalKeySpace atomic.Value
+
+func init() {
+	globalKeySpace.Store(&KeySpace{separator: defaultKeySeparator})
+}
+
+// SetGlobalKeySpace 设置全局的key空间(例如环境及应用名), 一般在服务启动时设置
+// 未指定key空间的模板在生成key时才获取全局的key空间, 包级别变量声明的模板同样生效
+func SetGlobalKeySpace(space *KeySpace) {
+	if space != nil {
+		globalKeySpace.Store(space)
+	}
+}
+
+// GlobalKeySpace 获取全局的key空间
+func GlobalKeySpace() *KeySpace {
+	return globalKeySpace.Load().(*KeySpace)
+}
+
+// KeySpace key空间, 生成的key为: 环境 分隔符 前缀(可多级) 分隔符 模板生成的key, 为空的部分省略
+// 不同团队或服务使用不同的前缀, 防止key冲突; 环境、前缀及分隔符中不可包含{}, 防止集群模式下改变key的hash tag
+// 实现了backend.IKeyPrefix, 可通过服务的WithSvcKeySpace为服务读写的所有key加上前缀
+type KeySpace struct {
+	env       string
+	prefixes  []string
+	separator string
+}
+
+// NewKeySpace 创建key空间, prefix为空代表不加前缀; 环境、前缀或分隔符中包含{}时返回ErrKeySpaceInvalid
+func NewKeySpace(prefix string, opts ...KeySpaceOptionWrap) (*KeySpace, error) {
+	s := &KeySpace{separator: defaultKeySeparator}
+	if prefix != "" {
+		s.prefixes = []string{prefix}
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if hasHashTag(s.env) || hasHashTag(s.separator) || hasHashTag(prefix) {
+		return nil, rdscache.ErrKeySpaceInvalid
+	}
+	return s, nil
+}
+
+// MustKeySpace 同NewKeySpace, 包含{}时panic, 可用于包级别变量声明
+func MustKeySpace(prefix string, opts ...KeySpaceOptionWrap) *KeySpace {
+	s, err := NewKeySpace(prefix, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+type KeySpaceOptionWrap func(s *KeySpace)
+
+// WithKeyEnv 指定环境, 不同环境共用同一个redis时防止key冲突; 环境中包含{}时NewKeySpace返回错误
+func WithKeyEnv(env string) KeySpaceOptionWrap {
+	return func(s *KeySpace) {
+		s.env = env
+	}
+}
+
+// WithKeySeparator 指定分隔符, 默认为:
+func WithKeySeparator(separator string) KeySpaceOptionWrap {
+	return func(s *KeySpace) {
+		if separator != "" {
+			s.separator = separator
+		}
+	}
+}
+
+// Sub 创建下一级的key空间, 继承环境、前缀及分隔符, 可用于在全局的key空间下为服务或团队划分前缀
+// 前缀中包含{}时返回ErrKeySpaceInvalid
+func (s *KeySpace) Sub(prefix string) (*KeySpace, error) {
+	if hasHashTag(prefix) {
+		return nil, rdscache.ErrKeySpaceInvalid
+	}
+	sub := &KeySpace{env: s.env, separator: s.separator}
+	sub.prefixes = append(sub.prefixes, s.prefixes...)
+	if prefix != "" {
+		sub.prefixes = append(sub.prefixes, prefix)
+	}
+	return sub, nil
+}
+
+// MustSub 同Sub, 前缀中包含{}时panic
+func (s *KeySpace) MustSub(prefix string) *KeySpace {
+	sub, err := s.Sub(prefix)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Prefix key空间中的key前缀: 环境 分隔符 前缀(可多级) 分隔符, 未指定环境及前缀时为空
+func (s *KeySpace) Prefix(ctx context.Context) (string, error) {
+	if s.env == "" && len(s.prefixes) == 0 {
+		return "", nil
+	}
+	return s.join(""), nil
+}
+
+// NewKeyTemplate 在该key空间中创建key模板
+func (s *KeySpace) NewKeyTemplate(pattern string, expTime time.Duration, opts ...KeyTemplateOptionWrap) (*KeyTemplate, error) {
+	t, err := newKeyTemplate(pattern, expTime, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.space = s
+	return t, nil
+}
+
+// MustKeyTemplate 同NewKeyTemplate, 模板格式不正确时panic, 可用于包级别变量声明
+func (s *KeySpace) MustKeyTemplate(pattern string, expTime time.Duration, opts ...KeyTemplateOptionWrap) *KeyTemplate {
+	t, err := s.NewKeyTemplate(pattern, expTime, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// join 拼接环境、前缀及模板生成的key
+func (s *KeySpace) join(key string) string {
+	parts := make([]string, 0, len(s.prefixes)+2)
+	if s.env != "" {
+		parts = append(parts, s.env)
+	}
+	parts = append(parts, s.prefixes...)
+	return strings.Join(append(parts, key), s.separator)
+}
+
+func hasHashTag(s string) bool {
+	return strings.ContainsAny(s, "{}")
+}
+
+// KeyTemplate key模板, 例如user:{id}:profile, {}中为参数名, 生成key时按参数在模板中出现的顺序传入参数
+// 统一key的格式及默认的过期时间, 替代各处通过fmt.Sprintf拼接key
+type KeyTemplate struct {
+	pattern    string
+	parts      []string // 模板中的固定部分, 比参数多一个
+	delimiters string   // 固定部分中字母、数字以外的字符, 参数中不可包含
+	params     []string
+	expTime    time.Duration
+	jitter     IJitter
+	space      *KeySpace // 为nil时使用全局的key空间
+}
+
+// NewKeyTemplate 创建使用全局key空间的key模板, 参数名只能包含字母、数字及下划线且不可重复
+// 相邻的参数之间需有字母、数字以外的分隔字符, 例如user_{a}_{b}, 否则无法区分两个参数的边界
+func NewKeyTemplate(pattern string, expTime time.Duration, opts ...KeyTemplateOptionWrap) (*KeyTemplate, error) {
+	return newKeyTemplate(pattern, expTime, opts...)
+}
+
+// MustKeyTemplate 同NewKeyTemplate, 模板格式不正确时panic, 可用于包级别变量声明
+func MustKeyTemplate(pattern string, expTime time.Duration, opts ...KeyTemplateOptionWrap) *KeyTemplate {
+	t, err := NewKeyTemplate(pattern, expTime, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+type KeyTemplateOptionWrap func(t *KeyTemplate)
+
+// WithKeyJitter 指定模板生成的缓存信息的过期时间抖动策略
+func WithKeyJitter(jitter IJitter) KeyTemplateOptionWrap {
+	return func(t *KeyTemplate) {
+		t.jitter = jitter
+	}
+}
+
+func newKeyTemplate(pattern string, expTime time.Duration, opts ...KeyTemplateOptionWrap) (*KeyTemplate, error) {
+	parts, params, err := parseKeyPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	t := &KeyTemplate{pattern: pattern, parts: parts, delimiters: keyDelimiters(parts), params: params, expTime: expTime}
+	for _, o := range opts {
+		o(t)
+	}
+	return t, nil
+}
+
+// parseKeyPattern 解析模板, 返回固定部分及参数名
+func parseKeyPattern(pattern string) ([]string, []string, error) {
+	if pattern == "" {
+		return nil, nil, rdscache.ErrKeyTemplateInvalid
+	}
+	var parts, params []string
+	seen := map[string]bool{}
+	rest := pattern
+	for {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			parts = append(parts, rest)
+			return parts, params, nil
+		}
+		if rest[start] == '}' {
+			return nil, nil, rdscache.ErrKeyTemplateInvalid
+		}
+		end := strings.IndexAny(rest[start+1:], "{}")
+		if end < 0 || rest[start+1+end] != '}' {
+			return nil, nil, rdscache.ErrKeyTemplateInvalid
+		}
+		name := rest[start+1 : start+1+end]
+		if !validParamName(name) || seen[name] {
+			return nil, nil, rdscache.ErrKeyTemplateInvalid
+		}
+		if len(params) > 0 && keyDelimiters([]string{rest[:start]}) == "" {
+			return nil, nil, rdscache.ErrKeyTemplateInvalid
+		}
+		seen[name] = true
+		parts = append(parts, rest[:start])
+		params = append(params, name)
+		rest = rest[start+end+2:]
+	}
+}
+
+// keyDelimiters 固定部分中字母、数字以外的字符(去重)
+func keyDelimiters(parts []string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		for _, c := range part {
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune(b.String(), c) {
+				b.WriteRune(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+func validParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Pattern 模板
+func (t *KeyTemplate) Pattern() string {
+	return t.pattern
+}
+
+// Params 模板中的参数名, 生成key时按该顺序传入参数
+func (t *KeyTemplate) Params() []string {
+	return append([]string(nil), t.params...)
+}
+
+// Key 生成完整的key, 参数数量需和模板中的一致
+// 参数支持字符串、整数及fmt.Stringer, 不可为空, 不可包含{}、key空间的分隔符及模板固定部分中字母、数字以外的字符
+// 例如模板user_{a}_{b}的参数中不可包含_, 防止不同参数(a_b, c与a, b_c)或不同模板生成相同的key
+func (t *KeyTemplate) Key(args ...interface{}) (string, error) {
+	if len(args) != len(t.params) {
+		return "", rdscache.ErrKeyParamInvalid
+	}
+	space := t.space
+	if space == nil {
+		space = GlobalKeySpace()
+	}
+
+	var b strings.Builder
+	for i, arg := range args {
+		v, ok := formatKeyParam(arg)
+		if !ok || v == "" || strings.Contains(v, space.separator) || strings.ContainsAny(v, t.delimiters) || hasHashTag(v) {
+			return "", rdscache.ErrKeyParamInvalid
+		}
+		b.WriteString(t.parts[i])
+		b.WriteString(v)
+	}
+	b.WriteString(t.parts[len(t.parts)-1])
+	return space.join(b.String()), nil
+}
+
+// StringCache 生成string类型的缓存信息, 使用模板的过期时间及抖动策略
+func (t *KeyTemplate) StringCache(args ...interface{}) (*StringCache, error) {
+	key, err := t.Key(args...)
+	if err != nil {
+		return nil, err
+	}
+	c := NewStringCache(key, t.expTime)
+	c.Jitter = t.jitter
+	return c, nil
+}
+
+// HashCache 生成hash类型的缓存信息, subKey为hash中的field, 使用模板的过期时间及抖动策略
+func (t *KeyTemplate) HashCache(subKey string, args ...interface{}) (*HashCache, error) {
+	if subKey == "" {
+		return nil, rdscache.ErrKeyParamInvalid
+	}
+	key, err := t.Key(args...)
+	if err != nil {
+		return nil, err
+	}
+	c := NewHashCache(key, subKey, t.expTime)
+	c.Jitter = t.jitter
+	return c, nil
+}
+
+// formatKeyParam 参数转换为字符串, 不支持的类型返回false
+func formatKeyParam(arg interface{}) (string, bool) {
+	switch v := arg.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.FormatInt(int64(v), 10), true
+	case int8:
+		return strconv.FormatInt(int64(v), 10), true
+	case int16:
+		return strconv.FormatInt(int64(v), 10), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case fmt.Stringer:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,108 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestKeyTemplate(t *testing.T) {
+	Convey("key模板", t, func() {
+
+		Convey("模板格式校验", func() {
+			for _, pattern := range []string{"", "user:{id", "user:id}", "user:{}", "user:{a-b}", "{id}:{id}", "{{id}}",
+				"user:{a}{b}", "user:{a}x{b}"} {
+				_, err := NewKeyTemplate(pattern, time.Second)
+				So(err, ShouldEqual, rdscache.ErrKeyTemplateInvalid)
+			}
+			tpl, err := NewKeyTemplate("user:{id}:order:{order_id}", time.Second)
+			So(err, ShouldBeNil)
+			So(tpl.Params(), ShouldResemble, []string{"id", "order_id"})
+			So(func() { MustKeyTemplate("user:{id", time.Second) }, ShouldPanic)
+		})
+
+		Convey("参数校验", func() {
+			tpl := MustKeyTemplate("user:{id}:profile", time.Second)
+			key, err := tpl.Key(uint64(1))
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, "user:1:profile")
+			key, _ = tpl.Key("a")
+			So(key, ShouldEqual, "user:a:profile")
+
+			for _, args := range [][]interface{}{{}, {1, 2}, {""}, {1.5}, {"a:b"}, {"{a}"}} {
+				_, err = tpl.Key(args...)
+				So(err, ShouldEqual, rdscache.ErrKeyParamInvalid)
+			}
+
+			// 参数中不可包含模板固定部分中的分隔字符, 防止a_b, c与a, b_c生成相同的key
+			tpl = MustKeyTemplate("user_{a}_{b}", time.Second)
+			key, err = tpl.Key("x", 1)
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, "user_x_1")
+			for _, args := range [][]interface{}{{"x_y", "z"}, {"x", "y_z"}} {
+				_, err = tpl.Key(args...)
+				So(err, ShouldEqual, rdscache.ErrKeyParamInvalid)
+			}
+		})
+
+		Convey("key空间: 环境、多级前缀及分隔符", func() {
+			space, err := NewKeySpace("app", WithKeyEnv("prod"))
+			So(err, ShouldBeNil)
+			tpl := space.MustSub("order").MustKeyTemplate("detail:{id}", time.Minute)
+			key, _ := tpl.Key(1)
+			So(key, ShouldEqual, "prod:app:order:detail:1")
+			prefix, _ := space.MustSub("order").Prefix(context.Background())
+			So(prefix, ShouldEqual, "prod:app:order:")
+			prefix, _ = MustKeySpace("").Prefix(context.Background())
+			So(prefix, ShouldEqual, "")
+
+			tpl = MustKeySpace("", WithKeySeparator("_")).MustKeyTemplate("detail_{id}", time.Minute)
+			key, _ = tpl.Key(1)
+			So(key, ShouldEqual, "detail_1")
+			_, err = tpl.Key("a_b")
+			So(err, ShouldEqual, rdscache.ErrKeyParamInvalid)
+		})
+
+		Convey("key空间的环境、前缀及分隔符中不可包含{}", func() {
+			for _, opts := range [][]KeySpaceOptionWrap{{WithKeyEnv("{prod}")}, {WithKeySeparator("}")}} {
+				_, err := NewKeySpace("app", opts...)
+				So(err, ShouldEqual, rdscache.ErrKeySpaceInvalid)
+			}
+			_, err := NewKeySpace("{app}")
+			So(err, ShouldEqual, rdscache.ErrKeySpaceInvalid)
+			_, err = MustKeySpace("app").Sub("a{b")
+			So(err, ShouldEqual, rdscache.ErrKeySpaceInvalid)
+			So(func() { MustKeySpace("{app}") }, ShouldPanic)
+		})
+
+		Convey("未指定key空间的模板在生成key时使用全局的key空间", func() {
+			tpl := MustKeyTemplate("user:{id}", time.Minute)
+			SetGlobalKeySpace(MustKeySpace("app", WithKeyEnv("test")))
+			defer SetGlobalKeySpace(MustKeySpace(""))
+			key, _ := tpl.Key(1)
+			So(key, ShouldEqual, "test:app:user:1")
+		})
+
+		Convey("生成缓存信息, 使用模板的过期时间及抖动策略", func() {
+			jitter := NewPercentJitter(0.1)
+			tpl := MustKeyTemplate("user:{id}", time.Minute, WithKeyJitter(jitter))
+			sc, err := tpl.StringCache(1)
+			So(err, ShouldBeNil)
+			So(sc.Key, ShouldEqual, "user:1")
+			So(sc.ExpTime, ShouldEqual, time.Minute)
+			So(sc.Jitter, ShouldEqual, jitter)
+
+			hc, err := tpl.HashCache("name", 1)
+			So(err, ShouldBeNil)
+			So(hc.Key, ShouldEqual, "user:1")
+			So(hc.SubKey, ShouldEqual, "name")
+			_, err = tpl.HashCache("", 1)
+			So(err, ShouldEqual, rdscache.ErrKeyParamInvalid)
+			_, err = tpl.StringCache()
+			So(err, ShouldEqual, rdscache.ErrKeyParamInvalid)
+		})
+	})
+}
@@ -36,8 +36,13 @@ func (obj *wrapBigCache) Set(cacheInfo *CacheBase, value string) error {
 	return obj.BigCache.Set(cacheInfo.Key, []byte(value))
 }
 
+// Del 数据不存在时不返回错误, 和goCache保持一致
 func (obj *wrapBigCache) Del(key string) error {
-	return obj.BigCache.Delete(key)
+	err := obj.BigCache.Delete(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil
+	}
+	return err
 }
 
 func NewWrapBigCache(bigCache *bigcache.BigCache) ILocalCache {
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// LockWithCtx 加锁, 等待锁的过程中如果ctx超时或取消, 则放弃等待并返回ctx.Err()
+// 放弃等待后如果最终拿到了锁, 会自动释放, 不会造成锁泄露
+func LockWithCtx(ctx context.Context, lock sync.Locker) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// ctx永远不会结束, 直接加锁即可
+	if ctx.Done() == nil {
+		lock.Lock()
+		return nil
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		lock.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			lock.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
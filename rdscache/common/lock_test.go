@@ -0,0 +1,43 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestLockWithCtx(t *testing.T) {
+	Convey("等待锁时支持ctx超时", t, func() {
+		lock := &sync.Mutex{}
+
+		Convey("锁空闲时直接加锁", func() {
+			So(LockWithCtx(context.Background(), lock), ShouldBeNil)
+			lock.Unlock()
+		})
+
+		Convey("ctx已经取消", func() {
+			newCtx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(LockWithCtx(newCtx, lock), ShouldEqual, context.Canceled)
+		})
+
+		Convey("锁被占用时等待超时, 超时后拿到的锁会自动释放", func() {
+			lock.Lock()
+			newCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+			defer cancel()
+			startTs := time.Now()
+			So(LockWithCtx(newCtx, lock), ShouldEqual, context.DeadlineExceeded)
+			So(time.Since(startTs), ShouldBeGreaterThanOrEqualTo, time.Millisecond*100)
+			lock.Unlock()
+
+			// 放弃等待的协程拿到锁后会释放锁, 此时可以正常加锁
+			newCtx, cancel = context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			So(LockWithCtx(newCtx, lock), ShouldBeNil)
+			lock.Unlock()
+		})
+	})
+}
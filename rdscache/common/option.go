@@ -1,6 +1,10 @@
 package common
 
-import "github.com/693490554/sponge/rdscache"
+import (
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+)
 
 // HotKeyOption 热key处理选项
 type HotKeyOption struct {
@@ -8,6 +12,8 @@ type HotKeyOption struct {
 	isHotKey func() bool
 	// getShardingKey 获取key经过分片处理后的key, 支持以分片的方式解决热key问题
 	getShardingKey func() string
+	// getAllShardingKeys 获取key经过分片处理后的全部key, 删除缓存时需删除全部分片
+	getAllShardingKeys func() []string
 	// localCache 支持以localCache解决热key, 如果既有分片解决热方案又有localCache解决热key方案，优先以localCache为主
 	localCache ILocalCache
 	cacheInfo  *CacheBase
@@ -31,13 +37,54 @@ func (o *HotKeyOption) GetFromLocalCache() (string, error) {
 }
 
 func (o *HotKeyOption) SetToLocalCache(v string) error {
-	return o.localCache.Set(o.cacheInfo, v)
+	return o.SetToLocalCacheWithJitter(v, nil)
+}
+
+// SetToLocalCacheWithJitter 写入本地缓存, 过期时间按本地缓存信息中的抖动策略抖动, 未指定时使用defaultJitter
+// bigcache不支持单独指定每个key的过期时间, 抖动对其不生效
+func (o *HotKeyOption) SetToLocalCacheWithJitter(v string, defaultJitter IJitter) error {
+	cacheInfo := *o.cacheInfo
+	cacheInfo.ExpTime = cacheInfo.JitterExpTime(defaultJitter)
+	return o.localCache.Set(&cacheInfo, v)
+}
+
+// SetNoDataToLocalCacheWithJitter 将数据不存在写入本地缓存, noDataTTL小于本地缓存的过期时间(或本地缓存不过期)时
+// 使用noDataTTL作为过期时间, 本地缓存中的数据不存在不会比redis中的更晚过期
+func (o *HotKeyOption) SetNoDataToLocalCacheWithJitter(v string, noDataTTL time.Duration, defaultJitter IJitter) error {
+	cacheInfo := *o.cacheInfo
+	if noDataTTL > 0 && (cacheInfo.ExpTime <= 0 || noDataTTL < cacheInfo.ExpTime) {
+		cacheInfo.ExpTime = noDataTTL
+	}
+	cacheInfo.ExpTime = cacheInfo.JitterExpTime(defaultJitter)
+	return o.localCache.Set(&cacheInfo, v)
+}
+
+// LocalCacheKey 本地缓存中的key
+func (o *HotKeyOption) LocalCacheKey() string {
+	return o.cacheInfo.Key
+}
+
+// DelFromLocalCache 删除本地缓存中的数据, 只对当前实例生效
+func (o *HotKeyOption) DelFromLocalCache() error {
+	return o.localCache.Del(o.cacheInfo.Key)
 }
 
 func (o *HotKeyOption) GetShardingKey() string {
 	return o.getShardingKey()
 }
 
+// AllShardingKeys 获取全部分片后的key, 未使用分片方案时返回nil
+// 使用了分片方案但未注册WithAllShardingKeys时返回ErrShardingKeysUnknown, 防止删除缓存时遗漏分片
+func (o *HotKeyOption) AllShardingKeys() ([]string, error) {
+	if o.getShardingKey == nil {
+		return nil, nil
+	}
+	if o.getAllShardingKeys == nil {
+		return nil, rdscache.ErrShardingKeysUnknown
+	}
+	return o.getAllShardingKeys(), nil
+}
+
 func NewHotKeyOption(opts ...HotKeyOptionWrap) (*HotKeyOption, error) {
 	o := &HotKeyOption{}
 	for _, opt := range opts {
@@ -66,6 +113,13 @@ func WithGetShardingKey(f func() string) HotKeyOptionWrap {
 	}
 }
 
+// WithAllShardingKeys 注册获取全部分片key的函数, 需和WithGetShardingKey一起使用, 删除缓存时删除全部分片
+func WithAllShardingKeys(f func() []string) HotKeyOptionWrap {
+	return func(o *HotKeyOption) {
+		o.getAllShardingKeys = f
+	}
+}
+
 func WithLocalCache(localCache ILocalCache, cacheInfo *CacheBase) HotKeyOptionWrap {
 	return func(o *HotKeyOption) {
 		o.localCache = localCache
@@ -64,3 +64,53 @@ func TestNewHotKeyOption(t *testing.T) {
 		})
 	})
 }
+
+func TestHotKeyOption_SetNoDataToLocalCache(t *testing.T) {
+	Convey("数据不存在写入本地缓存, 不超过本地缓存的过期时间", t, func() {
+		localCache := &recordLocalCache{}
+		option, _ := NewHotKeyOption(WithLocalCache(localCache, NewCacheBase(ck, time.Second*10)))
+
+		So(option.SetNoDataToLocalCacheWithJitter("", time.Second, nil), ShouldBeNil)
+		So(localCache.expTime, ShouldEqual, time.Second)
+		So(option.SetNoDataToLocalCacheWithJitter("", time.Minute, nil), ShouldBeNil)
+		So(localCache.expTime, ShouldEqual, time.Second*10)
+		So(option.SetNoDataToLocalCacheWithJitter("", 0, nil), ShouldBeNil)
+		So(localCache.expTime, ShouldEqual, time.Second*10)
+
+		// 同样抖动
+		So(option.SetNoDataToLocalCacheWithJitter("", time.Second, NewRangeJitter(time.Second, time.Second)), ShouldBeNil)
+		So(localCache.expTime, ShouldEqual, time.Second*2)
+	})
+}
+
+func TestHotKeyOption_Delete(t *testing.T) {
+	Convey("删除缓存时获取全部分片及删除本地缓存", t, func() {
+		Convey("使用分片方案需注册获取全部分片key的函数", func() {
+			option, _ := NewHotKeyOption(WithGetShardingKey(func() string { return ck + "_1" }))
+			_, err := option.AllShardingKeys()
+			So(err, ShouldEqual, rdscache.ErrShardingKeysUnknown)
+
+			option, _ = NewHotKeyOption(
+				WithGetShardingKey(func() string { return ck + "_1" }),
+				WithAllShardingKeys(func() []string { return []string{ck + "_1", ck + "_2"} }))
+			keys, err := option.AllShardingKeys()
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{ck + "_1", ck + "_2"})
+		})
+
+		Convey("未使用分片方案", func() {
+			cache, _ := bigcache.NewBigCache(bigcache.DefaultConfig(time.Second))
+			option, _ := NewHotKeyOption(WithLocalCache(NewWrapBigCache(cache), NewCacheBase(ck, expTime)))
+			keys, err := option.AllShardingKeys()
+			So(err, ShouldBeNil)
+			So(keys, ShouldBeNil)
+
+			// 数据不存在时删除不返回错误
+			So(option.DelFromLocalCache(), ShouldBeNil)
+			So(option.SetToLocalCache("v"), ShouldBeNil)
+			So(option.DelFromLocalCache(), ShouldBeNil)
+			_, err = option.GetFromLocalCache()
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+)
+
+// DelayScheduler 延迟任务调度器, 用于延迟双删等需要在一段时间后执行的任务
+// 限制待执行的任务数, 防止写入高峰时堆积过多的定时器; 关闭时未到期的任务立即执行, 保证任务不丢失
+type DelayScheduler struct {
+	mu         sync.Mutex
+	maxPending int
+	nextID     uint64
+	tasks      map[uint64]*delayTask // 未到期的任务
+	closed     bool
+	wg         sync.WaitGroup // 未执行完成的任务, 包括执行中的任务
+}
+
+type delayTask struct {
+	timer *time.Timer
+	fn    func()
+}
+
+// NewDelayScheduler 创建延迟任务调度器, maxPending为未到期任务数的上限, <=0代表不限制
+func NewDelayScheduler(maxPending int) *DelayScheduler {
+	return &DelayScheduler{maxPending: maxPending, tasks: map[uint64]*delayTask{}}
+}
+
+// Schedule delay后在新的协程中执行fn
+// 调度器已关闭时返回ErrSchedulerClosed, 未到期任务数达到上限时返回ErrSchedulerFull, 此时fn不会被执行
+func (s *DelayScheduler) Schedule(delay time.Duration, fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return rdscache.ErrSchedulerClosed
+	}
+	if s.maxPending > 0 && len(s.tasks) >= s.maxPending {
+		return rdscache.ErrSchedulerFull
+	}
+
+	s.nextID++
+	id := s.nextID
+	s.wg.Add(1)
+	s.tasks[id] = &delayTask{fn: fn, timer: time.AfterFunc(delay, func() { s.fire(id) })}
+	return nil
+}
+
+// Pending 未到期的任务数
+func (s *DelayScheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+// Shutdown 关闭调度器, 不再接受新的任务, 未到期的任务立即执行
+// 等待所有任务执行完成, ctx超时或取消时直接返回ctx.Err(), 不影响任务的执行; 可重复调用
+func (s *DelayScheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for id, t := range s.tasks {
+		// 定时器已触发的任务由fire执行
+		if t.timer.Stop() {
+			delete(s.tasks, id)
+			go s.run(t.fn)
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *DelayScheduler) fire(id uint64) {
+	s.mu.Lock()
+	t, ok := s.tasks[id]
+	delete(s.tasks, id)
+	s.mu.Unlock()
+	if ok {
+		s.run(t.fn)
+	}
+}
+
+func (s *DelayScheduler) run(fn func()) {
+	defer s.wg.Done()
+	fn()
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestDelayScheduler(t *testing.T) {
+	Convey("延迟任务调度器", t, func() {
+		ctx := context.Background()
+
+		Convey("到期后执行任务", func() {
+			s := NewDelayScheduler(0)
+			var callCnt int32
+			So(s.Schedule(time.Millisecond*50, func() { atomic.AddInt32(&callCnt, 1) }), ShouldBeNil)
+			So(s.Pending(), ShouldEqual, 1)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 0)
+
+			time.Sleep(time.Millisecond * 100)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 1)
+			So(s.Pending(), ShouldEqual, 0)
+		})
+
+		Convey("未到期任务数达到上限", func() {
+			s := NewDelayScheduler(2)
+			for i := 0; i < 2; i++ {
+				So(s.Schedule(time.Minute, func() {}), ShouldBeNil)
+			}
+			So(s.Schedule(time.Minute, func() {}), ShouldEqual, rdscache.ErrSchedulerFull)
+			So(s.Shutdown(ctx), ShouldBeNil)
+		})
+
+		Convey("关闭时未到期的任务立即执行, 关闭后不再接受新任务", func() {
+			s := NewDelayScheduler(0)
+			var callCnt int32
+			for i := 0; i < 3; i++ {
+				So(s.Schedule(time.Minute, func() { atomic.AddInt32(&callCnt, 1) }), ShouldBeNil)
+			}
+			So(s.Shutdown(ctx), ShouldBeNil)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 3)
+			So(s.Pending(), ShouldEqual, 0)
+			So(s.Schedule(time.Minute, func() {}), ShouldEqual, rdscache.ErrSchedulerClosed)
+			So(s.Shutdown(ctx), ShouldBeNil)
+		})
+
+		Convey("等待任务执行完成时ctx超时", func() {
+			s := NewDelayScheduler(0)
+			So(s.Schedule(0, func() { time.Sleep(time.Millisecond * 200) }), ShouldBeNil)
+			time.Sleep(time.Millisecond * 20)
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+			defer cancel()
+			So(s.Shutdown(timeoutCtx), ShouldEqual, context.DeadlineExceeded)
+			So(s.Shutdown(ctx), ShouldBeNil)
+		})
+	})
+}
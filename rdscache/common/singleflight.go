@@ -0,0 +1,100 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/693490554/sponge/rdscache"
+)
+
+// SingleFlight 按key合并并发请求, 同一时刻相同key的请求只有第一个真正执行, 其余请求等待并共享其结果
+// 相比使用同一把锁预防缓存击穿, 不同key之间互不阻塞, 且调用方无需自行维护锁
+type SingleFlight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func NewSingleFlight() *SingleFlight {
+	return &SingleFlight{calls: map[string]*flightCall{}}
+}
+
+// Do 执行fn并返回结果, 执行期间相同key的调用不再执行fn, 而是等待并共享本次的结果(包括错误)
+// fn在第一个请求的协程中执行, 等待中的请求ctx超时或取消时直接返回ctx.Err(), 不影响fn的执行
+// fn通常使用执行的请求自身的ctx, 返回ctx超时或取消的错误时等待中的请求不共享该错误:
+// 自身ctx仍有效的请求重新合并执行, 其中一个请求使用自身的ctx执行自己的fn
+func (g *SingleFlight) Do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	for {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		if !ok {
+			break
+		}
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			if isContextErr(c.err) && ctx.Err() == nil {
+				continue
+			}
+			return c.val, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	// fn panic时, 等待中的请求将收到ErrSingleFlightAborted
+	c.err = rdscache.ErrSingleFlightAborted
+	c.val, c.err = fn()
+	return c.val, c.err
+}
+
+// isContextErr 是否是ctx超时或取消导致的错误
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Go 在新的协程中异步执行fn, 相同key已有执行中的fn(包括Do)时不再执行, 返回是否发起了执行
+// 用于后台刷新缓存等无需等待结果的场景, 保证相同key同一时刻只有一个后台任务
+// fn panic时恢复并交给onPanic处理(为nil时忽略), 不会导致进程退出, 执行结束后相同key可以再次执行
+func (g *SingleFlight) Go(key string, fn func(), onPanic func(p interface{})) bool {
+	g.mu.Lock()
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p := recover()
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(c.done)
+			if p != nil && onPanic != nil {
+				onPanic(p)
+			}
+		}()
+		c.err = rdscache.ErrSingleFlightAborted
+		fn()
+		c.err = nil
+	}()
+	return true
+}
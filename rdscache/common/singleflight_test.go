@@ -0,0 +1,149 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestSingleFlight(t *testing.T) {
+	Convey("按key合并并发请求", t, func() {
+		g := NewSingleFlight()
+		ctx := context.Background()
+
+		Convey("相同key的并发请求共享结果, 不同key互不影响", func() {
+			var callCnt int32
+			fn := func() (interface{}, error) {
+				atomic.AddInt32(&callCnt, 1)
+				time.Sleep(time.Millisecond * 100)
+				return "v", nil
+			}
+			wg := sync.WaitGroup{}
+			rets := make([]interface{}, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					rets[i], _ = g.Do(ctx, "k", fn)
+				}(i)
+			}
+			wg.Wait()
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 1)
+			for _, v := range rets {
+				So(v, ShouldEqual, "v")
+			}
+
+			// 执行结束后再次调用会重新执行
+			_, _ = g.Do(ctx, "k", fn)
+			_, _ = g.Do(ctx, "k2", fn)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 3)
+		})
+
+		Convey("等待中的请求ctx超时直接返回", func() {
+			release := make(chan struct{})
+			go func() {
+				_, _ = g.Do(ctx, "k", func() (interface{}, error) {
+					<-release
+					return "v", nil
+				})
+			}()
+			time.Sleep(time.Millisecond * 50)
+
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+			defer cancel()
+			_, err := g.Do(timeoutCtx, "k", func() (interface{}, error) {
+				return "other", nil
+			})
+			So(err, ShouldEqual, context.DeadlineExceeded)
+			close(release)
+		})
+
+		Convey("执行的请求ctx取消, ctx仍有效的等待中的请求重新执行, 不共享取消的错误", func() {
+			cancelCtx, cancel := context.WithCancel(ctx)
+			started := make(chan struct{})
+			firstErr := make(chan error)
+			go func() {
+				_, err := g.Do(cancelCtx, "k", func() (interface{}, error) {
+					close(started)
+					<-cancelCtx.Done()
+					return nil, fmt.Errorf("load fail: %w", cancelCtx.Err())
+				})
+				firstErr <- err
+			}()
+			<-started
+
+			var callCnt int32
+			wg := sync.WaitGroup{}
+			rets := make([]interface{}, 5)
+			errs := make([]error, 5)
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					rets[i], errs[i] = g.Do(ctx, "k", func() (interface{}, error) {
+						atomic.AddInt32(&callCnt, 1)
+						time.Sleep(time.Millisecond * 50)
+						return "v", nil
+					})
+				}(i)
+			}
+			time.Sleep(time.Millisecond * 50)
+			cancel()
+			So(errors.Is(<-firstErr, context.Canceled), ShouldBeTrue)
+			wg.Wait()
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 1)
+			for i := range rets {
+				So(errs[i], ShouldBeNil)
+				So(rets[i], ShouldEqual, "v")
+			}
+		})
+
+		Convey("执行的请求panic, 等待中的请求返回错误", func() {
+			started := make(chan struct{})
+			go func() {
+				defer func() { _ = recover() }()
+				_, _ = g.Do(ctx, "k", func() (interface{}, error) {
+					close(started)
+					time.Sleep(time.Millisecond * 100)
+					panic("origin panic")
+				})
+			}()
+			<-started
+			_, err := g.Do(ctx, "k", func() (interface{}, error) {
+				return "v", nil
+			})
+			So(err, ShouldEqual, rdscache.ErrSingleFlightAborted)
+		})
+
+		Convey("异步执行, 相同key执行中时不再执行", func() {
+			var callCnt int32
+			release := make(chan struct{})
+			fn := func() {
+				atomic.AddInt32(&callCnt, 1)
+				<-release
+			}
+			So(g.Go("k", fn, nil), ShouldBeTrue)
+			So(g.Go("k", fn, nil), ShouldBeFalse)
+			So(g.Go("k2", fn, nil), ShouldBeTrue)
+			close(release)
+
+			time.Sleep(time.Millisecond * 50)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 2)
+			So(g.Go("k", func() {}, nil), ShouldBeTrue)
+		})
+
+		Convey("异步执行时panic被恢复并交给onPanic处理, 之后相同key可以再次执行", func() {
+			panicked := make(chan interface{}, 1)
+			So(g.Go("k", func() { panic("boom") }, func(p interface{}) { panicked <- p }), ShouldBeTrue)
+			So(<-panicked, ShouldEqual, "boom")
+			So(g.Go("k", func() {}, nil), ShouldBeTrue)
+		})
+	})
+}
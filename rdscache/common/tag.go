@@ -0,0 +1,83 @@
+package common
+
+import (
+	"context"
+	"time"
+
+	"github.com/693490554/sponge/rdscache/backend"
+)
+
+// tagScanCount 删除标签时每批遍历的成员数, 防止标签下缓存过多时一次读取整个集合
+const tagScanCount = 100
+
+// TagRecord 需要记录标签的缓存及其过期时间
+type TagRecord struct {
+	CacheInfo ICacheInfo
+	ExpTime   time.Duration
+}
+
+// RecordTags 在redis中记录标签和缓存的关系, 标签集合的过期时间不早于其中的缓存
+// 需在写入缓存之前调用, 先写入缓存时两者之间删除标签会遗漏刚写入的缓存; 记录后缓存写入失败不影响删除标签
+func RecordTags(ctx context.Context, store backend.IBackend, records ...TagRecord) error {
+	var p backend.IPipeline
+	for _, r := range records {
+		tags := r.CacheInfo.BaseInfo().Tags
+		if len(tags) == 0 {
+			continue
+		}
+		if p == nil {
+			p = store.Pipeline(ctx)
+			defer func() { _ = p.Close() }()
+		}
+		member := FullKey(r.CacheInfo)
+		for _, tag := range tags {
+			p.SAddWithExpire(TagKey(tag), r.ExpTime, member)
+		}
+	}
+	if p == nil {
+		return nil
+	}
+	return p.Exec()
+}
+
+// InvalidateTag 分批遍历标签集合, 删除其中记录的全部缓存, 每批删除成功后从集合中移除这些成员
+// del在管道中删除单个缓存, 由服务决定删除时的附加操作(例如撤销租约)
+func InvalidateTag(ctx context.Context, store backend.IBackend, tag string,
+	del func(p backend.IPipeline, cacheInfo ICacheInfo, keys ...string) error) error {
+	tagKey := TagKey(tag)
+	var cursor uint64
+	for {
+		members, next, err := store.SScan(ctx, tagKey, cursor, tagScanCount)
+		if err != nil {
+			return err
+		}
+		if err = invalidateMembers(ctx, store, tagKey, members, del); err != nil {
+			return err
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// invalidateMembers 删除一批成员对应的缓存并从标签集合中移除
+func invalidateMembers(ctx context.Context, store backend.IBackend, tagKey string, members []string,
+	del func(p backend.IPipeline, cacheInfo ICacheInfo, keys ...string) error) error {
+	if len(members) == 0 {
+		return nil
+	}
+	p := store.Pipeline(ctx)
+	defer func() { _ = p.Close() }()
+	for _, member := range members {
+		cacheInfo := ParseFullKey(member)
+		if err := del(p, cacheInfo, cacheInfo.BaseInfo().Key); err != nil {
+			return err
+		}
+	}
+	if err := p.Exec(); err != nil {
+		return err
+	}
+	// 只移除本批删除的成员, 删除期间新写入的缓存仍保留在集合中
+	return store.SRem(ctx, tagKey, members...)
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+// pagedBackend 按count分批返回集合成员, 遍历开始时对集合拍快照, 和redis的SSCAN一样不受遍历期间删除成员的影响
+type pagedBackend struct {
+	*backend.MemoryBackend
+	snapshot []string
+	scans    int
+	maxBatch int
+}
+
+func (b *pagedBackend) SScan(
+	ctx context.Context, key string, cursor uint64, count int64) ([]string, uint64, error) {
+	if cursor == 0 {
+		members, err := b.SMembers(ctx, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		sort.Strings(members)
+		b.snapshot = members
+	}
+	b.scans++
+	next := cursor + uint64(count)
+	if next >= uint64(len(b.snapshot)) {
+		next = uint64(len(b.snapshot))
+	}
+	ret := b.snapshot[cursor:next]
+	if len(ret) > b.maxBatch {
+		b.maxBatch = len(ret)
+	}
+	if next == uint64(len(b.snapshot)) {
+		next = 0
+	}
+	return ret, next, nil
+}
+
+func TestInvalidateTag(t *testing.T) {
+	Convey("分批删除标签下的全部缓存", t, func() {
+		ctx := context.Background()
+		store := &pagedBackend{MemoryBackend: backend.NewMemoryBackend()}
+		total := tagScanCount*2 + 1
+		var records []TagRecord
+		for i := 0; i < total; i++ {
+			cacheInfo := NewStringCache(fmt.Sprintf("tagTest_%d", i), 0)
+			cacheInfo.Tags = []string{"tag"}
+			records = append(records, TagRecord{CacheInfo: cacheInfo, ExpTime: time.Minute})
+			_ = store.Set(ctx, cacheInfo.Key, "v", 0)
+		}
+		hashInfo := NewHashCache("tagTestHash", "sk", 0)
+		hashInfo.Tags = []string{"tag"}
+		records = append(records, TagRecord{CacheInfo: hashInfo, ExpTime: time.Minute})
+		_ = store.HSet(ctx, hashInfo.Key, "sk", "v")
+		_ = store.HSet(ctx, hashInfo.Key, "other", "v")
+		So(RecordTags(ctx, store, records...), ShouldBeNil)
+
+		So(InvalidateTag(ctx, store, "tag", DelFromPipeline), ShouldBeNil)
+		So(store.scans, ShouldEqual, 3)
+		So(store.maxBatch, ShouldEqual, tagScanCount)
+		for i := 0; i < total; i++ {
+			_, err := store.Get(ctx, fmt.Sprintf("tagTest_%d", i))
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		}
+		_, err := store.HGet(ctx, hashInfo.Key, "sk")
+		So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		v, _ := store.HGet(ctx, hashInfo.Key, "other")
+		So(v, ShouldEqual, "v")
+		members, _ := store.SMembers(ctx, TagKey("tag"))
+		So(members, ShouldBeEmpty)
+
+		// 删除失败时保留标签集合中的成员, 可重试
+		So(RecordTags(ctx, store, records[0]), ShouldBeNil)
+		delErr := fmt.Errorf("del fail")
+		So(InvalidateTag(ctx, store, "tag", func(p backend.IPipeline, cacheInfo ICacheInfo, keys ...string) error {
+			return delErr
+		}), ShouldEqual, delErr)
+		members, _ = store.SMembers(ctx, TagKey("tag"))
+		So(members, ShouldHaveLength, 1)
+	})
+}
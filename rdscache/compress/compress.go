@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 内置压缩算法的标识
+const (
+	GzipID   byte = 1
+	SnappyID byte = 2
+	ZstdID   byte = 3
+)
+
+// ICompressor 压缩算法抽象
+type ICompressor interface {
+	// ID 算法标识, 会记录在压缩后的存储值中, 读取时据此选择解压算法, 自定义算法的ID不可和内置算法重复
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+func (c *gzipCompressor) ID() byte {
+	return GzipID
+}
+
+func (c *gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	return ioutil.ReadAll(r)
+}
+
+// NewGzipCompressor gzip压缩, 压缩率高但速度较慢
+func NewGzipCompressor() ICompressor {
+	return &gzipCompressor{level: gzip.DefaultCompression}
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) ID() byte {
+	return SnappyID
+}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// NewSnappyCompressor snappy压缩, 速度快但压缩率较低
+func NewSnappyCompressor() ICompressor {
+	return snappyCompressor{}
+}
+
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (c *zstdCompressor) ID() byte {
+	return ZstdID
+}
+
+func (c *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
+
+// NewZstdCompressor zstd压缩, 兼顾压缩率及速度
+func NewZstdCompressor() ICompressor {
+	// 不传入writer及reader时不会返回错误, EncodeAll及DecodeAll支持并发调用
+	encoder, _ := zstd.NewWriter(nil)
+	decoder, _ := zstd.NewReader(nil)
+	return &zstdCompressor{encoder: encoder, decoder: decoder}
+}
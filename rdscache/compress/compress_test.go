@@ -0,0 +1,66 @@
+package compress
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+var bigValue = strings.Repeat(`{"a":1,"b":"test"}`, 100)
+
+func TestCompressor(t *testing.T) {
+	Convey("压缩及解压", t, func() {
+		for _, c := range []ICompressor{NewGzipCompressor(), NewSnappyCompressor(), NewZstdCompressor()} {
+			data, err := c.Compress([]byte(bigValue))
+			So(err, ShouldBeNil)
+			ret, err := c.Decompress(data)
+			So(err, ShouldBeNil)
+			So(string(ret), ShouldEqual, bigValue)
+		}
+	})
+}
+
+func TestTransformer(t *testing.T) {
+	Convey("存储值压缩转换", t, func() {
+		gzipTransformer := NewTransformer(NewGzipCompressor(), 100)
+
+		Convey("长度小于阈值不压缩", func() {
+			v, err := gzipTransformer.Encode("k", `{"a":1}`)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, `{"a":1}`)
+			v, err = gzipTransformer.Decode("k", v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("长度大于阈值压缩, 压缩后带有标记", func() {
+			v, err := gzipTransformer.Encode("k", bigValue)
+			So(err, ShouldBeNil)
+			So(v, ShouldStartWith, compressFlag)
+			So(len(v), ShouldBeLessThan, len(bigValue))
+			v, err = gzipTransformer.Decode("k", v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, bigValue)
+		})
+
+		Convey("切换压缩算法后历史数据仍可读取", func() {
+			v, _ := gzipTransformer.Encode("k", bigValue)
+			v, err := NewTransformer(NewSnappyCompressor(), 100).Decode("k", v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, bigValue)
+		})
+
+		Convey("未压缩的msgpack整数0(\x00)原样返回", func() {
+			v, err := gzipTransformer.Decode("k", "\x00")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "\x00")
+		})
+
+		Convey("未知的压缩算法", func() {
+			_, err := gzipTransformer.Decode("k", compressFlag+"\xffdata")
+			So(err, ShouldEqual, rdscache.ErrUnknownCompressor)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package compress
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+)
+
+// compressFlag 压缩后存储值的前缀, 前缀后紧跟1字节的算法标识
+// 未压缩的值可以和压缩后的值共存, 依赖于内置序列化方式的结果不会以该前缀开头:
+// json等文本不包含\x00; msgpack中\x00是完整的正整数0, 以\x00开头的单个msgpack值只能是"\x00"本身(不满足Decode的长度要求);
+// gob的首字节为消息长度, 不会为0; protobuf的首字节为字段号及类型, 字段号不能为0
+// 自定义的codec需保证序列化结果不以\x00z开头, 否则读取时会被当作压缩后的值
+const compressFlag = "\x00z"
+
+var (
+	sharedZstdOnce sync.Once
+	sharedZstd     ICompressor
+)
+
+type transformer struct {
+	compressor ICompressor
+	threshold  int
+}
+
+// NewTransformer 存储值长度>=threshold时使用compressor压缩后写入, 读取时根据标记自动解压
+// 切换压缩算法后, 使用内置算法压缩的历史数据仍然可以正常读取
+func NewTransformer(compressor ICompressor, threshold int) backend.IValueTransformer {
+	return &transformer{compressor: compressor, threshold: threshold}
+}
+
+func (t *transformer) Encode(key, value string) (string, error) {
+	if len(value) < t.threshold || value == "" {
+		return value, nil
+	}
+	data, err := t.compressor.Compress([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	// 压缩后反而更大则不压缩
+	if len(data)+len(compressFlag)+1 >= len(value) {
+		return value, nil
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(compressFlag) + 1 + len(data))
+	builder.WriteString(compressFlag)
+	builder.WriteByte(t.compressor.ID())
+	builder.Write(data)
+	return builder.String(), nil
+}
+
+func (t *transformer) Decode(key, value string) (string, error) {
+	if len(value) <= len(compressFlag) || !strings.HasPrefix(value, compressFlag) {
+		return value, nil
+	}
+	compressor := t.getCompressor(value[len(compressFlag)])
+	if compressor == nil {
+		return "", rdscache.ErrUnknownCompressor
+	}
+	data, err := compressor.Decompress([]byte(value[len(compressFlag)+1:]))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// getCompressor 根据标识获取解压算法, 优先使用当前配置的算法, 其次为内置算法
+func (t *transformer) getCompressor(id byte) ICompressor {
+	if t.compressor.ID() == id {
+		return t.compressor
+	}
+	switch id {
+	case GzipID:
+		return NewGzipCompressor()
+	case SnappyID:
+		return NewSnappyCompressor()
+	case ZstdID:
+		sharedZstdOnce.Do(func() {
+			sharedZstd = NewZstdCompressor()
+		})
+		return sharedZstd
+	default:
+		return nil
+	}
+}
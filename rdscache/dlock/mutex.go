@@ -0,0 +1,130 @@
+package dlock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+)
+
+// Mutex 基于存储后端实现的分布式锁, 用于多实例之间预防缓存击穿
+// 加锁使用SET NX PX写入随机token, 解锁及续租时校验token, 不会释放或续租其它持有者的锁
+// Mutex非并发安全, 每次加锁需创建新的Mutex
+type Mutex struct {
+	store     backend.IBackend
+	key       string
+	token     string
+	option    *Option
+	stop      chan struct{} // 通知续租协程退出, 为nil代表未持有锁
+	renewDone chan struct{}
+}
+
+func NewMutex(store backend.IBackend, key string, opts ...OptionWrap) *Mutex {
+	option := NewOption(opts...)
+	return &Mutex{store: store, key: option.keyPrefix + key, token: newToken(), option: option}
+}
+
+// Key 锁在存储后端中的key(包含前缀)
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Token 锁的持有者标识, 可用于在存储后端的原子操作中校验锁是否仍被持有(例如租约写入)
+func (m *Mutex) Token() string {
+	return m.token
+}
+
+// TryLock 尝试加锁一次, 加锁成功后自动续租直至Unlock
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	ok, err := m.store.SetNX(ctx, m.key, m.token, m.option.ttl)
+	if err != nil || !ok {
+		return false, err
+	}
+	m.startRenew()
+	return true, nil
+}
+
+// Lock 加锁, 超过waitTimeout仍未拿到锁返回ErrLockWaitTimeout, 等待时ctx超时或取消返回ctx.Err()
+func (m *Mutex) Lock(ctx context.Context) error {
+	_, err := m.LockOrWait(ctx, nil)
+	return err
+}
+
+// LockOrWait 加锁, 未拿到锁时每隔pollInterval调用一次wait, wait返回true代表无需再等待锁(例如其它实例已经写入了缓存)
+// @return bool: 是否拿到了锁, 未拿到锁且err为nil代表wait返回了true
+// @return error: 超过waitTimeout仍未拿到锁返回ErrLockWaitTimeout, 等待时ctx超时或取消返回ctx.Err()
+func (m *Mutex) LockOrWait(ctx context.Context, wait func() bool) (bool, error) {
+	deadline := time.Now().Add(m.option.waitTimeout)
+	for {
+		locked, err := m.TryLock(ctx)
+		if err != nil || locked {
+			return locked, err
+		}
+		if !time.Now().Before(deadline) {
+			return false, rdscache.ErrLockWaitTimeout
+		}
+
+		timer := time.NewTimer(m.option.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+		if wait != nil && wait() {
+			return false, nil
+		}
+	}
+}
+
+// Unlock 停止续租并释放锁, 锁已过期或已被其它持有者拿到时返回ErrLockNotHeld
+// 持有锁的请求ctx可能已经结束, 释放锁不使用请求的ctx
+func (m *Mutex) Unlock() error {
+	if m.stop == nil {
+		return rdscache.ErrLockNotHeld
+	}
+	close(m.stop)
+	<-m.renewDone
+	m.stop = nil
+
+	ok, err := m.store.CompareAndDel(context.Background(), m.key, m.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return rdscache.ErrLockNotHeld
+	}
+	return nil
+}
+
+// startRenew 每ttl/3续租一次, 防止回源耗时超过ttl时锁被其它实例拿到
+func (m *Mutex) startRenew() {
+	m.stop, m.renewDone = make(chan struct{}), make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(m.option.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ok, err := m.store.CompareAndExpire(context.Background(), m.key, m.token, m.option.ttl)
+				// 锁已经不属于自己, 无需再续租; 续租出错时等待下次重试
+				if err == nil && !ok {
+					return
+				}
+			}
+		}
+	}(m.stop, m.renewDone)
+}
+
+// newToken 生成随机token, 用于标识锁的持有者
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
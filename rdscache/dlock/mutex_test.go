@@ -0,0 +1,85 @@
+package dlock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+var (
+	ctx = context.Background()
+	key = "testLock"
+)
+
+func TestMutex(t *testing.T) {
+	Convey("分布式锁", t, func() {
+		store := backend.NewMemoryBackend()
+		opts := []OptionWrap{WithPollInterval(time.Millisecond * 10), WithWaitTimeout(time.Millisecond * 100)}
+
+		Convey("加锁及释放, 只能释放自己持有的锁", func() {
+			m1 := NewMutex(store, key, opts...)
+			So(m1.Lock(ctx), ShouldBeNil)
+			v, _ := store.Get(ctx, defaultKeyPrefix+key)
+			So(v, ShouldEqual, m1.token)
+
+			m2 := NewMutex(store, key, opts...)
+			locked, err := m2.TryLock(ctx)
+			So(err, ShouldBeNil)
+			So(locked, ShouldBeFalse)
+			So(m2.Unlock(), ShouldEqual, rdscache.ErrLockNotHeld)
+
+			So(m1.Unlock(), ShouldBeNil)
+			So(store.TTL(defaultKeyPrefix+key), ShouldEqual, -2*time.Second)
+			So(m2.Lock(ctx), ShouldBeNil)
+			So(m2.Unlock(), ShouldBeNil)
+		})
+
+		Convey("等待锁超时及ctx超时", func() {
+			m1 := NewMutex(store, key, opts...)
+			So(m1.Lock(ctx), ShouldBeNil)
+			defer func() { _ = m1.Unlock() }()
+
+			So(NewMutex(store, key, opts...).Lock(ctx), ShouldEqual, rdscache.ErrLockWaitTimeout)
+
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*30)
+			defer cancel()
+			So(NewMutex(store, key, WithWaitTimeout(time.Second)).Lock(timeoutCtx), ShouldEqual, context.DeadlineExceeded)
+		})
+
+		Convey("等待锁期间无需再等待时直接返回", func() {
+			m1 := NewMutex(store, key, opts...)
+			So(m1.Lock(ctx), ShouldBeNil)
+			defer func() { _ = m1.Unlock() }()
+
+			waitCnt := 0
+			locked, err := NewMutex(store, key, opts...).LockOrWait(ctx, func() bool {
+				waitCnt++
+				return waitCnt == 2
+			})
+			So(err, ShouldBeNil)
+			So(locked, ShouldBeFalse)
+			So(waitCnt, ShouldEqual, 2)
+		})
+
+		Convey("持有期间自动续租", func() {
+			m1 := NewMutex(store, key, WithTTL(time.Millisecond*150))
+			So(m1.Lock(ctx), ShouldBeNil)
+			time.Sleep(time.Millisecond * 400)
+			locked, _ := NewMutex(store, key).TryLock(ctx)
+			So(locked, ShouldBeFalse)
+			So(m1.Unlock(), ShouldBeNil)
+		})
+
+		Convey("持有者宕机时锁在租期后自动释放", func() {
+			// 模拟宕机的持有者: 写入锁后不再续租
+			_, _ = store.SetNX(ctx, defaultKeyPrefix+key, "dead", time.Millisecond*50)
+			m := NewMutex(store, key, opts...)
+			So(m.Lock(ctx), ShouldBeNil)
+			So(m.Unlock(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package dlock
+
+import "time"
+
+const (
+	defaultKeyPrefix    = "sponge:lock:"
+	defaultTTL          = 10 * time.Second
+	defaultPollInterval = 50 * time.Millisecond
+	defaultWaitTimeout  = 3 * time.Second
+)
+
+// Option 分布式锁可选项
+type Option struct {
+	keyPrefix string // 锁的key前缀, 锁的key为前缀+业务传入的key
+	// ttl 锁的租期, 持有者存活时每ttl/3自动续租, 持有者宕机时锁最多ttl后自动释放, 其它实例可以重新拿到锁
+	ttl          time.Duration
+	pollInterval time.Duration // 等待锁时的轮询间隔
+	waitTimeout  time.Duration // 等待锁的最长时间
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{
+		keyPrefix:    defaultKeyPrefix,
+		ttl:          defaultTTL,
+		pollInterval: defaultPollInterval,
+		waitTimeout:  defaultWaitTimeout,
+	}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithKeyPrefix 指定锁的key前缀, 默认为sponge:lock:
+func WithKeyPrefix(prefix string) OptionWrap {
+	return func(o *Option) {
+		o.keyPrefix = prefix
+	}
+}
+
+// WithTTL 指定锁的租期, 默认10s
+func WithTTL(ttl time.Duration) OptionWrap {
+	return func(o *Option) {
+		if ttl > 0 {
+			o.ttl = ttl
+		}
+	}
+}
+
+// WithPollInterval 指定等待锁时的轮询间隔, 默认50ms
+func WithPollInterval(interval time.Duration) OptionWrap {
+	return func(o *Option) {
+		if interval > 0 {
+			o.pollInterval = interval
+		}
+	}
+}
+
+// WithWaitTimeout 指定等待锁的最长时间, 默认3s
+func WithWaitTimeout(timeout time.Duration) OptionWrap {
+	return func(o *Option) {
+		o.waitTimeout = timeout
+	}
+}
@@ -0,0 +1,96 @@
+package encrypt
+
+import (
+	"testing"
+
+	"github.com/693490554/sponge/rdscache"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+var (
+	rk   = "encryptTest"
+	key1 = []byte("0123456789abcdef")
+	key2 = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func TestKeyring(t *testing.T) {
+	Convey("密钥环初始化", t, func() {
+		_, err := NewKeyring("k1", map[string][]byte{"k2": key2})
+		So(err, ShouldEqual, rdscache.ErrEncryptKeyNotFound)
+
+		_, err = NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+		So(err, ShouldNotBeNil)
+
+		_, err = NewKeyring("", map[string][]byte{"": key1})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("加密及解密", t, func() {
+		keyring, err := NewKeyring("k1", map[string][]byte{"k1": key1})
+		So(err, ShouldBeNil)
+		data, err := keyring.Encrypt([]byte("test"), []byte("k"))
+		So(err, ShouldBeNil)
+		So(string(data), ShouldNotContainSubstring, "test")
+
+		plaintext, err := keyring.Decrypt(data, []byte("k"))
+		So(err, ShouldBeNil)
+		So(string(plaintext), ShouldEqual, "test")
+		// 附加数据不一致
+		_, err = keyring.Decrypt(data, []byte("k2"))
+		So(err, ShouldNotBeNil)
+
+		// 篡改密文
+		data[len(data)-1] ^= 0xff
+		_, err = keyring.Decrypt(data, []byte("k"))
+		So(err, ShouldNotBeNil)
+
+		_, err = keyring.Decrypt([]byte{10, 'k'}, nil)
+		So(err, ShouldEqual, rdscache.ErrCiphertextInvalid)
+	})
+}
+
+func TestTransformer(t *testing.T) {
+	Convey("存储值加密转换", t, func() {
+		oldKeyring, _ := NewKeyring("k1", map[string][]byte{"k1": key1})
+		newKeyring, _ := NewKeyring("k2", map[string][]byte{"k1": key1, "k2": key2})
+		oldTransformer, newTransformer := NewTransformer(oldKeyring), NewTransformer(newKeyring)
+
+		Convey("空缓存同样加密", func() {
+			v, err := oldTransformer.Encode(rk, "")
+			So(err, ShouldBeNil)
+			So(v, ShouldNotEqual, "")
+			v, err = oldTransformer.Decode(rk, v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "")
+		})
+
+		Convey("密钥轮换后旧密钥加密的数据仍可读取", func() {
+			v, _ := oldTransformer.Encode(rk, `{"a":1}`)
+			ret, err := newTransformer.Decode(rk, v)
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, `{"a":1}`)
+
+			// 新密钥加密的数据, 旧密钥环无法解密
+			v, _ = newTransformer.Encode(rk, `{"a":1}`)
+			_, err = oldTransformer.Decode(rk, v)
+			So(err, ShouldEqual, rdscache.ErrEncryptKeyNotFound)
+		})
+
+		Convey("默认拒绝未加密的存储值", func() {
+			_, err := newTransformer.Decode(rk, `{"a":1}`)
+			So(err, ShouldEqual, rdscache.ErrValueNotEncrypted)
+		})
+
+		Convey("允许读取未加密的历史数据时原样返回", func() {
+			v, err := NewTransformer(newKeyring, WithAllowPlaintext()).Decode(rk, `{"a":1}`)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("密文复制到其它key下时解密失败", func() {
+			v, _ := newTransformer.Encode(rk, `{"a":1}`)
+			_, err := newTransformer.Decode(rk+"_other", v)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/693490554/sponge/rdscache"
+)
+
+// Keyring AES-GCM密钥环, 写入时使用当前密钥加密, 读取时根据密文中记录的密钥ID选择密钥解密
+// 密钥轮换: 新密钥加入密钥环并设为当前密钥, 旧密钥保留至使用旧密钥加密的缓存全部过期后再移除
+type Keyring struct {
+	currentID string
+	aeads     map[string]cipher.AEAD
+}
+
+// NewKeyring keys为密钥ID->密钥, 密钥长度需为16/24/32字节(分别对应AES-128/192/256), currentID为写入时使用的密钥ID
+func NewKeyring(currentID string, keys map[string][]byte) (*Keyring, error) {
+	if len(currentID) == 0 || len(currentID) > 255 {
+		return nil, errors.New("key id length must between 1 and 255")
+	}
+	if _, ok := keys[currentID]; !ok {
+		return nil, rdscache.ErrEncryptKeyNotFound
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, errors.New("key id length must between 1 and 255")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+	return &Keyring{currentID: currentID, aeads: aeads}, nil
+}
+
+// Encrypt 使用当前密钥加密, 密文格式: 密钥ID长度(1字节) + 密钥ID + nonce + 加密数据
+// additionalData不写入密文, 只参与认证, 解密时需传入相同的值
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	aead := k.aeads[k.currentID]
+	nonceSize := aead.NonceSize()
+	headerSize := 1 + len(k.currentID) + nonceSize
+
+	out := make([]byte, headerSize, headerSize+len(plaintext)+aead.Overhead())
+	out[0] = byte(len(k.currentID))
+	copy(out[1:], k.currentID)
+	nonce := out[1+len(k.currentID) : headerSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	// 密钥ID作为附加数据参与认证, 防止密钥ID被篡改
+	return aead.Seal(out, nonce, plaintext, aad(out[:1+len(k.currentID)], additionalData)), nil
+}
+
+// Decrypt 根据密文中的密钥ID选择密钥解密, additionalData需和加密时一致
+func (k *Keyring) Decrypt(data, additionalData []byte) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, rdscache.ErrCiphertextInvalid
+	}
+	idLen := int(data[0])
+	if len(data) < 1+idLen {
+		return nil, rdscache.ErrCiphertextInvalid
+	}
+	aead, ok := k.aeads[string(data[1:1+idLen])]
+	if !ok {
+		return nil, rdscache.ErrEncryptKeyNotFound
+	}
+	headerSize := 1 + idLen + aead.NonceSize()
+	if len(data) < headerSize+aead.Overhead() {
+		return nil, rdscache.ErrCiphertextInvalid
+	}
+	return aead.Open(nil, data[1+idLen:headerSize], data[headerSize:], aad(data[:1+idLen], additionalData))
+}
+
+// aad 参与认证的附加数据: 密文头部(密钥ID) + 调用方传入的附加数据
+func aad(header, additionalData []byte) []byte {
+	ret := make([]byte, 0, len(header)+len(additionalData))
+	return append(append(ret, header...), additionalData...)
+}
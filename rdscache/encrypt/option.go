@@ -0,0 +1,24 @@
+package encrypt
+
+// Option 加密转换的可选项
+type Option struct {
+	allowPlaintext bool // 是否允许读取未加密的存储值
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithAllowPlaintext 读取到未加密的存储值时原样返回, 仅用于从未加密平滑迁移, 历史数据全部过期后应关闭
+// 默认读取到未加密的存储值时返回ErrValueNotEncrypted, 防止能写入redis的一方绕过加密注入任意数据
+func WithAllowPlaintext() OptionWrap {
+	return func(o *Option) {
+		o.allowPlaintext = true
+	}
+}
@@ -0,0 +1,46 @@
+package encrypt
+
+import (
+	"strings"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+)
+
+// encryptFlag 加密后存储值的前缀, 默认所有存储值均需带该前缀; 允许读取未加密的历史数据时, 以该前缀开头的值均视为密文
+const encryptFlag = "\x00e"
+
+type transformer struct {
+	keyring *Keyring
+	option  *Option
+}
+
+// NewTransformer 写入时使用keyring的当前密钥加密, 读取时自动解密
+// 存储值所在的key作为附加数据参与认证, 密文被复制到其它key下时解密失败
+// 空缓存(CacheEmptyValue)同样会被加密, 防止通过redis推断出数据是否存在
+// 默认拒绝未加密的存储值, 从未加密迁移时可通过WithAllowPlaintext读取未加密的历史数据
+func NewTransformer(keyring *Keyring, opts ...OptionWrap) backend.IValueTransformer {
+	return &transformer{keyring: keyring, option: NewOption(opts...)}
+}
+
+func (t *transformer) Encode(key, value string) (string, error) {
+	data, err := t.keyring.Encrypt([]byte(value), []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return encryptFlag + string(data), nil
+}
+
+func (t *transformer) Decode(key, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptFlag) {
+		if t.option.allowPlaintext {
+			return value, nil
+		}
+		return "", rdscache.ErrValueNotEncrypted
+	}
+	data, err := t.keyring.Decrypt([]byte(value[len(encryptFlag):]), []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -4,10 +4,28 @@ import "errors"
 
 var (
 	ErrNoData                    = errors.New("no data error")
+	ErrCacheNotExist             = errors.New("cache not exist") // 缓存存储后端中不存在该key(或hash中不存在该field)
 	ErrModuleMustNotNil          = errors.New("model must not nil")
 	ErrLocalCacheNoData          = errors.New("local cache no data")
 	ErrHotKeyOptionInitFail      = errors.New("init error, please check your parameter") // 预防热key的方式均为nil
 	ErrMGetHaveSomeUnMarshalFail = errors.New(                                           // 批量获取缓存数据时，如果有其中一些数据反序列化失败，则报该错误
 		"some value is not correct, so unmarshal fail, " + "you can check log get some info")
 	ErrMGetFromOriRetCntNotCorrect = errors.New("mget from origin return cnt not equal query cnt") // 回源返回数据数量必须等于请求数据数量
+	ErrNotProtoMessage             = errors.New("value must implement proto.Message")              // 使用protobuf序列化时, 数据需实现proto.Message
+	ErrUnknownCompressor           = errors.New("unknown compressor")                              // 存储值使用了未知的压缩算法
+	ErrEncryptKeyNotFound          = errors.New("encrypt key not found")                           // 密钥环中不存在存储值使用的密钥
+	ErrCiphertextInvalid           = errors.New("ciphertext invalid")                              // 加密后的存储值格式不正确
+	ErrValueNotEncrypted           = errors.New("value not encrypted")                             // 开启加密后读取到未加密的存储值
+	ErrEnvelopeInvalid             = errors.New("envelope invalid")                                // 存储值信封格式不正确或版本不支持
+	ErrSingleFlightAborted         = errors.New("single flight aborted")                           // 合并请求时, 执行回源的请求panic
+	ErrLockWaitTimeout             = errors.New("lock wait timeout")                               // 等待分布式锁超时
+	ErrLockNotHeld                 = errors.New("lock not held")                                   // 释放分布式锁时锁已过期或被其它持有者拿到
+	ErrShardingKeysUnknown         = errors.New("sharding keys unknown")                           // 删除分片的热key时, 未注册获取全部分片key的函数
+	ErrSubscriptionClosed          = errors.New("subscription closed")                             // 订阅已被关闭
+	ErrSchedulerClosed             = errors.New("scheduler closed")                                // 延迟任务调度器已关闭
+	ErrSchedulerFull               = errors.New("scheduler full")                                  // 延迟任务调度器中未到期的任务数达到上限
+	ErrKeyTemplateInvalid          = errors.New("key template invalid")                            // key模板格式不正确
+	ErrKeyParamInvalid             = errors.New("key param invalid")                               // 生成key的参数数量、类型或值不正确
+	ErrKeySpaceInvalid             = errors.New("key space invalid")                               // key空间的环境、前缀或分隔符中包含{}
+	ErrNamespaceInvalid            = errors.New("namespace invalid")                               // 命名空间的名称中包含{}
 )
@@ -2,22 +2,196 @@ package fcache
 
 import (
 	"sync"
+	"time"
 
+	"github.com/693490554/sponge/rdscache/backend"
+	"github.com/693490554/sponge/rdscache/codec"
 	"github.com/693490554/sponge/rdscache/common"
+	"github.com/693490554/sponge/rdscache/compress"
+	"github.com/693490554/sponge/rdscache/dlock"
+	"github.com/693490554/sponge/rdscache/encrypt"
+	"github.com/693490554/sponge/rdscache/hotkey"
+	"github.com/693490554/sponge/rdscache/invalidate"
+	"github.com/693490554/sponge/rdscache/logging"
+	"github.com/693490554/sponge/rdscache/namespace"
+	"github.com/693490554/sponge/rdscache/observe"
+	"github.com/693490554/sponge/rdscache/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// fCacheSvcOption 函数缓存服务级别的可选项, 对该服务的所有调用生效
+type fCacheSvcOption struct {
+	codec codec.ICodec // 默认的序列化方式, 默认使用json
+	// compressor 存储值长度>=compressThreshold时使用的压缩算法, 为nil代表不压缩
+	compressor        compress.ICompressor
+	compressThreshold int
+	keyring           *encrypt.Keyring     // 存储值加密使用的密钥环, 为nil代表不加密
+	encryptOpts       []encrypt.OptionWrap // 存储值加密的可选项
+	envelope          bool                 // 是否以信封格式写入存储值
+	jitter            common.IJitter       // 过期时间抖动策略, 缓存信息中未指定抖动策略时使用
+	noDataTTL         time.Duration        // 默认的数据不存在的过期时间, 为0代表和真实数据使用相同的过期时间
+	bus               *invalidate.Bus      // 本地缓存失效总线, 为nil代表不通知其它实例
+	keySpace          *common.KeySpace     // 服务级别的key空间, 为nil代表不加前缀
+	namespace         *namespace.Namespace // 命名空间, 为nil代表不使用命名空间
+	observer          observe.IObserver    // 缓存事件观察者, 为nil代表不通知
+	tracer            *tracing.Tracer      // 链路追踪, 为nil代表不开启
+	logger            logging.ILogger      // 日志, 记录无法返回给调用方的错误
+	hotKeys           *hotkey.Detector     // 热key探测器, 为nil代表不统计
+}
+
+func newFCacheSvcOption(opts ...FCSvcOptionWrap) *fCacheSvcOption {
+	option := &fCacheSvcOption{codec: codec.NewJSONCodec(), logger: logging.NewStdLogger(nil)}
+	for _, o := range opts {
+		o(option)
+	}
+	return option
+}
+
+type FCSvcOptionWrap func(o *fCacheSvcOption)
+
+// transformers 写入存储前对存储值的转换
+func (o *fCacheSvcOption) transformers() []backend.IValueTransformer {
+	var ret []backend.IValueTransformer
+	if o.compressor != nil {
+		ret = append(ret, compress.NewTransformer(o.compressor, o.compressThreshold))
+	}
+	// 先压缩再加密, 加密后的数据无法再压缩
+	if o.keyring != nil {
+		ret = append(ret, encrypt.NewTransformer(o.keyring, o.encryptOpts...))
+	}
+	return ret
+}
+
+// WithSvcCodec 指定服务默认的序列化方式
+func WithSvcCodec(c codec.ICodec) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		if c != nil {
+			option.codec = c
+		}
+	}
+}
+
+// WithSvcCompress 存储值长度>=threshold时压缩后再写入, 读取时自动解压, 压缩及未压缩的数据可以共存
+func WithSvcCompress(compressor compress.ICompressor, threshold int) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.compressor = compressor
+		option.compressThreshold = threshold
+	}
+}
+
+// WithSvcEncrypt 使用AES-GCM加密存储值, 读取时(包括同步至本地缓存前)自动解密, 支持通过密钥环轮换密钥
+// 默认拒绝未加密的存储值, 从未加密迁移时可传入encrypt.WithAllowPlaintext()
+func WithSvcEncrypt(keyring *encrypt.Keyring, opts ...encrypt.OptionWrap) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.keyring = keyring
+		option.encryptOpts = opts
+	}
+}
+
+// WithSvcEnvelope 以信封格式写入存储值, 可以区分缓存的数据不存在和序列化结果为空字符串的真实数据
+// 读取时始终兼容信封格式及历史的原始存储值, 开启前需确保所有读取该缓存的服务均已升级到支持信封格式的版本
+func WithSvcEnvelope() FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.envelope = true
+	}
+}
+
+// WithSvcTTLJitter 指定服务默认的过期时间抖动策略, 对redis及本地缓存的过期时间均生效, 防止缓存雪崩
+func WithSvcTTLJitter(jitter common.IJitter) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.jitter = jitter
+	}
+}
+
+// WithSvcNoDataTTL 指定服务默认的数据不存在的过期时间, 单次调用可通过WithNoDataTTL覆盖
+func WithSvcNoDataTTL(ttl time.Duration) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.noDataTTL = ttl
+	}
+}
+
+// WithSvcInvalidationBus 指定本地缓存失效总线, 删除或刷新使用了本地缓存的热key时, 通知其它实例删除本地缓存中的数据
+func WithSvcInvalidationBus(bus *invalidate.Bus) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.bus = bus
+	}
+}
+
+// WithSvcKeySpace 指定服务级别的key空间, 该服务读写的所有key均加上key空间的环境及前缀, 不同团队或服务共用redis时防止key冲突
+// 同时使用命名空间时key空间的前缀在最外层; key模板生成的key已包含全局的key空间, 两者一般只使用其一
+func WithSvcKeySpace(space *common.KeySpace) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.keySpace = space
+	}
+}
+
+// WithSvcNamespace 指定命名空间, 该服务读写的所有key均加上命名空间及其代数作为前缀
+// 递增命名空间的代数(Bump)后该服务的缓存全部失效, 旧的key在过期后自动删除; 不影响热key的本地缓存, 本地缓存在过期后失效
+func WithSvcNamespace(ns *namespace.Namespace) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.namespace = ns
+	}
+}
+
+// WithSvcObserver 指定缓存事件观察者, 命中、未命中、回源、写入、反序列化失败及等待锁时同步通知, 可用于监控及热key统计
+// 观察者耗时较长时可使用observe.NewAsyncObserver包装, 通过有界队列异步处理
+func WithSvcObserver(observer observe.IObserver) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.observer = observer
+	}
+}
+
+// WithSvcTracing 开启链路追踪, 为GetOrCreate、回源及每次访问存储后端创建span, 以调用方ctx中的span为父span
+// tp为nil时使用otel全局的TracerProvider
+func WithSvcTracing(tp trace.TracerProvider) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.tracer = tracing.NewTracer(tp)
+	}
+}
+
+// WithSvcHotKeyDetector 指定热key探测器, 每次获取缓存(批量获取时每个key)时记录访问, 在判断是否为热key之前记录
+// 热key选项可通过common.WithIsHotKey(detector.Predicate(cacheInfo))注册, 访问次数超过阈值后自动使用热key处理
+func WithSvcHotKeyDetector(detector *hotkey.Detector) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		option.hotKeys = detector
+	}
+}
+
+// WithSvcLogger 指定日志, 记录反序列化失败、写入本地缓存失败及后台刷新失败等无法返回给调用方的错误
+// 默认使用标准库log输出到标准错误, 不需要日志时可指定logging.NewNopLogger()
+func WithSvcLogger(logger logging.ILogger) FCSvcOptionWrap {
+	return func(option *fCacheSvcOption) {
+		if logger != nil {
+			option.logger = logger
+		}
+	}
+}
+
 // fCacheOption 函数缓存可选项
 type fCacheOption struct {
 	lock            sync.Locker // 预防缓存击穿时，需要传入lock
+	singleFlight    bool        // 预防缓存击穿时, 按缓存key合并并发的回源请求
 	needCacheNoData bool        // 是否需要缓存函数不存在数据的情况，默认不需要
+	// noDataTTL 数据不存在的过期时间, 为0时使用服务默认的
+	noDataTTL time.Duration
+	// earlyRefreshBeta 提前刷新(XFetch)的系数, >0代表开启提前刷新
+	earlyRefreshBeta float64
+	// softTTL 软过期时间, >0代表开启stale-while-revalidate, 超过软过期时间后返回旧数据并在后台刷新
+	softTTL time.Duration
+	stale   *bool // 不为nil时记录本次返回的是否为超过软过期时间的旧数据
+	// dLock 预防缓存击穿时, 使用分布式锁保证多实例之间只有一个请求回源
+	dLock     bool
+	dLockOpts []dlock.OptionWrap
 	// todo: data需传入非nil指针, 如果为nil反序列化将失败
 	data interface{} // data != nil 代表需要将结果UnMarshal到data中
 	// getFromRdsCallBack，从redis获取数据时的回调函数，可用于做监控，及热key实时统计等功能
 	getFromRdsCallBack func()
 	// hotKeyOption 预防热key选项
 	// 支持分片处理热key问题或本地缓存处理热key问题
-	// 业务方通过getFromRdsCallBack回调可自行实现热key实时统计, 通过注册isHotKey函数,可以实现动态热key处理
+	// 通过注册isHotKey函数可以实现动态热key处理, 可使用内置的热key探测器(WithSvcHotKeyDetector)统计
 	hotKeyOption *common.HotKeyOption
+	// codec 本次调用的序列化方式, 为nil时使用服务默认的序列化方式
+	codec codec.ICodec
 }
 
 func NewFCacheOption(opts ...FCOptionWrap) *fCacheOption {
@@ -30,6 +204,11 @@ func NewFCacheOption(opts ...FCOptionWrap) *fCacheOption {
 
 type FCOptionWrap func(o *fCacheOption)
 
+// needEnvelope 提前刷新及软过期依赖信封中记录的信息, 开启时需以信封格式写入存储值
+func (o *fCacheOption) needEnvelope() bool {
+	return o.earlyRefreshBeta > 0 || o.softTTL > 0
+}
+
 // WithLock 使用锁，防止缓存击穿
 func WithLock(lock sync.Locker) FCOptionWrap {
 	return func(option *fCacheOption) {
@@ -37,6 +216,45 @@ func WithLock(lock sync.Locker) FCOptionWrap {
 	}
 }
 
+// WithSingleFlight 按缓存key(hash类型包含subKey)合并并发的回源请求, 预防缓存击穿
+// 相同key并发未命中时只有一个请求回源, 其余请求共享回源结果, 不同key之间互不阻塞
+// 回源的请求因自身ctx超时或取消失败时, ctx仍有效的其余请求不共享该错误, 重新合并回源
+func WithSingleFlight() FCOptionWrap {
+	return func(option *fCacheOption) {
+		option.singleFlight = true
+	}
+}
+
+// WithDistributedLock 使用存储后端实现的分布式锁预防缓存击穿, 锁的key为缓存key(hash类型包含subKey)
+// 多实例并发未命中时只有拿到锁的请求回源, 其余请求轮询等待缓存写入; 持有者宕机时锁在租期后自动释放
+// 等待锁超时或存储后端异常时降级为直接回源
+func WithDistributedLock(opts ...dlock.OptionWrap) FCOptionWrap {
+	return func(option *fCacheOption) {
+		option.dLock = true
+		option.dLockOpts = opts
+	}
+}
+
+// WithEarlyRefresh 按XFetch算法提前刷新缓存, 缓存即将过期时少量请求提前回源, 热key过期时不会集中回源
+// 根据写入时记录的回源耗时及过期时间计算, 回源越慢、越接近过期, 提前刷新的概率越大; beta一般取1, 越大越倾向于提前刷新
+// 开启后以信封格式写入存储值; 仅从redis读取时判断, 命中本地缓存时不提前刷新
+func WithEarlyRefresh(beta float64) FCOptionWrap {
+	return func(option *fCacheOption) {
+		option.earlyRefreshBeta = beta
+	}
+}
+
+// WithStaleWhileRevalidate 开启软过期, 缓存信息中的过期时间为硬过期时间, softTTL需小于硬过期时间
+// 写入超过softTTL后读取时直接返回旧数据, 同时在后台刷新缓存(相同key同时只有一个后台刷新, 不使用本次调用的ctx)
+// 后台回源失败时继续返回旧数据直至硬过期, 保证回源故障期间(例如数据库不可用)仍可以提供服务
+// stale不为nil时记录本次返回的是否为旧数据; 开启后以信封格式写入存储值, 仅从redis读取时判断, 命中本地缓存时不判断
+func WithStaleWhileRevalidate(softTTL time.Duration, stale *bool) FCOptionWrap {
+	return func(option *fCacheOption) {
+		option.softTTL = softTTL
+		option.stale = stale
+	}
+}
+
 // WithNeedCacheNoData 需要缓存数据不存在，预防缓存穿透
 func WithNeedCacheNoData() FCOptionWrap {
 	return func(option *fCacheOption) {
@@ -44,6 +262,15 @@ func WithNeedCacheNoData() FCOptionWrap {
 	}
 }
 
+// WithNoDataTTL 指定数据不存在的过期时间, 搭配WithNeedCacheNoData使用, 数据被创建后可以更快地被读取到
+// string类型直接作为key的过期时间; hash类型的field共用key的过期时间, 以信封格式记录并在读取时判断是否过期
+// 写入本地缓存时不会超过本地缓存的过期时间; 指定后数据不存在以信封格式写入存储值
+func WithNoDataTTL(ttl time.Duration) FCOptionWrap {
+	return func(option *fCacheOption) {
+		option.noDataTTL = ttl
+	}
+}
+
 // WithUnMarshalData 需要将缓存结果反序列化
 func WithUnMarshalData(data interface{}) FCOptionWrap {
 	return func(option *fCacheOption) {
@@ -52,6 +279,9 @@ func WithUnMarshalData(data interface{}) FCOptionWrap {
 }
 
 // WithGetFromRdsCallBack 注册从redis获取数据的回调函数
+//
+// Deprecated: 回调中没有key、结果及耗时, 使用服务级别的WithSvcObserver替代
+// 回调在读取redis的协程中同步执行, 耗时的处理需自行异步执行(例如放入有界队列)
 func WithGetFromRdsCallBack(cb func()) FCOptionWrap {
 	return func(option *fCacheOption) {
 		option.getFromRdsCallBack = cb
@@ -64,3 +294,10 @@ func WithHotKeyOption(hotKeyOption *common.HotKeyOption) FCOptionWrap {
 		option.hotKeyOption = hotKeyOption
 	}
 }
+
+// WithCodec 指定本次调用的序列化方式, 同一个缓存key的读写需使用相同的序列化方式
+func WithCodec(c codec.ICodec) FCOptionWrap {
+	return func(option *fCacheOption) {
+		option.codec = c
+	}
+}
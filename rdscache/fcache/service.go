@@ -3,47 +3,80 @@ package fcache
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
 	"github.com/693490554/sponge/rdscache/common"
+	"github.com/693490554/sponge/rdscache/dlock"
+	"github.com/693490554/sponge/rdscache/logging"
+	"github.com/693490554/sponge/rdscache/observe"
+	"github.com/693490554/sponge/rdscache/tracing"
 	"github.com/go-redis/redis"
-	json "github.com/json-iterator/go"
 )
 
 // CF 需要缓存的函数闭包
+// @param ctx: GetOrCreate传入的ctx, 回源时需遵循ctx的超时及取消
 // @return interface{}: 函数返回值
 // @return error: 函数错误信息, 如果数据不存在需要返回ErrNoData
 // ErrNoData搭配可选项: WithNeedCacheNoData一起使用，预防缓存穿透
-type CF func() (interface{}, error)
+type CF func(ctx context.Context) (interface{}, error)
 
 type fCacheService struct {
-	rds *redis.Client // 使用redis作为缓存
+	store  backend.IBackend // 缓存存储后端, 默认使用redis
+	option *fCacheSvcOption
+	flight *common.SingleFlight // 按缓存key合并回源请求
+	// refreshing 按缓存key合并软过期后的后台刷新, 和flight分开, 后台刷新不影响同步回源的请求合并
+	refreshing *common.SingleFlight
 }
 
 // GetOrCreate 从缓存中获取缓存原始内容, 如果缓存不存在则将函数结果放入缓存
 func (s *fCacheService) GetOrCreate(
+	ctx context.Context, cacheInfo common.ICacheInfo, cacheFunc CF, opts ...FCOptionWrap) (string, error) {
+	ctx, span := s.option.tracer.StartCache(ctx, "sponge.fcache.GetOrCreate", cacheInfo)
+	res, err := s.getOrCreate(ctx, cacheInfo, cacheFunc, opts...)
+	tracing.End(span, err)
+	return res, err
+}
+
+func (s *fCacheService) getOrCreate(
 	ctx context.Context, cacheInfo common.ICacheInfo, cacheFunc CF, opts ...FCOptionWrap) (string, error) {
 	// 前置校验
 	err := common.CheckCacheInfo(cacheInfo)
 	if err != nil {
 		return "", err
 	}
+	// 在判断是否为热key之前记录访问, 使用分片方案时获取缓存会修改缓存key
+	if s.option.hotKeys != nil {
+		s.option.hotKeys.RecordCache(cacheInfo)
+	}
 	options := NewFCacheOption(opts...)
+	if options.codec == nil {
+		options.codec = s.option.codec
+	}
+	if options.stale != nil {
+		*options.stale = false
+	}
 
 	// 从缓存中获取
-	directReturn, res, err := s.get(ctx, cacheInfo, options)
+	directReturn, res, err := s.get(ctx, cacheInfo, cacheFunc, options)
 	if directReturn {
 		return res, err
 	}
 
-	// 需加锁获取，防止缓存击穿
+	// 需加锁获取，防止缓存击穿, 等待锁时ctx超时或取消则直接返回
 	if options.lock != nil {
-		options.lock.Lock()
+		startTs := time.Now()
+		err = common.LockWithCtx(ctx, options.lock)
+		s.notify(cacheInfo, observe.Event{Type: observe.EventLockWait, Duration: time.Since(startTs), Err: err})
+		if err != nil {
+			return "", err
+		}
 		defer options.lock.Unlock()
 
 		// 再从缓存中获取下，有则直接返回，没有代表第一个拿到锁的协程，需从函数中获取缓存信息
-		directReturn, res, err = s.get(ctx, cacheInfo, options)
+		directReturn, res, err = s.get(ctx, cacheInfo, cacheFunc, options)
 		if err != nil {
 			return "", err
 		}
@@ -52,9 +85,74 @@ func (s *fCacheService) GetOrCreate(
 		}
 	}
 
+	// 使用分布式锁, 多实例之间只有拿到锁的请求回源, 其余请求等待缓存写入
+	if options.dLock {
+		mutex := dlock.NewMutex(s.store, common.FullKey(cacheInfo), options.dLockOpts...)
+		var getErr error
+		startTs := time.Now()
+		locked, lockErr := mutex.LockOrWait(ctx, func() bool {
+			directReturn, res, getErr = s.get(ctx, cacheInfo, cacheFunc, options)
+			return directReturn
+		})
+		s.notify(cacheInfo, observe.Event{Type: observe.EventLockWait, Duration: time.Since(startTs), Err: lockErr})
+		switch {
+		case locked:
+			defer func() { _ = mutex.Unlock() }()
+			// 拿到锁后再从缓存中获取下, 锁可能是在其它实例写入缓存并释放后拿到的
+			directReturn, res, err = s.get(ctx, cacheInfo, cacheFunc, options)
+			if directReturn {
+				return res, err
+			}
+		case lockErr == nil:
+			// 等待期间其它实例已经写入了缓存
+			return res, getErr
+		case ctx.Err() != nil:
+			return "", ctx.Err()
+		}
+		// 等待锁超时或存储后端异常时, 降级为直接回源
+	}
+
+	// 从函数中获取缓存, 需要合并请求时相同key的并发请求共享回源结果
+	s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierOrigin))
+	if options.singleFlight {
+		var v interface{}
+		v, err = s.flight.Do(ctx, common.FullKey(cacheInfo), func() (interface{}, error) {
+			return s.create(ctx, cacheInfo, cacheFunc, options)
+		})
+		res, _ = v.(string)
+	} else {
+		res, err = s.create(ctx, cacheInfo, cacheFunc, options)
+	}
+	// 出错或无数据直接返回
+	if err != nil {
+		return res, err
+	}
+
+	// 不需要反序列化到data直接返回
+	if options.data == nil {
+		return res, nil
+	}
+
+	// 首次放入缓存需要反序列化在这里进行
+	err = options.codec.Unmarshal(res, options.data)
+	if err != nil {
+		s.unmarshalFail(ctx, cacheInfo, err)
+		return "", err
+	}
+
+	return res, nil
+}
+
+// create 从函数中获取数据并放入缓存, 返回缓存的内容, 数据不存在时返回ErrNoData
+func (s *fCacheService) create(
+	ctx context.Context, cacheInfo common.ICacheInfo, cacheFunc CF, options *fCacheOption) (string, error) {
 	var noDataErr error
-	// 从函数中获取缓存
-	funcRes, err := cacheFunc()
+	loadCtx, span := s.option.tracer.StartCache(ctx, "sponge.fcache.Load", cacheInfo)
+	startTs := time.Now()
+	funcRes, err := cacheFunc(loadCtx)
+	delta := time.Since(startTs)
+	tracing.End(span, err)
+	s.notify(cacheInfo, observe.Event{Type: observe.EventLoad, Duration: delta, Err: err})
 	if err != nil && err != rdscache.ErrNoData {
 		return "", err
 	}
@@ -69,34 +167,145 @@ func (s *fCacheService) GetOrCreate(
 	var cacheStr string
 	// 数据存在,将函数返回结果进行序列化; 数据如果不存在,则缓存空字符串
 	if noDataErr == nil {
-		cacheStr, err = json.MarshalToString(funcRes)
+		cacheStr, err = options.codec.Marshal(funcRes)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	// 放入缓存中
-	err = s.set(ctx, cacheInfo, cacheStr, options)
+	// 放入缓存中, 记录回源耗时用于提前刷新
+	envelope := common.NewEnvelope(cacheStr, noDataErr != nil)
+	envelope.Delta = delta
+	err = s.set(ctx, cacheInfo, envelope, options)
+	s.notify(cacheInfo, observe.Event{Type: observe.EventSet, Err: err})
 	if err != nil {
 		return "", err
 	}
+	return cacheStr, noDataErr
+}
 
-	// 不需要反序列化到data或无数据直接返回
-	if options.data == nil || noDataErr != nil {
-		return cacheStr, noDataErr
+// Refresh 回源并刷新缓存, 数据变更后使用, 可选项同GetOrCreate
+// 先删除缓存的全部副本(同Delete)再回源写入, 回源失败时缓存保持删除状态, 下次获取时重新回源
+func (s *fCacheService) Refresh(
+	ctx context.Context, cacheInfo common.ICacheInfo, cacheFunc CF, opts ...FCOptionWrap) (string, error) {
+	err := common.CheckCacheInfo(cacheInfo)
+	if err != nil {
+		return "", err
+	}
+	options := NewFCacheOption(opts...)
+	if options.codec == nil {
+		options.codec = s.option.codec
 	}
 
-	// 首次放入缓存需要反序列化在这里进行
-	err = json.UnmarshalFromString(cacheStr, options.data)
-	if err != nil {
+	if err = s.del(ctx, cacheInfo, options.hotKeyOption); err != nil {
 		return "", err
 	}
+	res, err := s.create(ctx, cacheInfo, cacheFunc, options)
+	if err != nil || options.data == nil {
+		return res, err
+	}
+	if err = options.codec.Unmarshal(res, options.data); err != nil {
+		s.unmarshalFail(ctx, cacheInfo, err)
+		return "", err
+	}
+	return res, nil
+}
+
+// Delete 删除缓存, hash类型只删除subKey对应的field
+// 传入热key选项(WithHotKeyOption)时同时删除当前实例的本地缓存及全部分片, 使用分片方案时需注册WithAllShardingKeys
+func (s *fCacheService) Delete(ctx context.Context, cacheInfo common.ICacheInfo, opts ...FCOptionWrap) error {
+	if err := common.CheckCacheInfo(cacheInfo); err != nil {
+		return err
+	}
+	return s.del(ctx, cacheInfo, NewFCacheOption(opts...).hotKeyOption)
+}
+
+// MDelete 批量删除缓存, 通过管道一次性发送, hash类型只删除subKey对应的field; 不处理热key(本地缓存及分片)
+// 热key需要同时删除本地缓存及全部分片时使用MDeleteEntries
+func (s *fCacheService) MDelete(ctx context.Context, cacheInfos ...common.ICacheInfo) error {
+	entries := make([]*common.DeleteEntry, 0, len(cacheInfos))
+	for _, cacheInfo := range cacheInfos {
+		entries = append(entries, common.NewDeleteEntry(cacheInfo, nil))
+	}
+	return s.MDeleteEntries(ctx, entries...)
+}
+
+// MDeleteEntries 批量删除缓存, 通过管道一次性发送, hash类型只删除subKey对应的field
+// 指定了热key选项的缓存同时删除当前实例的本地缓存及全部分片(同Delete), 使用分片方案时需注册WithAllShardingKeys
+func (s *fCacheService) MDeleteEntries(ctx context.Context, entries ...*common.DeleteEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	p := s.store.Pipeline(ctx)
+	defer func() { _ = p.Close() }()
+	localKeys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if err := common.CheckCacheInfo(entry.CacheInfo); err != nil {
+			return err
+		}
+		keys, localKey, err := common.DelKeys(entry.CacheInfo, entry.HotKeyOption)
+		if err != nil {
+			return err
+		}
+		if err = common.DelFromPipeline(p, entry.CacheInfo, keys...); err != nil {
+			return err
+		}
+		localKeys = append(localKeys, localKey)
+	}
+	if err := p.Exec(); err != nil {
+		return err
+	}
+	for _, localKey := range localKeys {
+		if err := s.publishInvalidation(ctx, localKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// del 删除缓存在redis中的全部副本(原始key及全部分片), 及当前实例的本地缓存
+func (s *fCacheService) del(
+	ctx context.Context, cacheInfo common.ICacheInfo, hotKeyOption *common.HotKeyOption) error {
+	keys, localKey, err := common.DelKeys(cacheInfo, hotKeyOption)
+	if err != nil {
+		return err
+	}
+
+	p := s.store.Pipeline(ctx)
+	defer func() { _ = p.Close() }()
+	if err = common.DelFromPipeline(p, cacheInfo, keys...); err != nil {
+		return err
+	}
+	if err = p.Exec(); err != nil {
+		return err
+	}
+	// redis中的数据删除后再通知其它实例, 防止其它实例删除本地缓存后又从redis中同步了旧数据
+	return s.publishInvalidation(ctx, localKey)
+}
 
-	return cacheStr, nil
+// publishInvalidation 通知其它实例删除本地缓存中的数据, 未指定失效总线或key为空时不通知
+func (s *fCacheService) publishInvalidation(ctx context.Context, localKey string) error {
+	if s.option.bus == nil || localKey == "" {
+		return nil
+	}
+	return s.option.bus.Publish(ctx, localKey)
+}
+
+// InvalidateTags 删除打上了tags中任一标签的全部缓存(hash类型只删除对应的field), 同时清理标签集合
+// 不处理本地缓存, 热key使用本地缓存时本地缓存中的数据在过期后失效
+func (s *fCacheService) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if err := common.InvalidateTag(ctx, s.store, tag, common.DelFromPipeline); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // get 从缓存中获取后，根据第一个值来判断是否需要直接返回结果
-func (s *fCacheService) get(ctx context.Context, cacheInfo common.ICacheInfo, option *fCacheOption) (
+// 超过软过期时间需要在后台刷新缓存, 因此需要传入cacheFunc
+func (s *fCacheService) get(
+	ctx context.Context, cacheInfo common.ICacheInfo, cacheFunc CF, option *fCacheOption) (
 	directReturn bool, res string, err error) {
 
 	directReturn = true
@@ -109,17 +318,13 @@ func (s *fCacheService) get(ctx context.Context, cacheInfo common.ICacheInfo, op
 			res, err = hotKeyOption.GetFromLocalCache()
 			// 存在数据(不存在数据时会报错，如果没有错误缓存中肯定是存在数据的)
 			if err == nil {
-				// 缓存了空直接返回
-				if res == common.CacheEmptyValue {
-					err = rdscache.ErrNoData
-				} else {
-					if option.data != nil {
-						err = json.UnmarshalFromString(res, option.data)
-					}
-				}
+				res, err = s.parseValue(res, option)
+				s.notifyRead(ctx, cacheInfo, observe.TierLocal, 0, true, err)
+				s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierLocal))
 			} else {
 				// 从本地缓存中没拿到，不可以直接返回，并且后续如果从redis中拿到了数据需要放入本地缓存中
 				directReturn, needSetToLocalCache = false, true
+				s.notifyRead(ctx, cacheInfo, observe.TierLocal, 0, false, nil)
 			}
 
 			if directReturn {
@@ -133,34 +338,177 @@ func (s *fCacheService) get(ctx context.Context, cacheInfo common.ICacheInfo, op
 
 	// 从redis缓存中获取
 	directReturn = true // 默认直接返回, 只有少数情况不可以直接返回
-	res, err = s.getFromRds(ctx, cacheInfo)
-	// rds访问回调函数, 异步执行
+	startTs := time.Now()
+	raw, err := s.getFromRds(ctx, cacheInfo)
+	duration := time.Since(startTs)
+	// rds访问回调函数, 在调用方的协程中同步执行
 	if option.getFromRdsCallBack != nil {
-		go option.getFromRdsCallBack()
+		option.getFromRdsCallBack()
 	}
 
 	if err != nil {
-		if err == redis.Nil {
+		if err == rdscache.ErrCacheNotExist {
 			directReturn, err = false, nil
 		}
+		s.notifyRead(ctx, cacheInfo, observe.TierRds, duration, false, err)
 	} else {
-		// 缓存了空返回无数据异常
-		if res == common.CacheEmptyValue {
-			err = rdscache.ErrNoData
-		} else {
-			if option.data != nil {
-				err = json.UnmarshalFromString(res, option.data)
-			}
+		directReturn, res, err = s.parseRdsValue(cacheInfo, raw, cacheFunc, option)
+		s.notifyRead(ctx, cacheInfo, observe.TierRds, duration, directReturn, err)
+		if directReturn {
+			s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierRds))
 		}
 	}
 
-	// 本地缓存失效，但是redis缓存存在时，需将数据同步至本地缓存
+	// 本地缓存失效，但是redis缓存存在时，需将数据同步至本地缓存, 本地缓存中存储的是原始的存储值
 	if directReturn && needSetToLocalCache {
-		err = hotKeyOption.SetToLocalCache(res)
+		if err == rdscache.ErrNoData {
+			err = hotKeyOption.SetNoDataToLocalCacheWithJitter(raw, s.noDataTTL(option), s.option.jitter)
+		} else {
+			err = hotKeyOption.SetToLocalCacheWithJitter(raw, s.option.jitter)
+		}
 	}
 	return
 }
 
+// notifyRead 通知观察者读取缓存的结果, hit为是否命中, 命中时err为解析存储值的错误(解析失败时记录日志), 未命中时err为访问redis的错误
+func (s *fCacheService) notifyRead(ctx context.Context,
+	cacheInfo common.ICacheInfo, tier observe.Tier, duration time.Duration, hit bool, err error) {
+	e := observe.Event{Type: observe.EventHit, Tier: tier, Duration: duration}
+	switch {
+	case !hit:
+		e.Type, e.Err = observe.EventMiss, err
+	case err == rdscache.ErrNoData:
+		e.Type = observe.EventNoDataHit
+	case err != nil:
+		// 命中但存储值解析失败, 先通知命中再记录反序列化失败
+		s.notify(cacheInfo, e)
+		s.unmarshalFail(ctx, cacheInfo, err)
+		return
+	}
+	s.notify(cacheInfo, e)
+}
+
+// unmarshalFail 记录反序列化(解析存储值)失败的日志并通知观察者
+func (s *fCacheService) unmarshalFail(ctx context.Context, cacheInfo common.ICacheInfo, err error) {
+	s.log(ctx, logging.LevelError, "sponge: unmarshal cache value fail", cacheInfo, err)
+	s.notify(cacheInfo, observe.Event{Type: observe.EventUnmarshalFail, Err: err})
+}
+
+// log 记录日志, 字段包含命名空间、缓存key(hash类型包含subKey)及错误, 不包含缓存的内容
+func (s *fCacheService) log(ctx context.Context, level logging.Level, msg string, cacheInfo common.ICacheInfo, err error) {
+	fields := make([]logging.Field, 0, 4)
+	if s.option.namespace != nil {
+		fields = append(fields, logging.Any("namespace", s.option.namespace.Name()))
+	}
+	fields = append(fields, logging.Any("key", cacheInfo.BaseInfo().Key))
+	if c, ok := cacheInfo.(*common.HashCache); ok {
+		fields = append(fields, logging.Any("sub_key", c.SubKey))
+	}
+	s.option.logger.Log(ctx, level, msg, append(fields, logging.Err(err))...)
+}
+
+// notify 通知观察者, 补充事件的命名空间及缓存key, 未指定观察者时不通知
+func (s *fCacheService) notify(cacheInfo common.ICacheInfo, e observe.Event) {
+	if s.option.observer == nil {
+		return
+	}
+	if s.option.namespace != nil {
+		e.Namespace = s.option.namespace.Name()
+	}
+	e.Key = cacheInfo.BaseInfo().Key
+	if c, ok := cacheInfo.(*common.HashCache); ok {
+		e.SubKey = c.SubKey
+	}
+	s.option.observer.Observe(e)
+}
+
+// parseRdsValue 解析从redis中获取的存储值, 根据第一个值来判断是否需要直接返回结果
+// 超过软过期时间时返回旧数据并在后台刷新缓存; 否则按XFetch算法判断是否需要提前刷新
+func (s *fCacheService) parseRdsValue(
+	cacheInfo common.ICacheInfo, raw string, cacheFunc CF, option *fCacheOption) (bool, string, error) {
+	envelope, err := common.DecodeEnvelope(raw)
+	if err != nil {
+		return true, "", err
+	}
+	if envelope.NoData() && envelope.Expired() {
+		// 数据不存在超过单独指定的过期时间(hash类型的field), 视为缓存不存在
+		return false, "", nil
+	}
+	if envelope.SoftExpired(option.softTTL) {
+		s.refreshInBackground(cacheInfo, cacheFunc, option)
+		if option.stale != nil {
+			*option.stale = true
+		}
+	} else if envelope.ShouldRefreshEarly(option.earlyRefreshBeta) {
+		// 按XFetch算法提前刷新, 缓存即将过期时少量请求提前回源, 热key过期时不会集中回源
+		return false, "", nil
+	}
+	res, err := s.parseEnvelope(envelope, option)
+	return true, res, err
+}
+
+// refreshInBackground 在后台回源并刷新缓存, 相同key同时只有一个后台刷新
+// 调用方返回后ctx可能被取消, 后台刷新不使用调用方的ctx; 回源失败时不更新缓存, 旧数据继续生效直至硬过期
+// 调用方返回后仍会读写缓存信息及可选项, 后台刷新使用它们的拷贝
+func (s *fCacheService) refreshInBackground(cacheInfo common.ICacheInfo, cacheFunc CF, option *fCacheOption) {
+	cacheInfo = common.CopyCacheInfo(cacheInfo)
+	refreshOption := *option
+	refreshOption.stale, refreshOption.data = nil, nil
+	s.refreshing.Go(common.FullKey(cacheInfo), func() {
+		ctx := context.Background()
+		if _, err := s.create(ctx, cacheInfo, cacheFunc, &refreshOption); err != nil && err != rdscache.ErrNoData {
+			s.log(ctx, logging.LevelError, "sponge: refresh in background fail", cacheInfo, err)
+		}
+	}, func(p interface{}) {
+		s.log(context.Background(), logging.LevelError, "sponge: refresh in background panic",
+			cacheInfo, fmt.Errorf("panic: %v", p))
+	})
+}
+
+// parseValue 解析存储值, 缓存了空返回无数据异常, 需要时将缓存内容反序列化到data中
+func (s *fCacheService) parseValue(raw string, option *fCacheOption) (string, error) {
+	envelope, err := common.DecodeEnvelope(raw)
+	if err != nil {
+		return "", err
+	}
+	return s.parseEnvelope(envelope, option)
+}
+
+// parseEnvelope 缓存了空返回无数据异常, 需要时将缓存内容反序列化到data中
+func (s *fCacheService) parseEnvelope(envelope *common.Envelope, option *fCacheOption) (string, error) {
+	var err error
+	if envelope.NoData() {
+		return common.CacheEmptyValue, rdscache.ErrNoData
+	}
+	if option.data != nil {
+		err = option.codec.Unmarshal(envelope.Value, option.data)
+	}
+	return envelope.Value, err
+}
+
+// encodeValue 将缓存内容转换为存储值, 开启信封格式、提前刷新或软过期时写入信封并记录过期时间
+// 否则写入原始的缓存内容, 数据不存在时写入CacheEmptyValue
+func (s *fCacheService) encodeValue(envelope *common.Envelope, expTime time.Duration, needEnvelope bool) string {
+	if !s.option.envelope && !needEnvelope {
+		if envelope.NoData() {
+			return common.CacheEmptyValue
+		}
+		return envelope.Value
+	}
+	if expTime > 0 {
+		envelope.ExpireAt = envelope.CreatedAt.Add(expTime)
+	}
+	return envelope.Encode()
+}
+
+// noDataTTL 数据不存在的过期时间, 优先使用单次调用指定的, 均未指定时为0
+func (s *fCacheService) noDataTTL(option *fCacheOption) time.Duration {
+	if option.noDataTTL > 0 {
+		return option.noDataTTL
+	}
+	return s.option.noDataTTL
+}
+
 // getFromRds 从redis中获取缓存的数据
 func (s *fCacheService) getFromRds(ctx context.Context, cacheInfo common.ICacheInfo) (string, error) {
 	switch cacheInfo := cacheInfo.(type) {
@@ -175,17 +523,17 @@ func (s *fCacheService) getFromRds(ctx context.Context, cacheInfo common.ICacheI
 
 // getFromString 从string中获取数据
 func (s *fCacheService) getFromString(ctx context.Context, key string) (string, error) {
-	return s.rds.Get(key).Result()
+	return s.store.Get(ctx, key)
 }
 
 // getFromHash 从hash中获取数据
 func (s *fCacheService) getFromHash(ctx context.Context, key string, sk string) (string, error) {
-	return s.rds.HGet(key, sk).Result()
+	return s.store.HGet(ctx, key, sk)
 }
 
-// set 将数据放入缓存
+// set 将缓存内容放入缓存
 func (s *fCacheService) set(
-	ctx context.Context, cacheInfo common.ICacheInfo, cacheStr string, option *fCacheOption) error {
+	ctx context.Context, cacheInfo common.ICacheInfo, envelope *common.Envelope, option *fCacheOption) error {
 	var err error
 
 	// 首先判断是否需要进行hot key处理
@@ -201,31 +549,52 @@ func (s *fCacheService) set(
 		}
 	}
 
+	// 过期时间增加随机抖动, 防止同时写入的缓存同时过期
+	expTime := cacheInfo.BaseInfo().JitterExpTime(s.option.jitter)
+	// 数据不存在时使用单独指定的过期时间, hash类型的field共用key的过期时间, 因此记录在信封中
+	valueExpTime, needEnvelope := expTime, option.needEnvelope()
+	noDataTTL := s.noDataTTL(option)
+	if envelope.NoData() && noDataTTL > 0 {
+		valueExpTime, needEnvelope = cacheInfo.BaseInfo().NoDataExpTime(noDataTTL, s.option.jitter), true
+	}
+	cacheStr := s.encodeValue(envelope, valueExpTime, needEnvelope)
+
 	if needSetToLocalCache {
-		_ = hotKeyOption.SetToLocalCache(cacheStr)
+		var localErr error
+		if envelope.NoData() {
+			localErr = hotKeyOption.SetNoDataToLocalCacheWithJitter(cacheStr, noDataTTL, s.option.jitter)
+		} else {
+			localErr = hotKeyOption.SetToLocalCacheWithJitter(cacheStr, s.option.jitter)
+		}
+		// 写入本地缓存失败不影响写入redis, 下次读取时从redis同步至本地缓存
+		if localErr != nil {
+			s.log(ctx, logging.LevelWarn, "sponge: set local cache fail", cacheInfo, localErr)
+		}
 	}
 
+	// 先记录标签再写入缓存, 防止两者之间删除标签时遗漏本次写入的缓存
+	if err = common.RecordTags(ctx, s.store, common.TagRecord{CacheInfo: cacheInfo, ExpTime: expTime}); err != nil {
+		return err
+	}
 	switch cacheInfo := cacheInfo.(type) {
 	case *common.StringCache:
-		err = s.setToString(ctx, cacheInfo.Key, cacheStr, cacheInfo.ExpTime)
+		return s.setToString(ctx, cacheInfo.Key, cacheStr, valueExpTime)
 	case *common.HashCache:
-		err = s.setToHash(ctx, cacheInfo.Key, cacheInfo.SubKey, cacheStr, cacheInfo.ExpTime)
+		return s.setToHash(ctx, cacheInfo.Key, cacheInfo.SubKey, cacheStr, expTime)
 	default:
-		err = errors.New("unknown KT")
+		return errors.New("unknown KT")
 	}
-	return err
 }
 
 // setToString 向string中设置缓存数据
 func (s *fCacheService) setToString(ctx context.Context, key string, res string, expTime time.Duration) error {
-	_, err := s.rds.Set(key, res, expTime).Result()
-	return err
+	return s.store.Set(ctx, key, res, expTime)
 }
 
 // setToHash 向hash中设置缓存数据
 func (s *fCacheService) setToHash(
 	ctx context.Context, key string, sk string, res string, expTime time.Duration) error {
-	_, err := s.rds.HSet(key, sk, res).Result()
+	err := s.store.HSet(ctx, key, sk, res)
 	if err != nil {
 		return err
 	}
@@ -233,13 +602,35 @@ func (s *fCacheService) setToHash(
 	if expTime <= 0 {
 		return nil
 	}
-	_, err = s.rds.Expire(key, expTime).Result()
-	return err
+	return s.store.Expire(ctx, key, expTime)
 }
 
-func NewFCacheService(rds *redis.Client) (*fCacheService, error) {
+func NewFCacheService(rds *redis.Client, opts ...FCSvcOptionWrap) (*fCacheService, error) {
 	if rds == nil {
 		return nil, errors.New("redis must not nil")
 	}
-	return &fCacheService{rds: rds}, nil
+	return NewFCacheServiceWithBackend(backend.NewRedisBackend(rds), opts...)
+}
+
+// NewFCacheServiceWithBackend 使用指定的存储后端创建函数缓存服务, 例如redis集群、哨兵等
+func NewFCacheServiceWithBackend(store backend.IBackend, opts ...FCSvcOptionWrap) (*fCacheService, error) {
+	if store == nil {
+		return nil, errors.New("backend must not nil")
+	}
+	option := newFCacheSvcOption(opts...)
+	// 链路追踪在最内层, span中记录的是实际访问存储后端的key
+	store = tracing.NewBackend(store, option.tracer)
+	// 先包装key空间再包装命名空间, 实际的key为: key空间前缀 命名空间前缀 key
+	if option.keySpace != nil {
+		store = backend.NewPrefixBackend(store, option.keySpace)
+	}
+	if option.namespace != nil {
+		store = backend.NewPrefixBackend(store, option.namespace)
+	}
+	return &fCacheService{
+		store:      backend.NewTransformBackend(store, option.transformers()...),
+		option:     option,
+		flight:     common.NewSingleFlight(),
+		refreshing: common.NewSingleFlight(),
+	}, nil
 }
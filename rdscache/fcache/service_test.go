@@ -6,11 +6,20 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+	"github.com/693490554/sponge/rdscache/codec"
 	"github.com/693490554/sponge/rdscache/common"
+	"github.com/693490554/sponge/rdscache/dlock"
+	"github.com/693490554/sponge/rdscache/hotkey"
+	"github.com/693490554/sponge/rdscache/invalidate"
+	"github.com/693490554/sponge/rdscache/logging"
+	"github.com/693490554/sponge/rdscache/namespace"
+	"github.com/693490554/sponge/rdscache/observe"
 	"github.com/allegro/bigcache"
 	. "github.com/glycerine/goconvey/convey"
 	"github.com/go-redis/redis"
@@ -24,6 +33,7 @@ var (
 	})
 	fcSvc, _ = NewFCacheService(rds)
 	rk       = "test"
+	rk2      = "test_02"
 	sk       = "subKey"
 	lock     = &sync.Mutex{}
 	shardKey = rk + "_01"
@@ -32,6 +42,7 @@ var (
 func delTestData() {
 	rds.Del(rk)
 	rds.Del(shardKey)
+	rds.Del(rk2)
 }
 
 func TestMain(m *testing.M) {
@@ -52,7 +63,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 		Convey("需要反序列化到data:函数返回结果为nil", func() {
 			var data *struct{}
 			So(data, ShouldBeNil)
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, rdscache.ErrNoData
 			}, WithUnMarshalData(data))
 			So(ret, ShouldEqual, "")
@@ -61,7 +72,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 		})
 
 		Convey("首次获取:函数无error并且返回nil:无需缓存零值的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, nil
 			})
 			So(ret, ShouldEqual, "null")
@@ -73,7 +84,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 		})
 
 		Convey("首次获取:函数无error并且返回nil:需缓存零值的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, nil
 			}, WithNeedCacheNoData())
 			So(ret, ShouldEqual, "null")
@@ -85,7 +96,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 		})
 
 		Convey("首次获取:函数返回error的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, errors.New("")
 			})
 			So(ret, ShouldEqual, "")
@@ -93,7 +104,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 		})
 
 		Convey("首次获取:函数正常返回struct:不需要序列化到data的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return struct {
 					A int
 					B string
@@ -113,7 +124,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 			}
 			data := &testS{}
 			funcRet := &testS{1, "test"}
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			}, WithUnMarshalData(data), WithLock(lock))
 			So(err, ShouldBeNil)
@@ -138,7 +149,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 			data := &testS{}
 			funcRet := &testS{1, "test"}
 			for i := 1; i <= 2; i++ {
-				ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+				ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return funcRet, nil
 				}, WithUnMarshalData(data), WithLock(lock))
 				So(ret, ShouldNotEqual, "")
@@ -165,11 +176,11 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 				lock.Unlock()
 			}()
 			go func() {
-				_, _ = fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+				_, _ = fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return funcRet, nil
 				}, WithLock(lock))
 			}()
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			}, WithLock(lock))
 			So(ret, ShouldNotEqual, "")
@@ -186,7 +197,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 				B string `json:"b"`
 			}
 			funcRet := &testS{1, "test"}
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			}, WithLock(lock))
 			So(ret, ShouldNotEqual, "")
@@ -210,7 +221,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 			newCtx, cFunc := context.WithTimeout(context.Background(), time.Second*2)
 			defer cFunc()
 			go func() {
-				_, _ = fcSvc.GetOrCreate(newCtx, cacheInfo, func() (interface{}, error) {
+				_, _ = fcSvc.GetOrCreate(newCtx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return funcRet, nil
 				}, WithLock(lock))
 			}()
@@ -222,7 +233,7 @@ func Test_fCacheService_GetFromString(t *testing.T) {
 			}
 			// 释放锁后可正常获取
 			lock.Unlock()
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			})
 			So(ret, ShouldNotEqual, "")
@@ -249,7 +260,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 		})
 
 		Convey("首次获取:函数无error并且返回nil:无需缓存零值的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, nil
 			})
 			So(ret, ShouldEqual, "null")
@@ -261,7 +272,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 		})
 
 		Convey("获取2次:函数无error并且返回nil和no data:需缓存零值的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, rdscache.ErrNoData
 			}, WithNeedCacheNoData())
 			So(ret, ShouldEqual, "")
@@ -272,7 +283,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 			So(tmp, ShouldEqual, "")
 
 			// 再获取一次
-			ret, err = fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err = fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, rdscache.ErrNoData
 			}, WithNeedCacheNoData())
 			So(ret, ShouldEqual, "")
@@ -280,7 +291,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 		})
 
 		Convey("首次获取:函数返回error的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return nil, errors.New("")
 			})
 			So(ret, ShouldEqual, "")
@@ -288,7 +299,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 		})
 
 		Convey("首次获取:函数正常返回struct:不需要序列化到data的情况", func() {
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return struct {
 					A int
 					B string
@@ -308,7 +319,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 			}
 			data := &testS{}
 			funcRet := &testS{1, "test"}
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			}, WithUnMarshalData(data), WithLock(lock))
 			So(ret, ShouldNotEqual, "")
@@ -336,7 +347,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 			data := &testS{}
 			funcRet := &testS{1, "test"}
 			for i := 1; i <= 2; i++ {
-				ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+				ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return funcRet, nil
 				}, WithUnMarshalData(data), WithLock(lock))
 				So(ret, ShouldNotEqual, "")
@@ -356,7 +367,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 				B string `json:"b"`
 			}
 			funcRet := &testS{1, "test"}
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			}, WithLock(lock))
 			So(ret, ShouldNotEqual, "")
@@ -381,7 +392,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 			newCtx, cFunc := context.WithTimeout(context.Background(), time.Second*2)
 			defer cFunc()
 			go func() {
-				_, _ = fcSvc.GetOrCreate(newCtx, cacheInfo, func() (interface{}, error) {
+				_, _ = fcSvc.GetOrCreate(newCtx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return funcRet, rdscache.ErrNoData
 				}, WithLock(lock))
 			}()
@@ -393,7 +404,7 @@ func Test_fCacheService_GetFromHash(t *testing.T) {
 			}
 			// 释放锁后可正常获取
 			lock.Unlock()
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return funcRet, nil
 			})
 			So(ret, ShouldNotEqual, "")
@@ -416,7 +427,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 				common.WithIsHotKey(func() bool { return false }),
 				common.WithGetShardingKey(func() string { return shardKey }))
 
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return "test", nil
 			}, WithHotKeyOption(hotKeyOption))
 			So(err, ShouldBeNil)
@@ -430,7 +441,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 			// 热key判定结果为true
 			hotKeyOption, _ = common.NewHotKeyOption(
 				common.WithGetShardingKey(func() string { return shardKey }))
-			_, err = fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			_, err = fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return "test", nil
 			}, WithHotKeyOption(hotKeyOption))
 			So(err, ShouldBeNil)
@@ -453,7 +464,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 				}))
 
 			// 第一次获取，会将回源数据放入到redis和localCache中
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return "test", nil
 			}, WithHotKeyOption(hotKeyOption))
 			So(err, ShouldBeNil)
@@ -470,7 +481,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 
 			// 再次获取，走本地缓存, 测试下将数据反序列化到data中
 			var data string
-			ret, err = fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err = fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return "test", nil
 			}, WithHotKeyOption(hotKeyOption), WithUnMarshalData(&data))
 			So(err, ShouldBeNil)
@@ -491,7 +502,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 			// 本地缓存已失效，但是redis缓存未失效
 			// 第一次获取会将redis缓存放入本地缓存
 			ret, err = fcSvc.GetOrCreate(
-				ctx, cacheInfo, func() (interface{}, error) {
+				ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return "test", nil
 				}, WithHotKeyOption(hotKeyOption))
 			So(err, ShouldBeNil)
@@ -499,7 +510,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 
 			// 再获取一次直接走本地缓存，仍可正常获取
 			ret, err = fcSvc.GetOrCreate(
-				ctx, cacheInfo, func() (interface{}, error) {
+				ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 					return "test", nil
 				}, WithHotKeyOption(hotKeyOption))
 			So(err, ShouldBeNil)
@@ -512,7 +523,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 			wrapGoCache := common.NewWrapGoCache(goCache.New(time.Second, time.Second))
 			hotKeyOption, _ := common.NewHotKeyOption(
 				common.WithLocalCache(wrapGoCache, cacheBase))
-			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err := fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return "", rdscache.ErrNoData
 			}, WithHotKeyOption(hotKeyOption), WithNeedCacheNoData(), WithGetFromRdsCallBack(func() {
 				fmt.Printf("i am a callback")
@@ -521,7 +532,7 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 			So(ret, ShouldEqual, "")
 
 			// 再获取一次直接走本地缓存
-			ret, err = fcSvc.GetOrCreate(ctx, cacheInfo, func() (interface{}, error) {
+			ret, err = fcSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
 				return "", rdscache.ErrNoData
 			}, WithHotKeyOption(hotKeyOption), WithNeedCacheNoData())
 			So(err, ShouldEqual, rdscache.ErrNoData)
@@ -539,3 +550,638 @@ func Test_fCacheService_HandleHotKey(t *testing.T) {
 
 	})
 }
+
+// failSetBackend 写入string缓存总是失败的存储后端
+type failSetBackend struct {
+	*backend.MemoryBackend
+}
+
+func (b *failSetBackend) Set(ctx context.Context, key, value string, expTime time.Duration) error {
+	return errors.New("set fail")
+}
+
+func Test_fCacheService_MemoryBackend(t *testing.T) {
+	memStore := backend.NewMemoryBackend()
+	memSvc, _ := NewFCacheServiceWithBackend(memStore)
+
+	Convey("使用进程内存储后端, 无需redis", t, func() {
+		memStore.Flush()
+
+		Convey("未传入存储后端", func() {
+			_, err := NewFCacheServiceWithBackend(nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("string缓存:首次回源放入缓存, 再次获取直接从缓存中获取", func() {
+			type testS struct {
+				A int `json:"a"`
+			}
+			cacheInfo := common.NewStringCache(rk, time.Second*10)
+			callCnt := 0
+			cf := func(ctx context.Context) (interface{}, error) {
+				callCnt++
+				return &testS{A: 1}, nil
+			}
+			for i := 0; i < 2; i++ {
+				data := &testS{}
+				ret, err := memSvc.GetOrCreate(ctx, cacheInfo, cf, WithUnMarshalData(data))
+				So(err, ShouldBeNil)
+				So(ret, ShouldEqual, `{"a":1}`)
+				So(data.A, ShouldEqual, 1)
+			}
+			So(callCnt, ShouldEqual, 1)
+			So(memStore.TTL(rk), ShouldBeGreaterThan, 9*time.Second)
+		})
+
+		Convey("观察者:通知命中、未命中、回源、写入及反序列化失败, 事件中包含key及命名空间", func() {
+			var events []observe.Event
+			ns := namespace.MustNew(memStore, "obs")
+			obsSvc, _ := NewFCacheServiceWithBackend(memStore, WithSvcNamespace(ns),
+				WithSvcObserver(observe.ObserverFunc(func(e observe.Event) {
+					events = append(events, e)
+				})))
+			cf := func(ctx context.Context) (interface{}, error) {
+				return 1, nil
+			}
+			types := func() []observe.EventType {
+				var ret []observe.EventType
+				for _, e := range events {
+					ret = append(ret, e.Type)
+				}
+				events = nil
+				return ret
+			}
+
+			cacheInfo := common.NewStringCache(rk, time.Second*10)
+			_, _ = obsSvc.GetOrCreate(ctx, cacheInfo, cf)
+			So(events[0].Key, ShouldEqual, rk)
+			So(events[0].Namespace, ShouldEqual, "obs")
+			So(events[0].Tier, ShouldEqual, observe.TierRds)
+			So(types(), ShouldResemble, []observe.EventType{observe.EventMiss, observe.EventLoad, observe.EventSet})
+			_, _ = obsSvc.GetOrCreate(ctx, cacheInfo, cf)
+			So(types(), ShouldResemble, []observe.EventType{observe.EventHit})
+
+			_ = memStore.Set(ctx, "obs:0:"+rk, "not json", 0)
+			_, err := obsSvc.GetOrCreate(ctx, cacheInfo, cf, WithUnMarshalData(new(int)))
+			So(err, ShouldNotBeNil)
+			So(types(), ShouldResemble, []observe.EventType{observe.EventHit, observe.EventUnmarshalFail})
+
+			// 本地缓存命中及数据不存在
+			hashInfo := common.NewHashCache(rk2, sk, time.Second*10)
+			localCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+			hotKeyOption, _ := common.NewHotKeyOption(
+				common.WithLocalCache(localCache, common.NewCacheBase(rk2, time.Minute)))
+			noDataCf := func(ctx context.Context) (interface{}, error) {
+				return nil, rdscache.ErrNoData
+			}
+			for i := 0; i < 2; i++ {
+				_, _ = obsSvc.GetOrCreate(ctx, hashInfo, noDataCf, WithNeedCacheNoData(), WithHotKeyOption(hotKeyOption))
+			}
+			So(events[0].SubKey, ShouldEqual, sk)
+			So(events[0].Tier, ShouldEqual, observe.TierLocal)
+			So(types(), ShouldResemble, []observe.EventType{observe.EventMiss, observe.EventMiss,
+				observe.EventLoad, observe.EventSet, observe.EventNoDataHit})
+		})
+
+		Convey("热key探测器:访问次数达到阈值后使用本地缓存", func() {
+			detector := hotkey.NewDetector(hotkey.WithThreshold(3))
+			hotSvc, _ := NewFCacheServiceWithBackend(memStore, WithSvcHotKeyDetector(detector))
+			cacheInfo := common.NewStringCache(rk, time.Minute)
+			localCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+			hotKeyOption, _ := common.NewHotKeyOption(common.WithIsHotKey(detector.Predicate(cacheInfo)),
+				common.WithLocalCache(localCache, common.NewCacheBase(rk, time.Minute)))
+			cf := func(ctx context.Context) (interface{}, error) {
+				return 1, nil
+			}
+
+			for i := 0; i < 2; i++ {
+				_, err := hotSvc.GetOrCreate(ctx, cacheInfo, cf, WithHotKeyOption(hotKeyOption))
+				So(err, ShouldBeNil)
+			}
+			_, err := localCache.Get(rk)
+			So(err, ShouldNotBeNil)
+
+			// 第三次访问达到阈值, 从redis同步至本地缓存
+			_, err = hotSvc.GetOrCreate(ctx, cacheInfo, cf, WithHotKeyOption(hotKeyOption))
+			So(err, ShouldBeNil)
+			v, err := localCache.Get(rk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "1")
+		})
+
+		Convey("指定服务默认的序列化方式及单次调用的序列化方式", func() {
+			type testS struct {
+				A int
+			}
+			cf := func(ctx context.Context) (interface{}, error) {
+				return &testS{A: 1}, nil
+			}
+			msgpackSvc, _ := NewFCacheServiceWithBackend(memStore, WithSvcCodec(codec.NewMsgpackCodec()))
+			for i := 0; i < 2; i++ {
+				data := &testS{}
+				ret, err := msgpackSvc.GetOrCreate(ctx, common.NewStringCache(rk, 0), cf, WithUnMarshalData(data))
+				So(err, ShouldBeNil)
+				So(data.A, ShouldEqual, 1)
+				expect, _ := codec.NewMsgpackCodec().Marshal(&testS{A: 1})
+				So(ret, ShouldEqual, expect)
+			}
+
+			// 单次调用指定的序列化方式优先
+			for i := 0; i < 2; i++ {
+				data := &testS{}
+				ret, err := msgpackSvc.GetOrCreate(
+					ctx, common.NewStringCache(rk2, 0), cf, WithUnMarshalData(data), WithCodec(codec.NewGobCodec()))
+				So(err, ShouldBeNil)
+				So(data.A, ShouldEqual, 1)
+				expect, _ := codec.NewGobCodec().Marshal(&testS{A: 1})
+				So(ret, ShouldEqual, expect)
+			}
+		})
+
+		Convey("ctx传递至回源函数, ctx取消后不再访问存储后端及回源", func() {
+			type ctxKey struct{}
+			cacheInfo := common.NewStringCache(rk, time.Second*10)
+			valueCtx := context.WithValue(ctx, ctxKey{}, "v")
+			ret, err := memSvc.GetOrCreate(valueCtx, cacheInfo, func(ctx context.Context) (interface{}, error) {
+				return ctx.Value(ctxKey{}), nil
+			})
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, `"v"`)
+
+			memStore.Flush()
+			cancelCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			called := false
+			_, err = memSvc.GetOrCreate(cancelCtx, cacheInfo, func(ctx context.Context) (interface{}, error) {
+				called = true
+				return nil, nil
+			})
+			So(err, ShouldEqual, context.Canceled)
+			So(called, ShouldBeFalse)
+		})
+
+		Convey("等待锁时ctx超时直接返回", func() {
+			cacheInfo := common.NewStringCache(rk, time.Second*10)
+			lock.Lock()
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+			defer cancel()
+			_, err := memSvc.GetOrCreate(timeoutCtx, cacheInfo, func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			}, WithLock(lock))
+			So(err, ShouldEqual, context.DeadlineExceeded)
+			lock.Unlock()
+		})
+
+		Convey("hash缓存:缓存无数据, 预防缓存穿透", func() {
+			cacheInfo := common.NewHashCache(rk, sk, time.Second*10)
+			callCnt := 0
+			cf := func(ctx context.Context) (interface{}, error) {
+				callCnt++
+				return nil, rdscache.ErrNoData
+			}
+			for i := 0; i < 2; i++ {
+				ret, err := memSvc.GetOrCreate(ctx, cacheInfo, cf, WithNeedCacheNoData())
+				So(err, ShouldEqual, rdscache.ErrNoData)
+				So(ret, ShouldEqual, common.CacheEmptyValue)
+			}
+			So(callCnt, ShouldEqual, 1)
+			v, err := memStore.HGet(ctx, rk, sk)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, common.CacheEmptyValue)
+		})
+
+		Convey("数据不存在使用单独指定的过期时间", func() {
+			callCnt := 0
+			cf := func(ctx context.Context) (interface{}, error) {
+				callCnt++
+				return nil, rdscache.ErrNoData
+			}
+			// string类型直接作为key的过期时间, 单次调用指定的优先
+			svc, _ := NewFCacheServiceWithBackend(memStore, WithSvcNoDataTTL(time.Minute))
+			_, err := svc.GetOrCreate(ctx, common.NewStringCache(rk, time.Hour), cf, WithNeedCacheNoData())
+			So(err, ShouldEqual, rdscache.ErrNoData)
+			So(memStore.TTL(rk), ShouldBeBetweenOrEqual, time.Minute-time.Second, time.Minute)
+			_, _ = svc.GetOrCreate(ctx, common.NewStringCache(rk+"1", time.Hour), cf,
+				WithNeedCacheNoData(), WithNoDataTTL(time.Second*10))
+			So(memStore.TTL(rk+"1"), ShouldBeBetweenOrEqual, time.Second*9, time.Second*10)
+
+			// hash类型的field共用key的过期时间, 过期时间记录在信封中
+			cacheInfo := common.NewHashCache(rk+"2", sk, time.Hour)
+			_, err = svc.GetOrCreate(ctx, cacheInfo, cf, WithNeedCacheNoData())
+			So(err, ShouldEqual, rdscache.ErrNoData)
+			So(memStore.TTL(rk+"2"), ShouldBeGreaterThan, time.Minute)
+			v, _ := memStore.HGet(ctx, rk+"2", sk)
+			envelope, err := common.DecodeEnvelope(v)
+			So(err, ShouldBeNil)
+			So(envelope.NoData(), ShouldBeTrue)
+			So(envelope.ExpireAt.Sub(time.Now()), ShouldBeLessThanOrEqualTo, time.Minute)
+			_, _ = svc.GetOrCreate(ctx, cacheInfo, cf, WithNeedCacheNoData())
+			So(callCnt, ShouldEqual, 3)
+
+			// 超过单独指定的过期时间, 视为缓存不存在重新回源
+			envelope.ExpireAt = time.Now()
+			_ = memStore.HSet(ctx, rk+"2", sk, envelope.Encode())
+			_, _ = svc.GetOrCreate(ctx, cacheInfo, cf, WithNeedCacheNoData())
+			So(callCnt, ShouldEqual, 4)
+		})
+
+		Convey("信封格式:区分缓存的数据不存在和序列化结果为空字符串的真实数据", func() {
+			envelopeSvc, _ := NewFCacheServiceWithBackend(
+				memStore, WithSvcEnvelope(), WithSvcCodec(rawStringCodec{}))
+			cf := func(ctx context.Context) (interface{}, error) {
+				return "", nil
+			}
+			for i := 0; i < 2; i++ {
+				ret, err := envelopeSvc.GetOrCreate(ctx, common.NewStringCache(rk, 0), cf)
+				So(err, ShouldBeNil)
+				So(ret, ShouldEqual, "")
+			}
+
+			// 未开启信封格式时, 空字符串被当作缓存了空
+			rawSvc, _ := NewFCacheServiceWithBackend(memStore, WithSvcCodec(rawStringCodec{}))
+			_, err := rawSvc.GetOrCreate(ctx, common.NewStringCache(rk2, 0), cf)
+			So(err, ShouldBeNil)
+			_, err = rawSvc.GetOrCreate(ctx, common.NewStringCache(rk2, 0), cf)
+			So(err, ShouldEqual, rdscache.ErrNoData)
+
+			// 缓存数据不存在
+			memStore.Flush()
+			cacheInfo := common.NewHashCache(rk, sk, 0)
+			noDataCf := func(ctx context.Context) (interface{}, error) {
+				return nil, rdscache.ErrNoData
+			}
+			for i := 0; i < 2; i++ {
+				_, err = envelopeSvc.GetOrCreate(ctx, cacheInfo, noDataCf, WithNeedCacheNoData())
+				So(err, ShouldEqual, rdscache.ErrNoData)
+			}
+			v, _ := memStore.HGet(ctx, rk, sk)
+			envelope, err := common.DecodeEnvelope(v)
+			So(err, ShouldBeNil)
+			So(envelope.NoData(), ShouldBeTrue)
+
+			// 兼容历史的原始存储值
+			_ = memStore.HSet(ctx, rk, sk, "old")
+			ret, err := envelopeSvc.GetOrCreate(ctx, cacheInfo, noDataCf)
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, "old")
+		})
+
+		Convey("按缓存key合并并发的回源请求", func() {
+			type testS struct {
+				A int `json:"a"`
+			}
+			var callCnt int32
+			cf := func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&callCnt, 1)
+				time.Sleep(time.Millisecond * 100)
+				return &testS{A: 1}, nil
+			}
+			wg := sync.WaitGroup{}
+			datas := make([]*testS, 10)
+			for i := 0; i < 10; i++ {
+				datas[i] = &testS{}
+				wg.Add(1)
+				go func(data *testS) {
+					defer wg.Done()
+					_, _ = memSvc.GetOrCreate(
+						ctx, common.NewHashCache(rk, sk, 0), cf, WithSingleFlight(), WithUnMarshalData(data))
+				}(datas[i])
+			}
+			wg.Wait()
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 1)
+			for _, data := range datas {
+				So(data.A, ShouldEqual, 1)
+			}
+
+			// 同一个hash中不同的subKey互不合并
+			_, err := memSvc.GetOrCreate(ctx, common.NewHashCache(rk, "other", 0), cf, WithSingleFlight())
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 2)
+		})
+
+		Convey("过期时间抖动, 缓存信息中的抖动策略优先", func() {
+			jitterSvc, _ := NewFCacheServiceWithBackend(
+				memStore, WithSvcTTLJitter(common.NewRangeJitter(time.Minute, time.Minute)))
+			cf := func(ctx context.Context) (interface{}, error) {
+				return 1, nil
+			}
+			_, err := jitterSvc.GetOrCreate(ctx, common.NewHashCache(rk, sk, time.Minute), cf)
+			So(err, ShouldBeNil)
+			So(memStore.TTL(rk), ShouldBeGreaterThan, time.Minute*2-time.Second)
+
+			cacheInfo := common.NewStringCache(rk2, time.Minute)
+			cacheInfo.Jitter = common.NewRangeJitter(time.Hour, time.Hour)
+			_, err = jitterSvc.GetOrCreate(ctx, cacheInfo, cf)
+			So(err, ShouldBeNil)
+			So(memStore.TTL(rk2), ShouldBeGreaterThan, time.Hour)
+		})
+
+		Convey("提前刷新:记录回源耗时及过期时间, 即将过期时提前回源", func() {
+			callCnt := 0
+			cf := func(ctx context.Context) (interface{}, error) {
+				callCnt++
+				time.Sleep(time.Millisecond * 10)
+				return callCnt, nil
+			}
+			cacheInfo := common.NewStringCache(rk, time.Hour)
+			ret, err := memSvc.GetOrCreate(ctx, cacheInfo, cf, WithEarlyRefresh(1))
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, "1")
+			raw, _ := memStore.Get(ctx, rk)
+			envelope, err := common.DecodeEnvelope(raw)
+			So(err, ShouldBeNil)
+			So(envelope.Delta, ShouldBeGreaterThanOrEqualTo, time.Millisecond*10)
+			So(envelope.ExpireAt.Sub(time.Now()), ShouldBeGreaterThan, time.Hour-time.Second)
+
+			// 距离过期还很久, 直接从缓存中获取
+			ret, _ = memSvc.GetOrCreate(ctx, cacheInfo, cf, WithEarlyRefresh(1))
+			So(ret, ShouldEqual, "1")
+			So(callCnt, ShouldEqual, 1)
+
+			// 即将过期(已超过记录的过期时间), 提前回源
+			envelope.ExpireAt = time.Now()
+			_ = memStore.Set(ctx, rk, envelope.Encode(), time.Hour)
+			ret, _ = memSvc.GetOrCreate(ctx, cacheInfo, cf, WithEarlyRefresh(1))
+			So(ret, ShouldEqual, "2")
+			So(callCnt, ShouldEqual, 2)
+
+			// 未开启提前刷新的调用不受影响
+			_ = memStore.Set(ctx, rk, envelope.Encode(), time.Hour)
+			ret, _ = memSvc.GetOrCreate(ctx, cacheInfo, cf)
+			So(ret, ShouldEqual, "1")
+		})
+
+		Convey("软过期:返回旧数据并在后台刷新, 回源失败时继续返回旧数据", func() {
+			var callCnt, originDown int32
+			cf := func(ctx context.Context) (interface{}, error) {
+				if atomic.LoadInt32(&originDown) == 1 {
+					return nil, errors.New("db down")
+				}
+				return atomic.AddInt32(&callCnt, 1), nil
+			}
+			cacheInfo := common.NewStringCache(rk, time.Hour)
+			stale := true
+			ret, err := memSvc.GetOrCreate(ctx, cacheInfo, cf, WithStaleWhileRevalidate(time.Minute, &stale))
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, "1")
+			So(stale, ShouldBeFalse)
+
+			// 模拟写入已超过软过期时间, 回源失败时返回旧数据
+			atomic.StoreInt32(&originDown, 1)
+			raw, _ := memStore.Get(ctx, rk)
+			envelope, _ := common.DecodeEnvelope(raw)
+			envelope.CreatedAt = time.Now().Add(-time.Hour)
+			_ = memStore.Set(ctx, rk, envelope.Encode(), time.Hour)
+			for i := 0; i < 3; i++ {
+				ret, err = memSvc.GetOrCreate(ctx, cacheInfo, cf, WithStaleWhileRevalidate(time.Minute, &stale))
+				So(err, ShouldBeNil)
+				So(ret, ShouldEqual, "1")
+				So(stale, ShouldBeTrue)
+				time.Sleep(time.Millisecond * 20)
+			}
+
+			// 回源恢复后, 后台刷新写入新数据
+			atomic.StoreInt32(&originDown, 0)
+			ret, _ = memSvc.GetOrCreate(ctx, cacheInfo, cf, WithStaleWhileRevalidate(time.Minute, &stale))
+			So(ret, ShouldEqual, "1")
+			time.Sleep(time.Millisecond * 50)
+			ret, _ = memSvc.GetOrCreate(ctx, cacheInfo, cf, WithStaleWhileRevalidate(time.Minute, &stale))
+			So(ret, ShouldEqual, "2")
+			So(stale, ShouldBeFalse)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 2)
+		})
+
+		Convey("软过期:后台刷新panic时不影响进程, 记录日志", func() {
+			logged := make(chan string, 1)
+			logSvc, _ := NewFCacheServiceWithBackend(memStore, WithSvcLogger(
+				logging.LoggerFunc(func(ctx context.Context, level logging.Level, msg string, fields ...logging.Field) {
+					logged <- msg
+				})))
+			cacheInfo := common.NewStringCache(rk, time.Hour)
+			envelope := common.NewEnvelope("1", false)
+			envelope.CreatedAt = time.Now().Add(-time.Hour)
+			_ = memStore.Set(ctx, rk, envelope.Encode(), time.Hour)
+
+			ret, err := logSvc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
+				panic("boom")
+			}, WithStaleWhileRevalidate(time.Minute, nil))
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, "1")
+			So(<-logged, ShouldEqual, "sponge: refresh in background panic")
+		})
+
+		Convey("删除及刷新缓存", func() {
+			callCnt := 0
+			cf := func(ctx context.Context) (interface{}, error) {
+				callCnt++
+				return callCnt, nil
+			}
+
+			// hash类型只删除subKey对应的field
+			hashInfo := common.NewHashCache(rk, sk, 0)
+			_, _ = memSvc.GetOrCreate(ctx, hashInfo, cf)
+			_ = memStore.HSet(ctx, rk, "other", "v")
+			So(memSvc.Delete(ctx, hashInfo), ShouldBeNil)
+			_, err := memStore.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			v, _ := memStore.HGet(ctx, rk, "other")
+			So(v, ShouldEqual, "v")
+
+			// 批量删除
+			_, _ = memSvc.GetOrCreate(ctx, hashInfo, cf)
+			_, _ = memSvc.GetOrCreate(ctx, common.NewStringCache(rk2, 0), cf)
+			So(memSvc.MDelete(ctx, hashInfo, common.NewStringCache(rk2, 0)), ShouldBeNil)
+			_, err = memStore.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			So(memStore.TTL(rk2), ShouldEqual, -2*time.Second)
+
+			// 热key: 删除本地缓存及全部分片
+			shardKeys := []string{rk2 + "_01", rk2 + "_02"}
+			localCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+			hotKeyOption, _ := common.NewHotKeyOption(
+				common.WithLocalCache(localCache, common.NewCacheBase(rk2, time.Minute)),
+				common.WithGetShardingKey(func() string { return shardKeys[0] }),
+				common.WithAllShardingKeys(func() []string { return shardKeys }))
+			for _, key := range append(shardKeys, rk2) {
+				_ = memStore.Set(ctx, key, "1", 0)
+			}
+			_, _ = memSvc.GetOrCreate(ctx, common.NewStringCache(rk2, 0), cf, WithHotKeyOption(hotKeyOption))
+			_, err = localCache.Get(rk2)
+			So(err, ShouldBeNil)
+			So(memSvc.Delete(ctx, common.NewStringCache(rk2, 0), WithHotKeyOption(hotKeyOption)), ShouldBeNil)
+			_, err = localCache.Get(rk2)
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+			for _, key := range append(shardKeys, rk2) {
+				So(memStore.TTL(key), ShouldEqual, -2*time.Second)
+			}
+
+			// 使用分片方案但未注册获取全部分片key的函数
+			shardOnly, _ := common.NewHotKeyOption(common.WithGetShardingKey(func() string { return shardKeys[0] }))
+			So(memSvc.Delete(ctx, common.NewStringCache(rk2, 0), WithHotKeyOption(shardOnly)),
+				ShouldEqual, rdscache.ErrShardingKeysUnknown)
+
+			// 批量删除热key: 同样删除本地缓存及全部分片
+			for _, key := range append(shardKeys, rk2) {
+				_ = memStore.Set(ctx, key, "1", 0)
+			}
+			_, _ = memSvc.GetOrCreate(ctx, hashInfo, cf)
+			_, _ = memSvc.GetOrCreate(ctx, common.NewStringCache(rk2, 0), cf, WithHotKeyOption(hotKeyOption))
+			So(memSvc.MDeleteEntries(ctx, common.NewDeleteEntry(hashInfo, nil),
+				common.NewDeleteEntry(common.NewStringCache(rk2, 0), hotKeyOption)), ShouldBeNil)
+			_, err = localCache.Get(rk2)
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+			for _, key := range append(shardKeys, rk2) {
+				So(memStore.TTL(key), ShouldEqual, -2*time.Second)
+			}
+			_, err = memStore.HGet(ctx, rk, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			So(memSvc.MDeleteEntries(ctx, common.NewDeleteEntry(common.NewStringCache(rk2, 0), shardOnly)),
+				ShouldEqual, rdscache.ErrShardingKeysUnknown)
+
+			// 刷新: 重新回源并写入缓存
+			cacheInfo := common.NewStringCache(rk, 0)
+			memStore.Flush()
+			ret, _ := memSvc.GetOrCreate(ctx, cacheInfo, cf)
+			var data int
+			ret2, err := memSvc.Refresh(ctx, cacheInfo, cf, WithUnMarshalData(&data))
+			So(err, ShouldBeNil)
+			So(ret2, ShouldNotEqual, ret)
+			So(data, ShouldEqual, callCnt)
+			ret, _ = memSvc.GetOrCreate(ctx, cacheInfo, cf)
+			So(ret, ShouldEqual, ret2)
+
+			// 刷新时数据已不存在, 缓存被删除
+			_, err = memSvc.Refresh(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) {
+				return nil, rdscache.ErrNoData
+			})
+			So(err, ShouldEqual, rdscache.ErrNoData)
+			So(memStore.TTL(rk), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("按标签批量删除缓存", func() {
+			cf := func(ctx context.Context) (interface{}, error) { return "v", nil }
+			profile := common.NewStringCache(rk, time.Minute)
+			profile.Tags = []string{"user:1"}
+			card := common.NewHashCache(rk2, sk, time.Minute*2)
+			card.Tags = []string{"user:1", "card"}
+			other := common.NewHashCache(rk2, "other", time.Minute)
+			for _, cacheInfo := range []common.ICacheInfo{profile, card, other} {
+				_, err := memSvc.GetOrCreate(ctx, cacheInfo, cf)
+				So(err, ShouldBeNil)
+			}
+			members, _ := memStore.SMembers(ctx, common.TagKey("user:1"))
+			So(members, ShouldHaveLength, 2)
+			So(memStore.TTL(common.TagKey("user:1")), ShouldBeGreaterThan, time.Minute)
+
+			So(memSvc.InvalidateTags(ctx, "user:1", "notExist"), ShouldBeNil)
+			So(memStore.TTL(rk), ShouldEqual, -2*time.Second)
+			_, err := memStore.HGet(ctx, rk2, sk)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			v, _ := memStore.HGet(ctx, rk2, "other")
+			So(v, ShouldNotEqual, "")
+			So(memStore.TTL(common.TagKey("user:1")), ShouldEqual, -2*time.Second)
+			// 其它标签集合中的成员对应的缓存已不存在, 再次删除不报错
+			So(memSvc.InvalidateTags(ctx, "card"), ShouldBeNil)
+			So(memStore.TTL(common.TagKey("card")), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("访问redis的回调在当前协程中同步执行", func() {
+			called := 0
+			_, err := memSvc.GetOrCreate(ctx, common.NewStringCache(rk, time.Minute),
+				func(ctx context.Context) (interface{}, error) { return "v", nil },
+				WithGetFromRdsCallBack(func() { called++ }))
+			So(err, ShouldBeNil)
+			So(called, ShouldEqual, 1)
+		})
+
+		Convey("先记录标签再写入缓存, 写入缓存失败时标签已记录", func() {
+			svc, _ := NewFCacheServiceWithBackend(&failSetBackend{MemoryBackend: memStore})
+			cacheInfo := common.NewStringCache(rk, time.Minute)
+			cacheInfo.Tags = []string{"user:1"}
+			_, _ = svc.GetOrCreate(ctx, cacheInfo, func(ctx context.Context) (interface{}, error) { return "v", nil })
+			So(memStore.TTL(rk), ShouldEqual, -2*time.Second)
+			members, _ := memStore.SMembers(ctx, common.TagKey("user:1"))
+			So(members, ShouldResemble, []string{common.FullKey(cacheInfo)})
+		})
+
+		Convey("删除热key时通知其它实例删除本地缓存", func() {
+			pubSub := invalidate.NewMemoryPubSub()
+			cf := func(ctx context.Context) (interface{}, error) { return "v", nil }
+			cacheInfo := common.NewStringCache(rk2, 0)
+
+			var localCaches []common.ILocalCache
+			var hotKeyOptions []*common.HotKeyOption
+			var svcs []*fCacheService
+			for i := 0; i < 2; i++ {
+				localCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+				bus, err := invalidate.NewBus(ctx, pubSub, invalidate.WithLocalCaches(localCache))
+				So(err, ShouldBeNil)
+				defer func() { _ = bus.Close() }()
+				svc, _ := NewFCacheServiceWithBackend(memStore, WithSvcInvalidationBus(bus))
+				hotKeyOption, _ := common.NewHotKeyOption(
+					common.WithLocalCache(localCache, common.NewCacheBase(rk2, time.Minute)))
+
+				_, _ = svc.GetOrCreate(ctx, cacheInfo, cf, WithHotKeyOption(hotKeyOption))
+				localCaches = append(localCaches, localCache)
+				hotKeyOptions = append(hotKeyOptions, hotKeyOption)
+				svcs = append(svcs, svc)
+			}
+
+			So(svcs[0].Delete(ctx, cacheInfo, WithHotKeyOption(hotKeyOptions[0])), ShouldBeNil)
+			time.Sleep(time.Millisecond * 50)
+			for _, localCache := range localCaches {
+				_, err := localCache.Get(rk2)
+				So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+			}
+		})
+
+		Convey("多实例使用分布式锁, 只有一个请求回源", func() {
+			var callCnt int32
+			cf := func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&callCnt, 1)
+				time.Sleep(time.Millisecond * 100)
+				return "v", nil
+			}
+			wg := sync.WaitGroup{}
+			rets := make([]string, 10)
+			for i := 0; i < 10; i++ {
+				// 每个服务模拟一个实例, 共享同一个存储后端
+				instance, _ := NewFCacheServiceWithBackend(memStore)
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					rets[i], _ = instance.GetOrCreate(ctx, common.NewStringCache(rk, 0), cf,
+						WithDistributedLock(dlock.WithPollInterval(time.Millisecond*10)))
+				}(i)
+			}
+			wg.Wait()
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 1)
+			for _, ret := range rets {
+				So(ret, ShouldEqual, `"v"`)
+			}
+			// 锁已释放
+			So(memStore.TTL("sponge:lock:"+rk), ShouldEqual, -2*time.Second)
+
+			// 等待锁超时, 降级为直接回源
+			memStore.Flush()
+			_, _ = memStore.SetNX(ctx, "sponge:lock:"+rk, "other", time.Minute)
+			ret, err := memSvc.GetOrCreate(ctx, common.NewStringCache(rk, 0), cf,
+				WithDistributedLock(dlock.WithWaitTimeout(time.Millisecond*50)))
+			So(err, ShouldBeNil)
+			So(ret, ShouldEqual, `"v"`)
+			So(atomic.LoadInt32(&callCnt), ShouldEqual, 2)
+		})
+	})
+}
+
+// rawStringCodec 原样存储字符串的序列化方式
+type rawStringCodec struct{}
+
+func (rawStringCodec) Marshal(v interface{}) (string, error) {
+	return v.(string), nil
+}
+
+func (rawStringCodec) Unmarshal(data string, v interface{}) error {
+	*v.(*string) = data
+	return nil
+}
@@ -0,0 +1,253 @@
+package hotkey
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/693490554/sponge/rdscache/common"
+)
+
+// HotKey 热key及窗口内估计的访问次数
+type HotKey struct {
+	Key   string
+	Count uint64
+}
+
+// Detector 热key探测器, 统计滑动窗口内每个key的访问次数, 访问次数最多且超过阈值的key为热key
+// 每个时间片使用一个计数草图, 内存占用和key的数量无关; 时间片过期时丢弃其中的计数, 不再被访问的key自然冷却
+// 通过最小堆跟踪访问次数最多的maxTracked个key, 热key的数量不会超过maxTracked
+// 记录访问及判断热key不加锁: 计数草图原子计数, 跟踪的key的访问次数原子更新
+// 只有未跟踪的key的访问次数超过跟踪的key中最少的(维护最小堆)及切换时间片时加锁
+type Detector struct {
+	// 64位原子读写的字段放在最前面, 保证32位平台上的对齐
+	slotStart int64  // 当前时间片的开始时间(纳秒)
+	minCount  uint64 // 跟踪的key已满时其中最少的访问次数, 未满时为0; 不超过该值的未跟踪的key无需加锁
+
+	option  *Option
+	slotDur time.Duration
+	now     func() time.Time
+
+	slots   []*sketch // 环形, cur为当前时间片
+	cur     int32     // 原子读写
+	tracked sync.Map  // 跟踪的key, key -> *entry
+
+	mu   sync.Mutex // 维护最小堆及切换时间片时加锁
+	heap entryHeap  // 按访问次数的最小堆, 堆顶为跟踪的key中访问次数最少的
+}
+
+// NewDetector 创建热key探测器, 可通过服务的WithSvcHotKeyDetector记录每次访问, 通过Predicate作为热key的判断函数
+func NewDetector(opts ...OptionWrap) *Detector {
+	option := NewOption(opts...)
+	d := &Detector{
+		option:  option,
+		slotDur: option.window / time.Duration(option.slots),
+		now:     time.Now,
+		slots:   make([]*sketch, option.slots),
+	}
+	if d.slotDur <= 0 {
+		d.slotDur = 1
+	}
+	for i := range d.slots {
+		d.slots[i] = newSketch(option.width, option.depth)
+	}
+	d.slotStart = d.now().UnixNano()
+	return d
+}
+
+// Record 记录一次key的访问
+func (d *Detector) Record(key string) {
+	idx := indexes(key, d.option.width, d.option.depth)
+	d.rotate()
+	d.slots[atomic.LoadInt32(&d.cur)].add(idx)
+	count := d.estimate(idx)
+
+	if v, ok := d.tracked.Load(key); ok {
+		v.(*entry).store(count)
+		return
+	}
+	// 跟踪的key已满且访问次数不超过其中最少的, 不会替换跟踪的key
+	if count <= atomic.LoadUint64(&d.minCount) {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.track(key, count)
+}
+
+// IsHot 判断key是否为热key: 在跟踪的访问次数最多的key中, 且窗口内访问次数>=阈值
+func (d *Detector) IsHot(key string) bool {
+	d.rotate()
+	v, ok := d.tracked.Load(key)
+	return ok && v.(*entry).load() >= d.option.threshold
+}
+
+// Predicate 缓存信息对应的热key判断函数, 可直接通过common.WithIsHotKey注册到热key选项中
+// key在创建时确定(hash类型包含subKey), 使用分片方案时不受分片后修改缓存key的影响
+func (d *Detector) Predicate(cacheInfo common.ICacheInfo) func() bool {
+	key := common.FullKey(cacheInfo)
+	return func() bool {
+		return d.IsHot(key)
+	}
+}
+
+// RecordCache 记录一次缓存的访问, key同Predicate
+func (d *Detector) RecordCache(cacheInfo common.ICacheInfo) {
+	d.Record(common.FullKey(cacheInfo))
+}
+
+// TopK 跟踪的key中访问次数最多的k个(k<=0时返回全部), 按访问次数从大到小排序, 包括未达到阈值的key, 可用于监控
+func (d *Detector) TopK(k int) []HotKey {
+	d.rotate()
+	d.mu.Lock()
+	ret := make([]HotKey, 0, len(d.heap))
+	for _, e := range d.heap {
+		ret = append(ret, HotKey{Key: e.key, Count: e.load()})
+	}
+	d.mu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Count > ret[j].Count })
+	if k > 0 && k < len(ret) {
+		ret = ret[:k]
+	}
+	return ret
+}
+
+// track 跟踪访问次数超过跟踪的key中最少的key, 调用方需持有锁
+func (d *Detector) track(key string, count uint64) {
+	if v, ok := d.tracked.Load(key); ok {
+		v.(*entry).store(count)
+		return
+	}
+	if len(d.heap) < d.option.maxTracked {
+		e := &entry{key: key, count: count}
+		d.tracked.Store(key, e)
+		heap.Push(&d.heap, e)
+		d.updateMinCount()
+		return
+	}
+	// 跟踪的key的访问次数在锁外更新, 比较前重建堆
+	heap.Init(&d.heap)
+	if min := d.heap[0]; count > min.load() {
+		d.tracked.Delete(min.key)
+		e := &entry{key: key, count: count}
+		d.heap[0] = e
+		d.tracked.Store(key, e)
+		heap.Fix(&d.heap, 0)
+	}
+	d.updateMinCount()
+}
+
+// updateMinCount 更新跟踪的key中最少的访问次数, 调用方需持有锁
+func (d *Detector) updateMinCount() {
+	var min uint64
+	if len(d.heap) >= d.option.maxTracked {
+		min = d.heap[0].load()
+	}
+	atomic.StoreUint64(&d.minCount, min)
+}
+
+// estimate 窗口内的访问次数, 每行累加所有时间片的计数后取最小值
+func (d *Detector) estimate(idx []int) uint64 {
+	var ret uint64
+	for row, col := range idx {
+		var sum uint64
+		for _, s := range d.slots {
+			sum += uint64(s.get(row, col))
+		}
+		if row == 0 || sum < ret {
+			ret = sum
+		}
+	}
+	return ret
+}
+
+// rotate 当前时间片过期时加锁切换, 未过期时只原子读取当前时间片的开始时间
+func (d *Detector) rotate() {
+	now := d.now().UnixNano()
+	if now-atomic.LoadInt64(&d.slotStart) < int64(d.slotDur) {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rotateLocked(now)
+}
+
+// rotateLocked 丢弃过期时间片中的计数, 并重新计算跟踪的key的访问次数, 访问次数为0的key不再跟踪
+// 切换期间其它协程可能仍在记录到刚过期的时间片, 少量访问次数的误差不影响热key的判断
+func (d *Detector) rotateLocked(now int64) {
+	slotStart := atomic.LoadInt64(&d.slotStart)
+	elapsed := now - slotStart
+	if elapsed < int64(d.slotDur) {
+		return
+	}
+	n := int(elapsed / int64(d.slotDur))
+	atomic.StoreInt64(&d.slotStart, slotStart+int64(n)*int64(d.slotDur))
+	if n > len(d.slots) {
+		n = len(d.slots)
+	}
+	cur := atomic.LoadInt32(&d.cur)
+	for i := 0; i < n; i++ {
+		cur = (cur + 1) % int32(len(d.slots))
+		d.slots[cur].reset()
+		atomic.StoreInt32(&d.cur, cur)
+	}
+
+	alive := d.heap[:0]
+	for _, e := range d.heap {
+		count := d.estimate(indexes(e.key, d.option.width, d.option.depth))
+		if count == 0 {
+			d.tracked.Delete(e.key)
+			continue
+		}
+		e.store(count)
+		e.index = len(alive)
+		alive = append(alive, e)
+	}
+	for i := len(alive); i < len(d.heap); i++ {
+		d.heap[i] = nil
+	}
+	d.heap = alive
+	heap.Init(&d.heap)
+	d.updateMinCount()
+}
+
+type entry struct {
+	count uint64 // 原子读写, 放在最前面保证32位平台上的对齐
+	key   string
+	index int // 在堆中的位置, 持有锁时读写
+}
+
+func (e *entry) load() uint64 {
+	return atomic.LoadUint64(&e.count)
+}
+
+func (e *entry) store(count uint64) {
+	atomic.StoreUint64(&e.count, count)
+}
+
+type entryHeap []*entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].load() < h[j].load() }
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
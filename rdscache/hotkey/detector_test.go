@@ -0,0 +1,130 @@
+package hotkey
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache/common"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+// newTestDetector 创建使用手动时钟的探测器
+func newTestDetector(opts ...OptionWrap) (*Detector, *time.Time) {
+	now := time.Now()
+	d := NewDetector(opts...)
+	d.now = func() time.Time { return now }
+	d.slotStart = now.UnixNano()
+	return d, &now
+}
+
+func TestDetector(t *testing.T) {
+	Convey("热key探测器", t, func() {
+
+		Convey("窗口内访问次数达到阈值后为热key", func() {
+			d, _ := newTestDetector(WithThreshold(3))
+			for i := 0; i < 2; i++ {
+				d.Record("k")
+			}
+			So(d.IsHot("k"), ShouldBeFalse)
+			d.Record("k")
+			So(d.IsHot("k"), ShouldBeTrue)
+			So(d.IsHot("other"), ShouldBeFalse)
+		})
+
+		Convey("时间片过期后丢弃计数, 不再被访问的key冷却并不再跟踪", func() {
+			d, now := newTestDetector(WithThreshold(3), WithWindow(time.Second*10, 10))
+			for i := 0; i < 2; i++ {
+				d.Record("k")
+			}
+			*now = now.Add(time.Second * 5)
+			d.Record("k")
+			So(d.IsHot("k"), ShouldBeTrue)
+
+			// 前两次访问所在的时间片过期
+			*now = now.Add(time.Second * 6)
+			So(d.IsHot("k"), ShouldBeFalse)
+			So(d.TopK(0), ShouldResemble, []HotKey{{Key: "k", Count: 1}})
+
+			*now = now.Add(time.Second * 10)
+			So(d.TopK(0), ShouldBeEmpty)
+		})
+
+		Convey("只跟踪访问次数最多的key, 访问次数超过跟踪的最少的key时替换", func() {
+			d, _ := newTestDetector(WithThreshold(1), WithMaxTracked(2))
+			for i, key := range []string{"a", "b", "c"} {
+				for j := 0; j <= i; j++ {
+					d.Record(key)
+				}
+			}
+			So(d.IsHot("a"), ShouldBeFalse)
+			So(d.IsHot("b"), ShouldBeTrue)
+			So(d.IsHot("c"), ShouldBeTrue)
+			So(d.TopK(1), ShouldResemble, []HotKey{{Key: "c", Count: 3}})
+
+			// 未跟踪的key访问次数增加后替换访问次数最少的key
+			for i := 0; i < 2; i++ {
+				d.Record("a")
+			}
+			So(d.IsHot("a"), ShouldBeTrue)
+			So(d.IsHot("b"), ShouldBeFalse)
+		})
+
+		Convey("大量不同的key时计数草图估计的访问次数不会偏小", func() {
+			d, _ := newTestDetector(WithThreshold(50), WithSketchSize(64, 4))
+			for i := 0; i < 1000; i++ {
+				d.Record(fmt.Sprintf("cold_%d", i))
+			}
+			for i := 0; i < 50; i++ {
+				d.Record("hot")
+			}
+			So(d.IsHot("hot"), ShouldBeTrue)
+			So(d.TopK(1)[0].Key, ShouldEqual, "hot")
+		})
+
+		Convey("并发记录及判断热key", func() {
+			d := NewDetector(WithThreshold(100), WithMaxTracked(4))
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 1000; j++ {
+						d.Record("hot")
+						d.Record(fmt.Sprintf("cold_%d_%d", i, j%50))
+						_ = d.IsHot("hot")
+					}
+				}(i)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					_ = d.TopK(0)
+				}
+			}()
+			wg.Wait()
+			So(d.IsHot("hot"), ShouldBeTrue)
+			top := d.TopK(1)
+			So(top[0].Key, ShouldEqual, "hot")
+			So(top[0].Count, ShouldBeGreaterThanOrEqualTo, 8000)
+			So(len(d.TopK(0)), ShouldBeLessThanOrEqualTo, 4)
+		})
+
+		Convey("作为热key选项的判断函数, hash类型的key包含subKey", func() {
+			d, _ := newTestDetector(WithThreshold(2))
+			hashInfo := common.NewHashCache("k", "sk", time.Minute)
+			isHot := d.Predicate(hashInfo)
+			d.RecordCache(hashInfo)
+			d.RecordCache(common.NewHashCache("k", "other", time.Minute))
+			So(isHot(), ShouldBeFalse)
+			d.RecordCache(hashInfo)
+			So(isHot(), ShouldBeTrue)
+
+			// 分片方案修改缓存key后不影响判断
+			hashInfo.UpdateCacheKey("k_01")
+			So(isHot(), ShouldBeTrue)
+		})
+	})
+}
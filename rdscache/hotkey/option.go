@@ -0,0 +1,76 @@
+package hotkey
+
+import "time"
+
+const (
+	defaultWindow      = time.Second * 10
+	defaultSlots       = 10
+	defaultThreshold   = 100
+	defaultMaxTracked  = 100
+	defaultSketchWidth = 2048
+	defaultSketchDepth = 4
+)
+
+// Option 热key探测器可选项
+type Option struct {
+	window     time.Duration // 统计的滑动窗口
+	slots      int           // 窗口划分的时间片数, 越多窗口滑动越平滑
+	threshold  uint64        // 窗口内访问次数>=threshold时为热key
+	maxTracked int           // 跟踪的访问次数最多的key的数量上限, 即热key数量的上限
+	width      int           // 计数草图每行的计数器数量, 越大误差越小
+	depth      int           // 计数草图的行数(哈希函数的数量)
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{
+		window:     defaultWindow,
+		slots:      defaultSlots,
+		threshold:  defaultThreshold,
+		maxTracked: defaultMaxTracked,
+		width:      defaultSketchWidth,
+		depth:      defaultSketchDepth,
+	}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithWindow 指定统计的滑动窗口及时间片数, 默认10s划分为10个时间片, 每个时间片过期时丢弃其中的计数
+func WithWindow(window time.Duration, slots int) OptionWrap {
+	return func(o *Option) {
+		if window > 0 && slots > 0 {
+			o.window, o.slots = window, slots
+		}
+	}
+}
+
+// WithThreshold 指定热key的阈值, 窗口内访问次数>=threshold时为热key, 默认100
+func WithThreshold(threshold uint64) OptionWrap {
+	return func(o *Option) {
+		if threshold > 0 {
+			o.threshold = threshold
+		}
+	}
+}
+
+// WithMaxTracked 指定跟踪的key的数量上限, 只有访问次数最多的maxTracked个key可能成为热key, 默认100
+func WithMaxTracked(maxTracked int) OptionWrap {
+	return func(o *Option) {
+		if maxTracked > 0 {
+			o.maxTracked = maxTracked
+		}
+	}
+}
+
+// WithSketchSize 指定计数草图的大小, 默认2048*4, 每个时间片占用width*depth*4字节
+// 不同key可能共用计数器, 估计的访问次数只会偏大, 不同的key越多需要越大的width
+func WithSketchSize(width, depth int) OptionWrap {
+	return func(o *Option) {
+		if width > 0 && depth > 0 {
+			o.width, o.depth = width, depth
+		}
+	}
+}
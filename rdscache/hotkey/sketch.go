@@ -0,0 +1,50 @@
+package hotkey
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// sketch 计数草图(count-min sketch), 使用固定的内存估计任意数量key的访问次数, 计数器均通过原子操作读写, 无需加锁
+type sketch struct {
+	counters [][]uint32
+}
+
+func newSketch(width, depth int) *sketch {
+	s := &sketch{counters: make([][]uint32, depth)}
+	for i := range s.counters {
+		s.counters[i] = make([]uint32, width)
+	}
+	return s
+}
+
+// indexes key在每行中对应的计数器位置, 由两个哈希值组合生成每行的哈希函数
+func indexes(key string, width, depth int) []int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	ret := make([]int, depth)
+	for i := range ret {
+		ret[i] = int((h1 + uint32(i)*h2) % uint32(width))
+	}
+	return ret
+}
+
+func (s *sketch) add(idx []int) {
+	for row, col := range idx {
+		atomic.AddUint32(&s.counters[row][col], 1)
+	}
+}
+
+func (s *sketch) get(row, col int) uint32 {
+	return atomic.LoadUint32(&s.counters[row][col])
+}
+
+func (s *sketch) reset() {
+	for _, row := range s.counters {
+		for i := range row {
+			atomic.StoreUint32(&row[i], 0)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package invalidate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	json "github.com/json-iterator/go"
+)
+
+// message 失效消息
+type message struct {
+	ID   string   `json:"id"`   // 发布者实例标识, 每个Bus随机生成
+	Seq  uint64   `json:"seq"`  // 发布者的消息序号, 从1开始连续递增, 用于检测丢失的消息
+	Keys []string `json:"keys"` // 需要删除的本地缓存key
+}
+
+// Stats 失效总线的统计信息, 可用于监控
+type Stats struct {
+	Published  uint64 // 发布的消息数
+	Received   uint64 // 收到的其它实例的消息数
+	Missed     uint64 // 根据序号检测到的丢失的消息数, 只有收到同一发布者的后续消息时才能检测到
+	Reconnects uint64 // 订阅连接异常的次数
+}
+
+// Bus 本地缓存失效总线, 解决多实例部署时本地缓存(热key)在数据变更后无法及时失效的问题
+// 删除或刷新缓存时发布失效消息, 订阅了同一频道的实例收到后删除本地缓存中的数据
+// 发布订阅不保证送达, 丢失的消息通过序号检测并记录在统计信息中, 本地缓存仍需设置较短的过期时间兜底
+type Bus struct {
+	pubSub IPubSub
+	option *Option
+	id     string
+
+	pubMu sync.Mutex // 串行发布, 保证同一发布者的消息按序号顺序到达
+	seq   uint64
+
+	sub     ISubscription
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	lastSeq map[string]uint64 // 各发布者最后收到的序号, 只在订阅协程中访问
+
+	stats Stats
+}
+
+// NewBus 订阅失效消息并创建失效总线, 订阅失败时返回错误
+func NewBus(ctx context.Context, pubSub IPubSub, opts ...OptionWrap) (*Bus, error) {
+	option := NewOption(opts...)
+	sub, err := pubSub.Subscribe(ctx, option.channel)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bus{
+		pubSub:  pubSub,
+		option:  option,
+		id:      newID(),
+		sub:     sub,
+		done:    make(chan struct{}),
+		lastSeq: map[string]uint64{},
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b, nil
+}
+
+// Publish 发布失效消息, 其它实例收到后删除本地缓存中keys对应的数据, 当前实例的本地缓存需调用方自行删除
+func (b *Bus) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	payload, err := json.MarshalToString(&message{ID: b.id, Seq: b.seq + 1, Keys: keys})
+	if err != nil {
+		return err
+	}
+	if err = b.pubSub.Publish(ctx, b.option.channel, payload); err != nil {
+		return err
+	}
+	// 发布失败时不占用序号, 防止订阅方误判为丢失
+	b.seq++
+	atomic.AddUint64(&b.stats.Published, 1)
+	return nil
+}
+
+// Stats 获取统计信息
+func (b *Bus) Stats() Stats {
+	return Stats{
+		Published:  atomic.LoadUint64(&b.stats.Published),
+		Received:   atomic.LoadUint64(&b.stats.Received),
+		Missed:     atomic.LoadUint64(&b.stats.Missed),
+		Reconnects: atomic.LoadUint64(&b.stats.Reconnects),
+	}
+}
+
+// Close 取消订阅并等待订阅协程退出
+func (b *Bus) Close() error {
+	b.cancel()
+	err := b.sub.Close()
+	<-b.done
+	return err
+}
+
+// run 订阅协程, 连接异常时按间隔重试, 直至Close
+func (b *Bus) run() {
+	defer close(b.done)
+	for {
+		payload, err := b.sub.Receive(b.ctx)
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			atomic.AddUint64(&b.stats.Reconnects, 1)
+			if b.option.onReconnect != nil {
+				b.option.onReconnect()
+			}
+			timer := time.NewTimer(b.option.reconnectInterval)
+			select {
+			case <-timer.C:
+			case <-b.ctx.Done():
+				timer.Stop()
+				return
+			}
+			continue
+		}
+		b.handle(payload)
+	}
+}
+
+// handle 处理失效消息, 忽略格式不正确的消息及自身发布的消息
+func (b *Bus) handle(payload string) {
+	msg := &message{}
+	if err := json.UnmarshalFromString(payload, msg); err != nil || msg.ID == b.id {
+		return
+	}
+	atomic.AddUint64(&b.stats.Received, 1)
+
+	// 首次收到某个发布者的消息时无法判断之前是否有丢失
+	if last, ok := b.lastSeq[msg.ID]; ok && msg.Seq > last+1 {
+		atomic.AddUint64(&b.stats.Missed, msg.Seq-last-1)
+	}
+	if msg.Seq > b.lastSeq[msg.ID] {
+		b.lastSeq[msg.ID] = msg.Seq
+	}
+
+	for _, cache := range b.option.localCaches {
+		for _, key := range msg.Keys {
+			_ = cache.Del(key)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
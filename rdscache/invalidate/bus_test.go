@@ -0,0 +1,209 @@
+package invalidate
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/common"
+	. "github.com/glycerine/goconvey/convey"
+	"github.com/go-redis/redis"
+	goCache "github.com/patrickmn/go-cache"
+)
+
+var ctx = context.Background()
+
+// flakySubscription 第一次读取时模拟连接异常
+type flakySubscription struct {
+	ISubscription
+	failed int32
+}
+
+func (s *flakySubscription) Receive(ctx context.Context) (string, error) {
+	if atomic.CompareAndSwapInt32(&s.failed, 0, 1) {
+		return "", errors.New("connection reset")
+	}
+	return s.ISubscription.Receive(ctx)
+}
+
+type flakyPubSub struct {
+	*MemoryPubSub
+}
+
+func (p *flakyPubSub) Subscribe(ctx context.Context, channel string) (ISubscription, error) {
+	sub, err := p.MemoryPubSub.Subscribe(ctx, channel)
+	return &flakySubscription{ISubscription: sub}, err
+}
+
+// timeoutErr 模拟读取超时
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+// fakeConn 模拟redis订阅连接, stalled为true时不响应ping(连接半开)
+type fakeConn struct {
+	messages chan interface{}
+	stalled  bool
+	closed   int32
+}
+
+func newFakeConn(stalled bool) *fakeConn {
+	c := &fakeConn{messages: make(chan interface{}, 10), stalled: stalled}
+	c.messages <- &redis.Subscription{Kind: "subscribe", Channel: defaultChannel, Count: 1}
+	return c
+}
+
+func (c *fakeConn) ReceiveTimeout(timeout time.Duration) (interface{}, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-time.After(timeout):
+		return nil, timeoutErr{}
+	}
+}
+
+func (c *fakeConn) Ping(payload ...string) error {
+	if !c.stalled {
+		c.messages <- &redis.Pong{}
+	}
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func newLocalCache() common.ILocalCache {
+	return common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+}
+
+func TestBus(t *testing.T) {
+	Convey("本地缓存失效总线", t, func() {
+		pubSub := NewMemoryPubSub()
+
+		Convey("其它实例收到失效消息后删除本地缓存, 忽略自身发布的消息", func() {
+			cache1, cache2 := newLocalCache(), newLocalCache()
+			bus1, err := NewBus(ctx, pubSub, WithLocalCaches(cache1))
+			So(err, ShouldBeNil)
+			defer func() { _ = bus1.Close() }()
+			bus2, _ := NewBus(ctx, pubSub, WithLocalCaches(cache2))
+			defer func() { _ = bus2.Close() }()
+
+			for _, cache := range []common.ILocalCache{cache1, cache2} {
+				_ = cache.Set(common.NewCacheBase("k", time.Minute), "v")
+				_ = cache.Set(common.NewCacheBase("k2", time.Minute), "v")
+			}
+			So(bus1.Publish(ctx, "k"), ShouldBeNil)
+			So(bus1.Publish(ctx), ShouldBeNil)
+			time.Sleep(time.Millisecond * 50)
+
+			_, err = cache2.Get("k")
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+			v, _ := cache2.Get("k2")
+			So(v, ShouldEqual, "v")
+			v, _ = cache1.Get("k")
+			So(v, ShouldEqual, "v")
+
+			So(bus1.Stats().Published, ShouldEqual, 1)
+			So(bus2.Stats().Received, ShouldEqual, 1)
+			So(bus1.Stats().Received, ShouldEqual, 0)
+		})
+
+		Convey("不同频道互不影响", func() {
+			cache := newLocalCache()
+			bus1, _ := NewBus(ctx, pubSub, WithChannel("other"))
+			defer func() { _ = bus1.Close() }()
+			bus2, _ := NewBus(ctx, pubSub, WithLocalCaches(cache))
+			defer func() { _ = bus2.Close() }()
+
+			_ = cache.Set(common.NewCacheBase("k", time.Minute), "v")
+			So(bus1.Publish(ctx, "k"), ShouldBeNil)
+			time.Sleep(time.Millisecond * 50)
+			v, _ := cache.Get("k")
+			So(v, ShouldEqual, "v")
+		})
+
+		Convey("根据序号检测丢失的消息", func() {
+			bus, _ := NewBus(ctx, pubSub)
+			defer func() { _ = bus.Close() }()
+
+			for _, payload := range []string{
+				`{"id":"other","seq":1,"keys":["k"]}`,
+				`{"id":"other","seq":4,"keys":["k"]}`,
+				`invalid`,
+				`{"id":"other","seq":5,"keys":["k"]}`,
+			} {
+				_ = pubSub.Publish(ctx, defaultChannel, payload)
+			}
+			time.Sleep(time.Millisecond * 50)
+			So(bus.Stats().Received, ShouldEqual, 3)
+			So(bus.Stats().Missed, ShouldEqual, 2)
+		})
+
+		Convey("连接异常后重试", func() {
+			var reconnectCnt int32
+			cache := newLocalCache()
+			_ = cache.Set(common.NewCacheBase("k", time.Minute), "v")
+			bus, _ := NewBus(ctx, &flakyPubSub{pubSub}, WithLocalCaches(cache),
+				WithReconnectInterval(time.Millisecond*10),
+				WithOnReconnect(func() { atomic.AddInt32(&reconnectCnt, 1) }))
+			defer func() { _ = bus.Close() }()
+
+			time.Sleep(time.Millisecond * 50)
+			So(bus.Stats().Reconnects, ShouldEqual, 1)
+			So(atomic.LoadInt32(&reconnectCnt), ShouldEqual, 1)
+
+			_ = pubSub.Publish(ctx, defaultChannel, `{"id":"other","seq":1,"keys":["k"]}`)
+			time.Sleep(time.Millisecond * 50)
+			_, err := cache.Get("k")
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+		})
+
+		Convey("redis订阅连接无响应时重新订阅", func() {
+			stalled, healthy := newFakeConn(true), newFakeConn(false)
+			conns := []*fakeConn{stalled, healthy}
+			var subscribeCnt int32
+			rdsPubSub := &rdsPubSub{
+				subscribe: func(channel string) redisPubSubConn {
+					return conns[atomic.AddInt32(&subscribeCnt, 1)-1]
+				},
+				pingInterval: time.Millisecond * 20,
+				pingTimeout:  time.Millisecond * 20,
+			}
+			var reconnectCnt int32
+			cache := newLocalCache()
+			_ = cache.Set(common.NewCacheBase("k", time.Minute), "v")
+			bus, err := NewBus(ctx, rdsPubSub, WithLocalCaches(cache),
+				WithReconnectInterval(time.Millisecond*10),
+				WithOnReconnect(func() { atomic.AddInt32(&reconnectCnt, 1) }))
+			So(err, ShouldBeNil)
+			defer func() { _ = bus.Close() }()
+
+			time.Sleep(time.Millisecond * 100)
+			So(atomic.LoadInt32(&stalled.closed), ShouldEqual, 1)
+			So(atomic.LoadInt32(&subscribeCnt), ShouldEqual, 2)
+			So(bus.Stats().Reconnects, ShouldEqual, 1)
+			So(atomic.LoadInt32(&reconnectCnt), ShouldEqual, 1)
+
+			// 连接正常时ping有响应, 不再重新订阅
+			healthy.messages <- &redis.Message{Channel: defaultChannel, Payload: `{"id":"other","seq":1,"keys":["k"]}`}
+			time.Sleep(time.Millisecond * 100)
+			_, err = cache.Get("k")
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+			So(bus.Stats().Reconnects, ShouldEqual, 1)
+		})
+
+		Convey("关闭后不再接收消息", func() {
+			bus, _ := NewBus(ctx, pubSub)
+			So(bus.Close(), ShouldBeNil)
+			_ = pubSub.Publish(ctx, defaultChannel, `{"id":"other","seq":1,"keys":["k"]}`)
+			So(bus.Stats().Received, ShouldEqual, 0)
+		})
+	})
+}
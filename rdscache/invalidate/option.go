@@ -0,0 +1,63 @@
+package invalidate
+
+import (
+	"time"
+
+	"github.com/693490554/sponge/rdscache/common"
+)
+
+const (
+	defaultChannel           = "sponge:invalidate"
+	defaultReconnectInterval = time.Second
+)
+
+// Option 本地缓存失效总线可选项
+type Option struct {
+	channel           string               // 发布及订阅失效消息的频道
+	localCaches       []common.ILocalCache // 收到失效消息时需要删除数据的本地缓存
+	reconnectInterval time.Duration        // 订阅连接异常后重试的间隔
+	// onReconnect 订阅连接异常时的回调, 连接恢复前的失效消息可能已经丢失, 可在回调中清空本地缓存
+	onReconnect func()
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{channel: defaultChannel, reconnectInterval: defaultReconnectInterval}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithChannel 指定发布及订阅失效消息的频道, 默认为sponge:invalidate, 同一组实例需使用相同的频道
+func WithChannel(channel string) OptionWrap {
+	return func(o *Option) {
+		if channel != "" {
+			o.channel = channel
+		}
+	}
+}
+
+// WithLocalCaches 注册收到失效消息时需要删除数据的本地缓存, 即热key选项中使用的本地缓存
+func WithLocalCaches(caches ...common.ILocalCache) OptionWrap {
+	return func(o *Option) {
+		o.localCaches = append(o.localCaches, caches...)
+	}
+}
+
+// WithReconnectInterval 指定订阅连接异常后重试的间隔, 默认1s
+func WithReconnectInterval(interval time.Duration) OptionWrap {
+	return func(o *Option) {
+		if interval > 0 {
+			o.reconnectInterval = interval
+		}
+	}
+}
+
+// WithOnReconnect 注册订阅连接异常时的回调, 在重试前同步调用
+func WithOnReconnect(f func()) OptionWrap {
+	return func(o *Option) {
+		o.onReconnect = f
+	}
+}
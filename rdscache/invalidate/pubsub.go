@@ -0,0 +1,274 @@
+package invalidate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/go-redis/redis"
+)
+
+// IPubSub 发布订阅抽象, 组件内置了redis及进程内的实现
+type IPubSub interface {
+	Publish(ctx context.Context, channel, message string) error
+	Subscribe(ctx context.Context, channel string) (ISubscription, error)
+}
+
+// ISubscription 订阅
+type ISubscription interface {
+	// Receive 阻塞直至收到消息, 连接异常时返回错误, 再次调用时需自动重连并重新订阅
+	// 订阅被关闭后返回错误
+	Receive(ctx context.Context) (string, error)
+	Close() error
+}
+
+// redisPubSubClient redis单机/哨兵/集群/ring客户端均实现了发布及订阅
+type redisPubSubClient interface {
+	Publish(channel string, message interface{}) *redis.IntCmd
+	Subscribe(channels ...string) *redis.PubSub
+}
+
+// redisPubSubConn 订阅连接, 即*redis.PubSub
+type redisPubSubConn interface {
+	ReceiveTimeout(timeout time.Duration) (interface{}, error)
+	Ping(payload ...string) error
+	Close() error
+}
+
+const (
+	// defaultPingInterval 订阅连接空闲该时长后发送ping, 检测连接是否仍然可用
+	defaultPingInterval = time.Second * 30
+	// defaultPingTimeout 发送ping后该时长内未收到任何数据视为连接异常
+	defaultPingTimeout = time.Second * 5
+)
+
+// errPingTimeout 发送ping后未收到响应
+var errPingTimeout = errors.New("pubsub ping timeout")
+
+type rdsPubSub struct {
+	rds          redisPubSubClient
+	subscribe    func(channel string) redisPubSubConn
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+}
+
+// NewRedisPubSub 基于redis pub/sub实现的发布订阅, 支持*redis.Client、*redis.ClusterClient及*redis.Ring
+// redis pub/sub不保证送达, 订阅连接断开期间发布的消息将丢失
+// 订阅连接空闲时定期发送ping, 未响应时重新建立订阅, 防止连接半开(例如网络分区)时一直阻塞
+func NewRedisPubSub(rds redisPubSubClient) IPubSub {
+	return &rdsPubSub{
+		rds:          rds,
+		subscribe:    func(channel string) redisPubSubConn { return rds.Subscribe(channel) },
+		pingInterval: defaultPingInterval,
+		pingTimeout:  defaultPingTimeout,
+	}
+}
+
+func (p *rdsPubSub) Publish(ctx context.Context, channel, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.rds.Publish(channel, message).Err()
+}
+
+func (p *rdsPubSub) Subscribe(ctx context.Context, channel string) (ISubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := p.subscribeConn(channel)
+	if err != nil {
+		return nil, err
+	}
+	return &rdsSubscription{p: p, channel: channel, conn: conn}, nil
+}
+
+// subscribeConn 建立订阅并等待订阅确认, 确保返回后不会丢失发布的消息
+func (p *rdsPubSub) subscribeConn(channel string) (redisPubSubConn, error) {
+	conn := p.subscribe(channel)
+	if _, err := conn.ReceiveTimeout(p.pingTimeout); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+type rdsSubscription struct {
+	p       *rdsPubSub
+	channel string
+
+	mu     sync.Mutex
+	conn   redisPubSubConn // 为nil代表连接异常, 下次读取时重新订阅
+	closed bool
+}
+
+// Receive 连接空闲pingInterval后发送ping, pingTimeout内未收到任何数据时关闭连接并返回错误, 下次读取时重新订阅
+// 其它读取错误由go-redis在下一次读取时自动重连并重新订阅; 阻塞读取时无法响应ctx, 需通过Close中断
+func (s *rdsSubscription) Receive(ctx context.Context) (string, error) {
+	timeout, pinged := s.p.pingInterval, false
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		conn, err := s.getConn()
+		if err != nil {
+			return "", err
+		}
+		msg, err := conn.ReceiveTimeout(timeout)
+		if err != nil {
+			if !isTimeout(err) {
+				return "", err
+			}
+			if pinged {
+				s.resetConn(conn)
+				return "", errPingTimeout
+			}
+			if err = conn.Ping(); err != nil {
+				s.resetConn(conn)
+				return "", err
+			}
+			timeout, pinged = s.p.pingTimeout, true
+			continue
+		}
+
+		// 收到任何数据均说明连接可用
+		timeout, pinged = s.p.pingInterval, false
+		if msg, ok := msg.(*redis.Message); ok {
+			return msg.Payload, nil
+		}
+	}
+}
+
+// getConn 获取当前的订阅连接, 连接异常被关闭后重新订阅
+func (s *rdsSubscription) getConn() (redisPubSubConn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, rdscache.ErrSubscriptionClosed
+	}
+	if conn := s.conn; conn != nil {
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	// 等待订阅确认时不持有锁, 防止阻塞Close
+	conn, err := s.p.subscribeConn(s.channel)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		_ = conn.Close()
+		return nil, rdscache.ErrSubscriptionClosed
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+// resetConn 关闭异常的连接, 下次读取时重新订阅
+func (s *rdsSubscription) resetConn(conn redisPubSubConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+	}
+	_ = conn.Close()
+}
+
+func (s *rdsSubscription) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// isTimeout 是否为读取超时, 超时时go-redis不会重建连接
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// memSubscriptionBuffer 进程内订阅的消息缓冲, 缓冲已满时丢弃消息, 和redis一样不保证送达
+const memSubscriptionBuffer = 1024
+
+// MemoryPubSub 进程内的发布订阅, 主要用于单元测试或单进程内多个服务实例之间同步
+type MemoryPubSub struct {
+	mu   sync.Mutex
+	subs map[string]map[*memSubscription]struct{}
+}
+
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{subs: map[string]map[*memSubscription]struct{}{}}
+}
+
+func (p *MemoryPubSub) Publish(ctx context.Context, channel, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for sub := range p.subs[channel] {
+		select {
+		case sub.messages <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+func (p *MemoryPubSub) Subscribe(ctx context.Context, channel string) (ISubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sub := &memSubscription{
+		p: p, channel: channel, messages: make(chan string, memSubscriptionBuffer), closed: make(chan struct{}),
+	}
+	if p.subs[channel] == nil {
+		p.subs[channel] = map[*memSubscription]struct{}{}
+	}
+	p.subs[channel][sub] = struct{}{}
+	return sub, nil
+}
+
+type memSubscription struct {
+	p         *MemoryPubSub
+	channel   string
+	messages  chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *memSubscription) Receive(ctx context.Context) (string, error) {
+	select {
+	case msg := <-s.messages:
+		return msg, nil
+	case <-s.closed:
+		return "", rdscache.ErrSubscriptionClosed
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (s *memSubscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.p.mu.Lock()
+		delete(s.p.subs[s.channel], s)
+		s.p.mu.Unlock()
+		close(s.closed)
+	})
+	return nil
+}
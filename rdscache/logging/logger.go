@@ -0,0 +1,62 @@
+package logging
+
+import "context"
+
+// Level 日志级别
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Field 结构化日志的字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Any 创建字段
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err 创建key为error的字段
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// ILogger 日志抽象, 记录缓存服务中无法返回给调用方的错误, 例如反序列化失败、写入本地缓存失败及后台刷新失败
+// 字段中只包含缓存key及错误, 不包含缓存的内容
+type ILogger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// LoggerFunc 函数形式的日志
+type LoggerFunc func(ctx context.Context, level Level, msg string, fields ...Field)
+
+func (f LoggerFunc) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	f(ctx, level, msg, fields...)
+}
+
+// NewNopLogger 不记录任何日志
+func NewNopLogger() ILogger {
+	return LoggerFunc(func(context.Context, Level, string, ...Field) {})
+}
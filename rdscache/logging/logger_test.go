@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"testing"
+
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestStdLogger(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("标准库日志", t, func() {
+		buf := &bytes.Buffer{}
+
+		Convey("按级别过滤, 输出级别、消息及字段", func() {
+			logger := NewStdLogger(log.New(buf, "", 0))
+			logger.Log(ctx, LevelInfo, "ignored")
+			So(buf.String(), ShouldEqual, "")
+
+			logger.Log(ctx, LevelError, "fail", Any("key", "k"), Err(errors.New("boom")))
+			So(buf.String(), ShouldEqual, "[ERROR] fail key=k error=boom\n")
+		})
+
+		Convey("指定最低级别", func() {
+			logger := NewStdLogger(log.New(buf, "", 0), WithLevel(LevelDebug))
+			logger.Log(ctx, LevelDebug, "debug")
+			So(buf.String(), ShouldEqual, "[DEBUG] debug\n")
+		})
+
+		Convey("级别名称", func() {
+			So(LevelWarn.String(), ShouldEqual, "WARN")
+			So(Level(10).String(), ShouldEqual, "UNKNOWN")
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package logging
+
+// Option 标准库日志可选项
+type Option struct {
+	level Level // 记录的最低级别
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{level: LevelWarn}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithLevel 指定记录的最低级别, 默认为LevelWarn
+func WithLevel(level Level) OptionWrap {
+	return func(o *Option) {
+		o.level = level
+	}
+}
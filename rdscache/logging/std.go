@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// stdLogger 使用标准库log记录日志, 格式为: [级别] msg key=value ...
+type stdLogger struct {
+	l      *log.Logger
+	option *Option
+}
+
+// NewStdLogger 使用标准库log记录日志, l为nil时输出到标准错误
+func NewStdLogger(l *log.Logger, opts ...OptionWrap) ILogger {
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &stdLogger{l: l, option: NewOption(opts...)}
+}
+
+func (s *stdLogger) Log(_ context.Context, level Level, msg string, fields ...Field) {
+	if level < s.option.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(level.String())
+	b.WriteString("] ")
+	b.WriteString(msg)
+	for _, f := range fields {
+		_, _ = fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	_ = s.l.Output(2, b.String())
+}
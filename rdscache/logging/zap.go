@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// zapLogger 使用zap记录结构化日志, 级别由zap.Logger控制
+type zapLogger struct {
+	l *zap.Logger
+}
+
+// NewZapLogger 使用zap记录结构化日志, 字段转换为zap的字段, 可直接接入JSON格式的日志
+func NewZapLogger(l *zap.Logger) ILogger {
+	return &zapLogger{l: l}
+}
+
+func (z *zapLogger) Log(_ context.Context, level Level, msg string, fields ...Field) {
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+	}
+	switch level {
+	case LevelDebug:
+		z.l.Debug(msg, zapFields...)
+	case LevelInfo:
+		z.l.Info(msg, zapFields...)
+	case LevelWarn:
+		z.l.Warn(msg, zapFields...)
+	default:
+		z.l.Error(msg, zapFields...)
+	}
+}
@@ -1,6 +1,8 @@
 package mcache
 
 import (
+	"context"
+
 	"github.com/693490554/sponge/rdscache/common"
 )
 
@@ -12,9 +14,9 @@ type ICacheModel interface {
 	Marshal() (string, error)
 	// model反序列化反方, 将缓存的内容反序列化到model中
 	UnMarshal(value string) error
-	// 获取原始非缓存数据, 当数据不存在时需返回ErrNoData
+	// 获取原始非缓存数据, 当数据不存在时需返回ErrNoData, 回源时需遵循ctx的超时及取消
 	// ErrNoData搭配WithNeedCacheNoData可预防缓存穿透
-	GetOri() (ICacheModel, error)
+	GetOri(ctx context.Context) (ICacheModel, error)
 }
 
 // ICanMGetModel 通过组件可以批量获取的单个model的抽象
@@ -25,7 +27,7 @@ type ICanMGetModel interface {
 	// model序列化方法，通过该方法可以获取到缓存的内容
 	Marshal() (string, error)
 	// model反序列化反方, 将缓存的内容反序列化到model中
-	// TODO value=""代表缓存了空数据，此时反序列化后续特殊标示下
+	// 历史的原始存储值value=""代表缓存了空数据; 服务开启信封格式(WithSvcEnvelope)后, 缓存了空数据时改为调用UpdateSelf(nil)
 	UnMarshal(value string) error
 	// UpdateSelf 通过接口更新自身, model == nil代表数据不存在，以方法形式提供对本身的更新操作，代替使用反射操作，提高性能
 	UpdateSelf(model ICanMGetModel)
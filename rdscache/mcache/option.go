@@ -2,14 +2,189 @@ package mcache
 
 import (
 	"sync"
+	"time"
 
+	"github.com/693490554/sponge/rdscache/backend"
 	"github.com/693490554/sponge/rdscache/common"
+	"github.com/693490554/sponge/rdscache/compress"
+	"github.com/693490554/sponge/rdscache/dlock"
+	"github.com/693490554/sponge/rdscache/encrypt"
+	"github.com/693490554/sponge/rdscache/hotkey"
+	"github.com/693490554/sponge/rdscache/invalidate"
+	"github.com/693490554/sponge/rdscache/logging"
+	"github.com/693490554/sponge/rdscache/namespace"
+	"github.com/693490554/sponge/rdscache/observe"
+	"github.com/693490554/sponge/rdscache/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultMaxDelayTasks 服务独占的延迟双删调度器中未到期任务数的上限
+const defaultMaxDelayTasks = 10000
+
+// mCacheSvcOption model缓存服务级别的可选项, 对该服务的所有调用生效
+type mCacheSvcOption struct {
+	// compressor 存储值长度>=compressThreshold时使用的压缩算法, 为nil代表不压缩
+	compressor        compress.ICompressor
+	compressThreshold int
+	keyring           *encrypt.Keyring     // 存储值加密使用的密钥环, 为nil代表不加密
+	encryptOpts       []encrypt.OptionWrap // 存储值加密的可选项
+	envelope          bool                 // 是否以信封格式写入存储值
+	jitter            common.IJitter       // 过期时间抖动策略, 缓存信息中未指定抖动策略时使用
+	noDataTTL         time.Duration        // 默认的数据不存在的过期时间, 为0代表和真实数据使用相同的过期时间
+	bus               *invalidate.Bus      // 本地缓存失效总线, 为nil代表不通知其它实例
+	keySpace          *common.KeySpace     // 服务级别的key空间, 为nil代表不加前缀
+	namespace         *namespace.Namespace // 命名空间, 为nil代表不使用命名空间
+	observer          observe.IObserver    // 缓存事件观察者, 为nil代表不通知
+	tracer            *tracing.Tracer      // 链路追踪, 为nil代表不开启
+	logger            logging.ILogger      // 日志, 记录无法返回给调用方的错误
+	hotKeys           *hotkey.Detector     // 热key探测器, 为nil代表不统计
+	// scheduler 延迟双删使用的调度器, 未指定时使用服务独占的调度器
+	scheduler *common.DelayScheduler
+	// ownScheduler 调度器是否由服务创建, 只有服务创建的调度器才在Shutdown时关闭
+	ownScheduler bool
+}
+
+func newMCacheSvcOption(opts ...MCSvcOptionWrap) *mCacheSvcOption {
+	ret := &mCacheSvcOption{logger: logging.NewStdLogger(nil)}
+	for _, op := range opts {
+		op(ret)
+	}
+	return ret
+}
+
+type MCSvcOptionWrap func(o *mCacheSvcOption)
+
+// transformers 写入存储前对存储值的转换
+func (o *mCacheSvcOption) transformers() []backend.IValueTransformer {
+	var ret []backend.IValueTransformer
+	if o.compressor != nil {
+		ret = append(ret, compress.NewTransformer(o.compressor, o.compressThreshold))
+	}
+	// 先压缩再加密, 加密后的数据无法再压缩
+	if o.keyring != nil {
+		ret = append(ret, encrypt.NewTransformer(o.keyring, o.encryptOpts...))
+	}
+	return ret
+}
+
+// WithSvcCompress model序列化后长度>=threshold时压缩后再写入, 读取时自动解压, 压缩及未压缩的数据可以共存
+func WithSvcCompress(compressor compress.ICompressor, threshold int) MCSvcOptionWrap {
+	return func(o *mCacheSvcOption) {
+		o.compressor = compressor
+		o.compressThreshold = threshold
+	}
+}
+
+// WithSvcEncrypt 使用AES-GCM加密存储值, 读取时(包括同步至本地缓存前)自动解密, 支持通过密钥环轮换密钥
+// 默认拒绝未加密的存储值, 从未加密迁移时可传入encrypt.WithAllowPlaintext()
+func WithSvcEncrypt(keyring *encrypt.Keyring, opts ...encrypt.OptionWrap) MCSvcOptionWrap {
+	return func(o *mCacheSvcOption) {
+		o.keyring = keyring
+		o.encryptOpts = opts
+	}
+}
+
+// WithSvcEnvelope 以信封格式写入存储值, 可以区分缓存的数据不存在和Marshal结果为空字符串的model
+// 读取时始终兼容信封格式及历史的原始存储值, 开启前需确保所有读取该缓存的服务均已升级到支持信封格式的版本
+func WithSvcEnvelope() MCSvcOptionWrap {
+	return func(o *mCacheSvcOption) {
+		o.envelope = true
+	}
+}
+
+// WithSvcTTLJitter 指定服务默认的过期时间抖动策略, 对redis及本地缓存的过期时间均生效, 批量写入时每个key单独抖动
+func WithSvcTTLJitter(jitter common.IJitter) MCSvcOptionWrap {
+	return func(o *mCacheSvcOption) {
+		o.jitter = jitter
+	}
+}
+
+// WithSvcNoDataTTL 指定服务默认的数据不存在的过期时间, 单次调用可通过WithNoDataTTL、WithMGetNoDataTTL覆盖
+func WithSvcNoDataTTL(ttl time.Duration) MCSvcOptionWrap {
+	return func(o *mCacheSvcOption) {
+		o.noDataTTL = ttl
+	}
+}
+
+// WithSvcInvalidationBus 指定本地缓存失效总线, 删除、刷新或Set使用了本地缓存的热key时, 通知其它实例删除本地缓存中的数据
+func WithSvcInvalidationBus(bus *invalidate.Bus) MCSvcOptionWrap {
+	return func(o *mCacheSvcOption) {
+		o.bus = bus
+	}
+}
+
+// WithSvcKeySpace 指定服务级别的key空间, 该服务读写的所有key均加上key空间的环境及前缀, 不同团队或服务共用redis时防止key冲突
+// 同时使用命名空间时key空间的前缀在最外层; key模板生成的key已包含全局的key空间, 两者一般只使用其一
+func WithSvcKeySpace(space *common.KeySpace) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		option.keySpace = space
+	}
+}
+
+// WithSvcNamespace 指定命名空间, 该服务读写的所有key均加上命名空间及其代数作为前缀
+// 递增命名空间的代数(Bump)后该服务的缓存全部失效, 旧的key在过期后自动删除; 不影响热key的本地缓存, 本地缓存在过期后失效
+func WithSvcNamespace(ns *namespace.Namespace) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		option.namespace = ns
+	}
+}
+
+// WithSvcObserver 指定缓存事件观察者, 命中、未命中、回源、写入、反序列化失败及等待锁时同步通知, 可用于监控及热key统计
+// 观察者耗时较长时可使用observe.NewAsyncObserver包装, 通过有界队列异步处理
+func WithSvcObserver(observer observe.IObserver) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		option.observer = observer
+	}
+}
+
+// WithSvcTracing 开启链路追踪, 为GetOrCreate、MGetOrCreate、回源及每次访问存储后端创建span, 以调用方ctx中的span为父span
+// tp为nil时使用otel全局的TracerProvider
+func WithSvcTracing(tp trace.TracerProvider) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		option.tracer = tracing.NewTracer(tp)
+	}
+}
+
+// WithSvcHotKeyDetector 指定热key探测器, 每次获取缓存(批量获取时每个key)时记录访问, 在判断是否为热key之前记录
+// 热key选项可通过common.WithIsHotKey(detector.Predicate(cacheInfo))注册, 访问次数超过阈值后自动使用热key处理
+func WithSvcHotKeyDetector(detector *hotkey.Detector) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		option.hotKeys = detector
+	}
+}
+
+// WithSvcLogger 指定日志, 记录反序列化失败、写入本地缓存失败及后台刷新失败等无法返回给调用方的错误
+// 默认使用标准库log输出到标准错误, 不需要日志时可指定logging.NewNopLogger()
+func WithSvcLogger(logger logging.ILogger) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		if logger != nil {
+			option.logger = logger
+		}
+	}
+}
+
+// WithSvcDelayScheduler 指定延迟双删使用的调度器, 多个服务可共用同一个调度器以限制总的待执行任务数
+// 服务的Shutdown不会关闭指定的调度器, 需由创建方在所有服务停止处理请求后调用其Shutdown
+func WithSvcDelayScheduler(scheduler *common.DelayScheduler) MCSvcOptionWrap {
+	return func(option *mCacheSvcOption) {
+		option.scheduler = scheduler
+	}
+}
+
 // MCOption model缓存可选项
 type MCOption struct {
 	lock               sync.Locker          // 需要预防缓存击穿时，传入lock
+	singleFlight       bool                 // 需要预防缓存击穿时, 按缓存key合并并发的回源请求
+	dLock              bool                 // 需要预防缓存击穿时, 使用分布式锁保证多实例之间只有一个请求回源
+	dLockOpts          []dlock.OptionWrap   // 分布式锁可选项
+	useLease           bool                 // 是否使用租约, 未命中时拿到租约的请求才回源并写入缓存
+	leaseOpts          []dlock.OptionWrap   // 租约可选项
+	lease              *dlock.Mutex         // 本次调用拿到的租约, 写入缓存时校验租约是否仍有效
 	needCacheNoData    bool                 // 是否需要缓存无数据的情况
+	noDataTTL          time.Duration        // 数据不存在的过期时间, 为0时使用服务默认的
+	earlyRefreshBeta   float64              // 提前刷新(XFetch)的系数, >0代表开启提前刷新
+	softTTL            time.Duration        // 软过期时间, >0代表开启stale-while-revalidate
+	stale              *bool                // 不为nil时记录本次返回的是否为超过软过期时间的旧数据
 	getFromRdsCallBack func()               // 访问redis时的回调函数，可用于做监控，及热key统计等等
 	hotKeyOption       *common.HotKeyOption // 热key处理选项
 }
@@ -24,19 +199,86 @@ func NewMCOption(opts ...MCOptionWrap) *MCOption {
 
 type MCOptionWrap func(o *MCOption)
 
+// needEnvelope 提前刷新及软过期依赖信封中记录的信息, 开启时需以信封格式写入存储值
+func (o *MCOption) needEnvelope() bool {
+	return o != nil && (o.earlyRefreshBeta > 0 || o.softTTL > 0)
+}
+
 func WithLock(lock sync.Locker) MCOptionWrap {
 	return func(o *MCOption) {
 		o.lock = lock
 	}
 }
 
+// WithSingleFlight 按缓存key(hash类型包含subKey)合并并发的回源请求, 预防缓存击穿
+// 相同key并发未命中时只有一个请求回源, 其余请求共享回源结果并反序列化到各自的model中, 不同key之间互不阻塞
+// 回源的请求因自身ctx超时或取消失败时, ctx仍有效的其余请求不共享该错误, 重新合并回源
+func WithSingleFlight() MCOptionWrap {
+	return func(o *MCOption) {
+		o.singleFlight = true
+	}
+}
+
+// WithDistributedLock 使用存储后端实现的分布式锁预防缓存击穿, 锁的key为缓存key(hash类型包含subKey)
+// 多实例并发未命中时只有拿到锁的请求回源, 其余请求轮询等待缓存写入; 持有者宕机时锁在租期后自动释放
+// 等待锁超时或存储后端异常时降级为直接回源
+func WithDistributedLock(opts ...dlock.OptionWrap) MCOptionWrap {
+	return func(o *MCOption) {
+		o.dLock = true
+		o.dLockOpts = opts
+	}
+}
+
+// WithLease 使用租约防止数据变更后写入旧数据, 同时预防缓存击穿
+// 未命中时获取租约(存储后端中的随机token), 只有拿到租约的请求回源, 其余请求轮询等待缓存写入, 可选项同WithDistributedLock
+// 删除缓存(Delete/MDelete/DoubleDelete/Refresh)时撤销未完成的租约, 回源后写入缓存时原子地校验租约, 租约已被撤销或过期时不写入
+// 等待租约超时或存储后端异常时降级为直接回源, 且不写入缓存; 使用分片方案处理热key时, 分片key的写入无法保证原子性
+func WithLease(opts ...dlock.OptionWrap) MCOptionWrap {
+	return func(o *MCOption) {
+		o.useLease = true
+		o.leaseOpts = opts
+	}
+}
+
+// WithEarlyRefresh 按XFetch算法提前刷新缓存, 缓存即将过期时少量请求提前回源, 热key过期时不会集中回源
+// 根据写入时记录的回源耗时及过期时间计算, 回源越慢、越接近过期, 提前刷新的概率越大; beta一般取1, 越大越倾向于提前刷新
+// 开启后以信封格式写入存储值; 仅从redis读取时判断, 命中本地缓存时不提前刷新
+func WithEarlyRefresh(beta float64) MCOptionWrap {
+	return func(o *MCOption) {
+		o.earlyRefreshBeta = beta
+	}
+}
+
+// WithStaleWhileRevalidate 开启软过期, 缓存信息中的过期时间为硬过期时间, softTTL需小于硬过期时间
+// 写入超过softTTL后读取时直接将旧数据反序列化到model中, 同时在后台刷新缓存(相同key同时只有一个后台刷新, 不使用本次调用的ctx)
+// 后台刷新会调用本次传入model的GetOri, GetOri中不可修改model; 回源失败时继续返回旧数据直至硬过期
+// stale不为nil时记录本次返回的是否为旧数据; 开启后以信封格式写入存储值, 仅从redis读取时判断, 命中本地缓存时不判断
+func WithStaleWhileRevalidate(softTTL time.Duration, stale *bool) MCOptionWrap {
+	return func(o *MCOption) {
+		o.softTTL = softTTL
+		o.stale = stale
+	}
+}
+
 func WithNeedCacheNoData() MCOptionWrap {
 	return func(o *MCOption) {
 		o.needCacheNoData = true
 	}
 }
 
+// WithNoDataTTL 指定数据不存在的过期时间, 搭配WithNeedCacheNoData使用, 数据被创建后可以更快地被读取到
+// string类型直接作为key的过期时间; hash类型的field共用key的过期时间, 以信封格式记录并在读取时判断是否过期
+// 写入本地缓存时不会超过本地缓存的过期时间; 指定后数据不存在以信封格式写入存储值
+func WithNoDataTTL(ttl time.Duration) MCOptionWrap {
+	return func(o *MCOption) {
+		o.noDataTTL = ttl
+	}
+}
+
 // WithGetFromRdsCallBack 注册从redis获取数据时的回调
+//
+// Deprecated: 回调中没有key、结果及耗时, 使用服务级别的WithSvcObserver替代
+// 回调在读取redis的协程中同步执行, 耗时的处理需自行异步执行(例如放入有界队列)
 func WithGetFromRdsCallBack(cb func()) MCOptionWrap {
 	return func(o *MCOption) {
 		o.getFromRdsCallBack = cb
@@ -53,6 +295,7 @@ func WithHotKeyOption(option *common.HotKeyOption) MCOptionWrap {
 // MGetOption 批量获取时的可选参数
 type MGetOption struct {
 	needCacheNoData bool
+	noDataTTL       time.Duration // 数据不存在的过期时间, 为0时使用服务默认的
 }
 
 func NewMGetOption(opts ...MGetOptionWrap) *MGetOption {
@@ -73,3 +316,10 @@ func WithMGetNeedCacheNoData() MGetOptionWrap {
 		o.needCacheNoData = true
 	}
 }
+
+// WithMGetNoDataTTL 指定批量获取时数据不存在的过期时间, 搭配WithMGetNeedCacheNoData使用, 同WithNoDataTTL
+func WithMGetNoDataTTL(ttl time.Duration) MGetOptionWrap {
+	return func(o *MGetOption) {
+		o.noDataTTL = ttl
+	}
+}
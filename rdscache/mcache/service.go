@@ -4,15 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
 	"github.com/693490554/sponge/rdscache/common"
+	"github.com/693490554/sponge/rdscache/dlock"
+	"github.com/693490554/sponge/rdscache/logging"
+	"github.com/693490554/sponge/rdscache/observe"
+	"github.com/693490554/sponge/rdscache/tracing"
 	"github.com/go-redis/redis"
 )
 
 type mCacheService struct {
-	rds *redis.Client
+	store  backend.IBackend // 缓存存储后端, 默认使用redis
+	option *mCacheSvcOption
+	flight *common.SingleFlight // 按缓存key合并回源请求
+	// refreshing 按缓存key合并软过期后的后台刷新, 和flight分开, 后台刷新不影响同步回源的请求合并
+	refreshing *common.SingleFlight
 }
 
 // GetOrCreate 从缓存中获取model, 如果不存在则获取原始数据并放入缓存中
@@ -21,9 +31,22 @@ func (s *mCacheService) GetOrCreate(ctx context.Context, model ICacheModel, opts
 	if model == nil {
 		return rdscache.ErrModuleMustNotNil
 	}
+	ctx, span := s.option.tracer.StartCache(ctx, "sponge.mcache.GetOrCreate", model.CacheInfo())
+	err := s.getOrCreate(ctx, model, opts...)
+	tracing.End(span, err)
+	return err
+}
 
+func (s *mCacheService) getOrCreate(ctx context.Context, model ICacheModel, opts ...MCOptionWrap) error {
 	option := NewMCOption(opts...)
 	cacheInfo := model.CacheInfo()
+	// 在判断是否为热key之前记录访问, 使用分片方案时获取缓存会修改缓存key
+	if s.option.hotKeys != nil {
+		s.option.hotKeys.RecordCache(cacheInfo)
+	}
+	if option.stale != nil {
+		*option.stale = false
+	}
 
 	// 从缓存中获取
 	needReturn, err := s.get(ctx, cacheInfo, model, option)
@@ -31,9 +54,14 @@ func (s *mCacheService) GetOrCreate(ctx context.Context, model ICacheModel, opts
 		return err
 	}
 
-	// 需要预防缓存击穿
+	// 需要预防缓存击穿, 等待锁时ctx超时或取消则直接返回
 	if option.lock != nil {
-		option.lock.Lock()
+		startTs := time.Now()
+		err = common.LockWithCtx(ctx, option.lock)
+		s.notify(cacheInfo, observe.Event{Type: observe.EventLockWait, Duration: time.Since(startTs), Err: err})
+		if err != nil {
+			return err
+		}
 		defer option.lock.Unlock()
 
 		// 拿到锁后再从缓存中获取下
@@ -43,11 +71,112 @@ func (s *mCacheService) GetOrCreate(ctx context.Context, model ICacheModel, opts
 		}
 	}
 
-	// 不存在则获取数据源
+	// 使用分布式锁, 多实例之间只有拿到锁的请求回源, 其余请求等待缓存写入
+	if option.dLock {
+		mutex := dlock.NewMutex(s.store, common.FullKey(cacheInfo), option.dLockOpts...)
+		locked, needReturn, err := s.lockOrWait(ctx, mutex, cacheInfo, model, option)
+		if locked {
+			defer func() { _ = mutex.Unlock() }()
+		}
+		if needReturn {
+			return err
+		}
+		// 等待锁超时或存储后端异常时, 降级为直接回源
+	}
+
+	// 使用租约, 多实例之间只有拿到租约的请求回源, 回源期间缓存被删除时租约被撤销, 不会写入旧数据
+	if option.useLease {
+		// 复制可选项, 防止写入调用方共用的MCOption中的切片
+		leaseOpts := append(append([]dlock.OptionWrap(nil), option.leaseOpts...), dlock.WithKeyPrefix(""))
+		lease := dlock.NewMutex(s.store, leaseKey(cacheInfo, cacheInfo.BaseInfo().Key), leaseOpts...)
+		locked, needReturn, err := s.lockOrWait(ctx, lease, cacheInfo, model, option)
+		if locked {
+			// 写入缓存时租约已被删除, 释放失败可忽略
+			defer func() { _ = lease.Unlock() }()
+		}
+		if needReturn {
+			return err
+		}
+		if !locked {
+			// 等待租约超时或存储后端异常时, 降级为直接回源, 未拿到租约不写入缓存
+			s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierOrigin))
+			return s.getOri(ctx, model)
+		}
+		option.lease = lease
+	}
+
+	// 不存在则获取数据源, 需要合并请求时相同key的并发请求共享回源结果
+	s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierOrigin))
+	if option.singleFlight {
+		v, err := s.flight.Do(ctx, common.FullKey(cacheInfo), func() (interface{}, error) {
+			return s.create(ctx, cacheInfo, model, option)
+		})
+		if err != nil {
+			return err
+		}
+		// 共享的回源结果需反序列化到各自的model中
+		if err = model.UnMarshal(v.(string)); err != nil {
+			s.unmarshalFail(ctx, cacheInfo, err)
+		}
+		return err
+	}
+	_, err = s.create(ctx, cacheInfo, model, option)
+	return err
+}
+
+// getOri 直接获取数据源并反序列化到model中, 不写入缓存
+func (s *mCacheService) getOri(ctx context.Context, model ICacheModel) error {
+	loadCtx, span := s.option.tracer.StartCache(ctx, "sponge.mcache.Load", model.CacheInfo())
+	oriData, err := model.GetOri(loadCtx)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	cacheStr, err := oriData.Marshal()
+	if err != nil {
+		return err
+	}
+	return model.UnMarshal(cacheStr)
+}
+
+// lockOrWait 加锁, 未拿到锁时轮询等待其它请求写入缓存
+// @return locked: 是否拿到了锁, 拿到锁时调用方需释放锁
+// @return needReturn, err: 同get, needReturn为false且未拿到锁代表等待锁超时或存储后端异常
+func (s *mCacheService) lockOrWait(ctx context.Context, mutex *dlock.Mutex,
+	cacheInfo common.ICacheInfo, model ICacheModel, option *MCOption) (locked, needReturn bool, err error) {
+	var getErr error
+	startTs := time.Now()
+	locked, lockErr := mutex.LockOrWait(ctx, func() bool {
+		needReturn, getErr = s.get(ctx, cacheInfo, model, option)
+		return needReturn
+	})
+	s.notify(cacheInfo, observe.Event{Type: observe.EventLockWait, Duration: time.Since(startTs), Err: lockErr})
+	switch {
+	case locked:
+		// 拿到锁后再从缓存中获取下, 锁可能是在其它实例写入缓存并释放后拿到的
+		needReturn, err = s.get(ctx, cacheInfo, model, option)
+		return true, needReturn, err
+	case lockErr == nil:
+		// 等待期间其它实例已经写入了缓存
+		return false, true, getErr
+	case ctx.Err() != nil:
+		return false, true, ctx.Err()
+	}
+	return false, false, nil
+}
+
+// create 获取数据源并放入缓存, 返回model序列化后的内容, 数据不存在时返回ErrNoData
+func (s *mCacheService) create(
+	ctx context.Context, cacheInfo common.ICacheInfo, model ICacheModel, option *MCOption) (string, error) {
 	var noDataErr error
-	oriData, err := model.GetOri()
+	loadCtx, span := s.option.tracer.StartCache(ctx, "sponge.mcache.Load", cacheInfo)
+	startTs := time.Now()
+	oriData, err := model.GetOri(loadCtx)
+	delta := time.Since(startTs)
+	tracing.End(span, err)
+	s.notify(cacheInfo, observe.Event{Type: observe.EventLoad, Duration: delta, Err: err})
 	if err != nil && err != rdscache.ErrNoData {
-		return err
+		return "", err
 	}
 	if err == rdscache.ErrNoData {
 		noDataErr = rdscache.ErrNoData
@@ -56,7 +185,7 @@ func (s *mCacheService) GetOrCreate(ctx context.Context, model ICacheModel, opts
 	// 不需要缓存零值直接返回
 	if noDataErr != nil && !option.needCacheNoData {
 		// 是nil或者零值返回不存在数据异常
-		return noDataErr
+		return "", noDataErr
 	}
 
 	// 获取需缓存的数据并且缓存下来, noData缓存空字符串
@@ -64,21 +193,222 @@ func (s *mCacheService) GetOrCreate(ctx context.Context, model ICacheModel, opts
 	if noDataErr == nil {
 		cacheStr, err = oriData.Marshal()
 		if err != nil {
+			return "", err
+		}
+	}
+	// 记录回源耗时用于提前刷新
+	envelope := common.NewEnvelope(cacheStr, noDataErr != nil)
+	envelope.Delta = delta
+	err = s.set(ctx, cacheInfo, envelope, option)
+	s.notify(cacheInfo, observe.Event{Type: observe.EventSet, Err: err})
+	if err != nil {
+		return "", err
+	}
+
+	return cacheStr, noDataErr
+}
+
+// Refresh 获取数据源并刷新缓存, 数据变更后使用, 成功时数据反序列化到model中, 可选项同GetOrCreate
+// 先删除缓存的全部副本(同Delete)再回源写入, 回源失败时缓存保持删除状态, 下次获取时重新回源
+func (s *mCacheService) Refresh(ctx context.Context, model ICacheModel, opts ...MCOptionWrap) error {
+	if model == nil {
+		return rdscache.ErrModuleMustNotNil
+	}
+	option := NewMCOption(opts...)
+	cacheInfo := model.CacheInfo()
+
+	if err := s.del(ctx, cacheInfo, option.hotKeyOption); err != nil {
+		return err
+	}
+	cacheStr, err := s.create(ctx, cacheInfo, model, option)
+	if err != nil {
+		return err
+	}
+	if err = model.UnMarshal(cacheStr); err != nil {
+		s.unmarshalFail(ctx, cacheInfo, err)
+	}
+	return err
+}
+
+// Delete 删除缓存, hash类型只删除subKey对应的field
+// 传入热key选项(WithHotKeyOption)时同时删除当前实例的本地缓存及全部分片, 使用分片方案时需注册WithAllShardingKeys
+func (s *mCacheService) Delete(ctx context.Context, cacheInfo common.ICacheInfo, opts ...MCOptionWrap) error {
+	if err := common.CheckCacheInfo(cacheInfo); err != nil {
+		return err
+	}
+	return s.del(ctx, cacheInfo, NewMCOption(opts...).hotKeyOption)
+}
+
+// DoubleDelete 延迟双删, 立即删除缓存(同Delete)并在delay后再次删除, 数据变更后使用
+// 防止并发读取未命中的请求在数据变更前读取了旧数据, 在第一次删除后才写入缓存, 导致缓存中长期为旧数据
+// delay需大于读取数据源并写入缓存的耗时; 第二次删除在后台执行, 不使用本次调用的ctx
+// 第一次删除失败时直接返回错误; 第二次删除调度失败(调度器已关闭或任务数达到上限)时返回调度器的错误
+// 第二次删除在后台执行, 失败时通过服务的日志(WithSvcLogger)以Error级别记录
+func (s *mCacheService) DoubleDelete(
+	ctx context.Context, cacheInfo common.ICacheInfo, delay time.Duration, opts ...MCOptionWrap) error {
+	if err := common.CheckCacheInfo(cacheInfo); err != nil {
+		return err
+	}
+	hotKeyOption := NewMCOption(opts...).hotKeyOption
+	if err := s.del(ctx, cacheInfo, hotKeyOption); err != nil {
+		return err
+	}
+	return s.option.scheduler.Schedule(delay, func() {
+		ctx := context.Background()
+		if err := s.del(ctx, cacheInfo, hotKeyOption); err != nil {
+			s.log(ctx, logging.LevelError, "sponge: delayed delete fail", cacheInfo, err)
+		}
+	})
+}
+
+// Shutdown 关闭服务创建的延迟双删调度器, 未到期的第二次删除立即执行, 等待执行完成或ctx结束
+// 注意: 提前执行的第二次删除距第一次删除不足delay, 延迟双删对这些数据不再有防护作用,
+// 因此需在服务停止处理请求(不再有回源写入旧数据的可能)后调用; 关闭后DoubleDelete只执行第一次删除并返回ErrSchedulerClosed
+// 通过WithSvcDelayScheduler指定的调度器可能被多个服务共用, 不会被关闭, 由创建方自行调用其Shutdown
+func (s *mCacheService) Shutdown(ctx context.Context) error {
+	if !s.option.ownScheduler {
+		return nil
+	}
+	return s.option.scheduler.Shutdown(ctx)
+}
+
+// MDelete 批量删除缓存, 通过管道一次性发送, hash类型只删除subKey对应的field, 同时撤销租约; 不处理热key(本地缓存及分片)
+// 热key需要同时删除本地缓存及全部分片时使用MDeleteEntries
+func (s *mCacheService) MDelete(ctx context.Context, cacheInfos ...common.ICacheInfo) error {
+	entries := make([]*common.DeleteEntry, 0, len(cacheInfos))
+	for _, cacheInfo := range cacheInfos {
+		entries = append(entries, common.NewDeleteEntry(cacheInfo, nil))
+	}
+	return s.MDeleteEntries(ctx, entries...)
+}
+
+// MDeleteEntries 批量删除缓存, 通过管道一次性发送, hash类型只删除subKey对应的field
+// 指定了热key选项的缓存同时删除当前实例的本地缓存及全部分片(同Delete), 使用分片方案时需注册WithAllShardingKeys
+func (s *mCacheService) MDeleteEntries(ctx context.Context, entries ...*common.DeleteEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	p := s.store.Pipeline(ctx)
+	defer func() { _ = p.Close() }()
+	localKeys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if err := common.CheckCacheInfo(entry.CacheInfo); err != nil {
+			return err
+		}
+		keys, localKey, err := common.DelKeys(entry.CacheInfo, entry.HotKeyOption)
+		if err != nil {
+			return err
+		}
+		if err = s.delFromPipeline(p, entry.CacheInfo, keys...); err != nil {
+			return err
+		}
+		localKeys = append(localKeys, localKey)
+	}
+	if err := p.Exec(); err != nil {
+		return err
+	}
+	for _, localKey := range localKeys {
+		if err := s.publishInvalidation(ctx, localKey); err != nil {
 			return err
 		}
 	}
-	err = s.Set(ctx, cacheInfo, cacheStr, option)
+	return nil
+}
+
+// del 删除缓存在redis中的全部副本(原始key及全部分片), 及当前实例的本地缓存
+func (s *mCacheService) del(
+	ctx context.Context, cacheInfo common.ICacheInfo, hotKeyOption *common.HotKeyOption) error {
+	keys, localKey, err := common.DelKeys(cacheInfo, hotKeyOption)
 	if err != nil {
 		return err
 	}
 
-	return noDataErr
+	p := s.store.Pipeline(ctx)
+	defer func() { _ = p.Close() }()
+	if err = s.delFromPipeline(p, cacheInfo, keys...); err != nil {
+		return err
+	}
+	if err = p.Exec(); err != nil {
+		return err
+	}
+	// redis中的数据删除后再通知其它实例, 防止其它实例删除本地缓存后又从redis中同步了旧数据
+	return s.publishInvalidation(ctx, localKey)
+}
+
+// publishInvalidation 通知其它实例删除本地缓存中的数据, 未指定失效总线或key为空时不通知
+func (s *mCacheService) publishInvalidation(ctx context.Context, localKey string) error {
+	if s.option.bus == nil || localKey == "" {
+		return nil
+	}
+	return s.option.bus.Publish(ctx, localKey)
+}
+
+// InvalidateTags 删除打上了tags中任一标签的全部缓存(hash类型只删除对应的field), 同时撤销租约并清理标签集合
+// 不处理本地缓存, 热key使用本地缓存时本地缓存中的数据在过期后失效
+func (s *mCacheService) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if err := common.InvalidateTag(ctx, s.store, tag, s.delFromPipeline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delFromPipeline 在管道中删除keys对应的缓存(hash类型删除keys中subKey对应的field), 同时撤销租约
+func (s *mCacheService) delFromPipeline(p backend.IPipeline, cacheInfo common.ICacheInfo, keys ...string) error {
+	if err := common.DelFromPipeline(p, cacheInfo, keys...); err != nil {
+		return err
+	}
+
+	// 撤销未完成的租约, 回源中的请求不再写入旧数据
+	leaseKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		leaseKeys = append(leaseKeys, leaseKey(cacheInfo, key))
+	}
+	p.Del(leaseKeys...)
+	return nil
+}
+
+// leaseKey 缓存key对应的租约key, hash类型包含subKey
+// 以和缓存key同slot的hash tag开头, 使用命名空间或key空间时由存储后端以加了前缀的缓存key重新生成
+func leaseKey(cacheInfo common.ICacheInfo, key string) string {
+	ret := backend.LeaseKey(key)
+	if c, ok := cacheInfo.(*common.HashCache); ok {
+		// subKey可能包含任意字符, 以\x00分隔
+		ret += "\x00" + c.SubKey
+	}
+	return ret
 }
 
 // Set 缓存model，支持缓存零值model, 因为model可能为nil，所以cacheInfo需传入
+// 兼容历史用法, cacheStr为CacheEmptyValue代表缓存数据不存在; 开启信封格式后需缓存空字符串的真实数据时使用SetValue
+// 指定了失效总线且热key使用本地缓存时, 通知其它实例删除本地缓存中的旧数据
 func (s *mCacheService) Set(
 	ctx context.Context, cacheInfo common.ICacheInfo, cacheStr string, option *MCOption) error {
-	return s.set(ctx, cacheInfo, cacheStr, option)
+	return s.setEnvelope(ctx, cacheInfo, common.NewEnvelope(cacheStr, cacheStr == common.CacheEmptyValue), option)
+}
+
+// SetValue 同Set, cacheStr始终为真实数据, 包括序列化结果为空字符串的model
+// 未开启信封格式时空字符串仍会被读取为数据不存在, 需要区分时应开启WithSvcEnvelope
+func (s *mCacheService) SetValue(
+	ctx context.Context, cacheInfo common.ICacheInfo, cacheStr string, option *MCOption) error {
+	return s.setEnvelope(ctx, cacheInfo, common.NewEnvelope(cacheStr, false), option)
+}
+
+// SetNoData 缓存数据不存在, 过期时间同回源时缓存的空数据(WithNoDataTTL、WithSvcNoDataTTL)
+func (s *mCacheService) SetNoData(ctx context.Context, cacheInfo common.ICacheInfo, option *MCOption) error {
+	return s.setEnvelope(ctx, cacheInfo, common.NewEnvelope(common.CacheEmptyValue, true), option)
+}
+
+// setEnvelope 写入缓存, 热key使用本地缓存时通知其它实例删除本地缓存中的旧数据
+func (s *mCacheService) setEnvelope(
+	ctx context.Context, cacheInfo common.ICacheInfo, envelope *common.Envelope, option *MCOption) error {
+	err := s.set(ctx, cacheInfo, envelope, option)
+	if err != nil || option == nil || option.hotKeyOption == nil || !option.hotKeyOption.UseLocalCache() {
+		return err
+	}
+	// 数据已更新, 通知其它实例删除本地缓存中的旧数据
+	return s.publishInvalidation(ctx, option.hotKeyOption.LocalCacheKey())
 }
 
 // MGetOrCreate 批量从缓存中获取数据, 数据不存在需要回源, 回源后的数据会放入缓存中
@@ -93,6 +423,16 @@ func (s *mCacheService) MGetOrCreate(
 	if len(models) == 0 {
 		return nil
 	}
+	ctx, span := s.option.tracer.Start(ctx, "sponge.mcache.MGetOrCreate", tracing.AttrBatchSize.Int(len(models)))
+	err := s.mGetOrCreate(ctx, models, mGetFromOriFunc, optionWraps...)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *mCacheService) mGetOrCreate(
+	ctx context.Context, models []ICanMGetModel,
+	mGetFromOriFunc func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error),
+	optionWraps ...MGetOptionWrap) error {
 
 	option := NewMGetOption(optionWraps...)
 
@@ -100,8 +440,14 @@ func (s *mCacheService) MGetOrCreate(
 	var cacheInfos []common.ICacheInfo
 	for _, m := range models {
 		cacheInfos = append(cacheInfos, m.CacheInfo())
+		if s.option.hotKeys != nil {
+			s.option.hotKeys.RecordCache(cacheInfos[len(cacheInfos)-1])
+		}
 	}
+	startTs := time.Now()
 	cacheValues, err := s.mGet(ctx, cacheInfos)
+	s.notifyBatch(cacheInfos, observe.Event{
+		Type: observe.EventBatchGet, Size: len(cacheInfos), Duration: time.Since(startTs), Err: err})
 	if err != nil {
 		return err
 	}
@@ -111,27 +457,45 @@ func (s *mCacheService) MGetOrCreate(
 	var noCacheModels []ICanMGetModel
 	var noCacheModelsIdxs []int
 	for idx, v := range cacheValues {
-		// 缓存了空，无需反序列化, 无需回源(防止缓存穿透)
+		// 缓存了空，无需回源(防止缓存穿透)
+		hit := false
 		if v != nil {
-			err = models[idx].UnMarshal(v.(string))
-			// 可能是脏数据或者其它原因导致反序列化失败，这种情况打个错误日志，并返回特殊错误
+			hit, err = s.unMarshalMGetValue(v.(string), models[idx])
+			s.notifyRead(ctx, cacheInfos[idx], observe.TierRds, 0, hit, err)
+			if err == rdscache.ErrNoData {
+				err = nil
+			}
+			// 可能是脏数据或者其它原因导致反序列化失败，这种情况已记录错误日志，并返回特殊错误
 			if err != nil {
 				unMarshalErr = rdscache.ErrMGetHaveSomeUnMarshalFail
-				fmt.Println("MGet UnMarshal fail ", models[idx])
 			}
-		} else { // 缓存中无数据
+		}
+		if v == nil {
+			s.notifyRead(ctx, cacheInfos[idx], observe.TierRds, 0, false, nil)
+		}
+		if !hit { // 缓存中无数据
 			noCacheModels = append(noCacheModels, models[idx].Clone())
 			noCacheModelsIdxs = append(noCacheModelsIdxs, idx)
 		}
 	}
 
 	// 数据在缓存中全部存在，不用回源，直接返回
+	s.option.tracer.SetAttributes(ctx, tracing.AttrMissCount.Int(len(noCacheModels)))
 	if len(noCacheModels) == 0 {
 		return unMarshalErr
 	}
+	noCacheInfos := make([]common.ICacheInfo, 0, len(noCacheModels))
+	for _, m := range noCacheModels {
+		noCacheInfos = append(noCacheInfos, m.CacheInfo())
+	}
 
 	// 批量回源查询数据
-	originModels, err := mGetFromOriFunc(ctx, noCacheModels)
+	loadCtx, loadSpan := s.option.tracer.Start(ctx, "sponge.mcache.MLoad", tracing.AttrBatchSize.Int(len(noCacheModels)))
+	startTs = time.Now()
+	originModels, err := mGetFromOriFunc(loadCtx, noCacheModels)
+	tracing.End(loadSpan, err)
+	s.notifyBatch(noCacheInfos, observe.Event{
+		Type: observe.EventLoad, Size: len(noCacheInfos), Duration: time.Since(startTs), Err: err})
 	// TODO：回源方法必须返回全部数据, 例如获取三个缓存中不存在的数据，必须返回三个回源数据, 不存在的数据需返回nil
 	if len(noCacheModels) != len(originModels) {
 		return rdscache.ErrMGetFromOriRetCntNotCorrect
@@ -147,6 +511,7 @@ func (s *mCacheService) MGetOrCreate(
 
 	// 将回源后的数据放入缓存
 	err = s.mSet(ctx, originModels, noCacheModels, option)
+	s.notifyBatch(noCacheInfos, observe.Event{Type: observe.EventSet, Size: len(noCacheInfos), Err: err})
 	if err != nil {
 		return err
 	}
@@ -155,6 +520,24 @@ func (s *mCacheService) MGetOrCreate(
 
 }
 
+// unMarshalMGetValue 将批量获取到的存储值反序列化到model中, 返回是否命中缓存
+// 信封格式的空缓存通过UpdateSelf(nil)标示数据不存在并返回ErrNoData, 历史的原始存储值仍交由UnMarshal处理CacheEmptyValue
+// 数据不存在超过单独指定的过期时间(hash类型的field)时视为未命中, 需要回源
+func (s *mCacheService) unMarshalMGetValue(raw string, model ICanMGetModel) (bool, error) {
+	envelope, err := common.DecodeEnvelope(raw)
+	if err != nil {
+		return true, err
+	}
+	if !envelope.IsRaw() && envelope.NoData() {
+		if envelope.Expired() {
+			return false, nil
+		}
+		model.UpdateSelf(nil)
+		return true, rdscache.ErrNoData
+	}
+	return true, model.UnMarshal(envelope.Value)
+}
+
 // mGet 批量获取
 func (s *mCacheService) mGet(
 	ctx context.Context, cacheInfos []common.ICacheInfo) ([]interface{}, error) {
@@ -184,11 +567,11 @@ func (s *mCacheService) mGetFromRds(
 }
 
 func (s *mCacheService) mGetFromString(ctx context.Context, keys []string) ([]interface{}, error) {
-	return s.rds.MGet(keys...).Result()
+	return s.store.MGet(ctx, keys...)
 }
 
 func (s *mCacheService) mGetFromHash(ctx context.Context, key string, subKeys []string) ([]interface{}, error) {
-	return s.rds.HMGet(key, subKeys...).Result()
+	return s.store.HMGet(ctx, key, subKeys...)
 }
 
 // mSet 批量设置缓存
@@ -203,6 +586,9 @@ func (s *mCacheService) mSetToRds(
 	ctx context.Context, oriModels, noCacheModels []ICanMGetModel,
 	option *MGetOption) error {
 
+	// 数据不存在时使用单独指定的过期时间
+	noDataTTL := s.noDataTTL(option.noDataTTL)
+	var tagRecords []common.TagRecord
 	switch noCacheModels[0].CacheInfo().(type) {
 	case *common.StringCache:
 		var mSetModels []*common.MSetModel
@@ -223,17 +609,28 @@ func (s *mCacheService) mSetToRds(
 			}
 			// 回源数据如果不存在，会返回nil并且会设置到对应的oriModels中，这个时候一些原始信息可能已经改变了
 			// 此时通过oriModels可能拿不到正确的CacheInfo(), 所以需要从对应的没有缓存的noCacheModels(Clone自oriModels)中获取缓存信息
-			mSetModels = append(
-				mSetModels, common.NewMSetModel(
-					noCacheModels[idx].CacheInfo().BaseInfo().Key, v,
-					noCacheModels[idx].CacheInfo().BaseInfo().ExpTime))
+			cacheBase := noCacheModels[idx].CacheInfo().BaseInfo()
+			expTime, needEnvelope := cacheBase.JitterExpTime(s.option.jitter), false
+			if model == nil && noDataTTL > 0 {
+				expTime, needEnvelope = cacheBase.NoDataExpTime(noDataTTL, s.option.jitter), true
+			}
+			mSetModels = append(mSetModels, common.NewMSetModel(
+				cacheBase.Key, s.encodeValue(common.NewEnvelope(v, model == nil), expTime, needEnvelope), expTime))
+			tagRecords = append(tagRecords, common.TagRecord{CacheInfo: noCacheModels[idx].CacheInfo(), ExpTime: expTime})
 		}
 
 		if len(mSetModels) == 0 {
 			return nil
 		}
+		// 先记录标签再写入缓存, 防止两者之间删除标签时遗漏本次写入的缓存
+		if err := common.RecordTags(ctx, s.store, tagRecords...); err != nil {
+			return err
+		}
 		return s.mSetToString(ctx, mSetModels)
 	case *common.HashCache:
+		// hash中的field共用key的过期时间, 数据不存在的field单独指定的过期时间记录在信封中
+		cacheBase := noCacheModels[0].CacheInfo().BaseInfo()
+		expTime := cacheBase.JitterExpTime(s.option.jitter)
 		fields := map[string]interface{}{}
 		for idx, model := range oriModels {
 			var v string
@@ -249,44 +646,46 @@ func (s *mCacheService) mSetToRds(
 					return err
 				}
 			}
-			fields[noCacheModels[idx].CacheInfo().(*common.HashCache).SubKey] = v
+			valueExpTime, needEnvelope := expTime, false
+			if model == nil && noDataTTL > 0 {
+				valueExpTime, needEnvelope = cacheBase.NoDataExpTime(noDataTTL, s.option.jitter), true
+			}
+			cacheInfo := noCacheModels[idx].CacheInfo()
+			fields[cacheInfo.(*common.HashCache).SubKey] = s.encodeValue(
+				common.NewEnvelope(v, model == nil), valueExpTime, needEnvelope)
+			tagRecords = append(tagRecords, common.TagRecord{CacheInfo: cacheInfo, ExpTime: expTime})
 		}
 
 		if len(fields) == 0 {
 			return nil
 		}
-		return s.mSetToHash(
-			ctx, noCacheModels[0].CacheInfo().BaseInfo().Key, fields, noCacheModels[0].CacheInfo().BaseInfo().ExpTime)
+		if err := common.RecordTags(ctx, s.store, tagRecords...); err != nil {
+			return err
+		}
+		return s.mSetToHash(ctx, cacheBase.Key, fields, expTime)
 	default:
 		return errors.New("unknown KT")
 	}
 }
 
 func (s *mCacheService) mSetToString(ctx context.Context, models []*common.MSetModel) error {
-	p := s.rds.Pipeline()
+	p := s.store.Pipeline(ctx)
 	defer func() { _ = p.Close() }()
 
-	var pairs []interface{}
-	for _, model := range models {
-		pairs = append(pairs, model.Key, model.Value)
-	}
-	p.MSet(pairs...)
-
+	// 逐个key带过期时间写入, 集群模式下key分布在不同节点时也可以正常写入
 	for _, model := range models {
-		p.Expire(model.Key, model.ExpTime)
+		p.Set(model.Key, model.Value, model.ExpTime)
 	}
-	_, err := p.Exec()
-	return err
+	return p.Exec()
 }
 
 func (s *mCacheService) mSetToHash(
 	ctx context.Context, key string, fields map[string]interface{}, expTime time.Duration) error {
-	p := s.rds.Pipeline()
+	p := s.store.Pipeline(ctx)
 	defer func() { _ = p.Close() }()
 	p.HMSet(key, fields)
 	p.Expire(key, expTime)
-	_, err := p.Exec()
-	return err
+	return p.Exec()
 }
 
 // get 从缓存中获取后，根据第一个值来判断是否需要直接返回结果
@@ -304,14 +703,12 @@ func (s *mCacheService) get(
 			res, err = hotKeyOption.GetFromLocalCache()
 			// 存在数据
 			if err == nil {
-				// 缓存了空直接返回
-				if res == common.CacheEmptyValue {
-					err = rdscache.ErrNoData
-				} else {
-					err = model.UnMarshal(res)
-				}
+				err = s.parseValue(res, model)
+				s.notifyRead(ctx, cacheInfo, observe.TierLocal, 0, true, err)
+				s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierLocal))
 			} else {
 				directReturn, needSetToLocalCache = false, true
+				s.notifyRead(ctx, cacheInfo, observe.TierLocal, 0, false, nil)
 			}
 
 			if directReturn {
@@ -324,34 +721,203 @@ func (s *mCacheService) get(
 	}
 
 	// 从缓存中获取
+	startTs := time.Now()
 	res, err = s.getFromRds(ctx, cacheInfo)
-	// 访问redis回调
+	duration := time.Since(startTs)
+	// 访问redis回调, 在调用方的协程中同步执行
 	if option.getFromRdsCallBack != nil {
-		go option.getFromRdsCallBack()
+		option.getFromRdsCallBack()
 	}
 
 	directReturn = true
 	// 报错直接返回错误
 	if err != nil {
-		if err == redis.Nil {
+		if err == rdscache.ErrCacheNotExist {
 			directReturn, err = false, nil
 		}
+		s.notifyRead(ctx, cacheInfo, observe.TierRds, duration, false, err)
 	} else {
-		// 缓存结果不为空
-		if res != common.CacheEmptyValue {
-			err = model.UnMarshal(res)
-		} else {
-			err = rdscache.ErrNoData
+		directReturn, err = s.parseRdsValue(cacheInfo, res, model, option)
+		s.notifyRead(ctx, cacheInfo, observe.TierRds, duration, directReturn, err)
+		if directReturn {
+			s.option.tracer.SetAttributes(ctx, tracing.AttrHitTier.String(tracing.TierRds))
 		}
 	}
 
 	// 本地缓存失效，但是redis缓存存在时，需将数据同步至本地缓存
 	if directReturn && needSetToLocalCache {
-		err = hotKeyOption.SetToLocalCache(res)
+		if err == rdscache.ErrNoData {
+			err = hotKeyOption.SetNoDataToLocalCacheWithJitter(res, s.noDataTTL(option.noDataTTL), s.option.jitter)
+		} else {
+			err = hotKeyOption.SetToLocalCacheWithJitter(res, s.option.jitter)
+		}
 	}
 	return
 }
 
+// notifyRead 通知观察者读取缓存的结果, hit为是否命中, 命中时err为解析存储值的错误(解析失败时记录日志), 未命中时err为访问redis的错误
+func (s *mCacheService) notifyRead(ctx context.Context,
+	cacheInfo common.ICacheInfo, tier observe.Tier, duration time.Duration, hit bool, err error) {
+	e := observe.Event{Type: observe.EventHit, Tier: tier, Duration: duration}
+	switch {
+	case !hit:
+		e.Type, e.Err = observe.EventMiss, err
+	case err == rdscache.ErrNoData:
+		e.Type = observe.EventNoDataHit
+	case err != nil:
+		// 命中但存储值解析失败, 先通知命中再记录反序列化失败
+		s.notify(cacheInfo, e)
+		s.unmarshalFail(ctx, cacheInfo, err)
+		return
+	}
+	s.notify(cacheInfo, e)
+}
+
+// unmarshalFail 记录反序列化(解析存储值)失败的日志并通知观察者
+func (s *mCacheService) unmarshalFail(ctx context.Context, cacheInfo common.ICacheInfo, err error) {
+	s.log(ctx, logging.LevelError, "sponge: unmarshal cache value fail", cacheInfo, err)
+	s.notify(cacheInfo, observe.Event{Type: observe.EventUnmarshalFail, Err: err})
+}
+
+// log 记录日志, 字段包含命名空间、缓存key(hash类型包含subKey)及错误, 不包含缓存的内容
+func (s *mCacheService) log(ctx context.Context, level logging.Level, msg string, cacheInfo common.ICacheInfo, err error) {
+	fields := make([]logging.Field, 0, 4)
+	if s.option.namespace != nil {
+		fields = append(fields, logging.Any("namespace", s.option.namespace.Name()))
+	}
+	fields = append(fields, logging.Any("key", cacheInfo.BaseInfo().Key))
+	if c, ok := cacheInfo.(*common.HashCache); ok {
+		fields = append(fields, logging.Any("sub_key", c.SubKey))
+	}
+	s.option.logger.Log(ctx, level, msg, append(fields, logging.Err(err))...)
+}
+
+// notifyBatch 通知观察者批量操作的事件, 补充全部缓存的key
+func (s *mCacheService) notifyBatch(cacheInfos []common.ICacheInfo, e observe.Event) {
+	if s.option.observer == nil {
+		return
+	}
+	e.Keys = make([]string, 0, len(cacheInfos))
+	for _, cacheInfo := range cacheInfos {
+		e.Keys = append(e.Keys, cacheInfo.BaseInfo().Key)
+		if c, ok := cacheInfo.(*common.HashCache); ok {
+			e.SubKeys = append(e.SubKeys, c.SubKey)
+		}
+	}
+	s.notify(nil, e)
+}
+
+// notify 通知观察者, 补充事件的命名空间及缓存key(cacheInfo不为nil时), 未指定观察者时不通知
+func (s *mCacheService) notify(cacheInfo common.ICacheInfo, e observe.Event) {
+	if s.option.observer == nil {
+		return
+	}
+	if s.option.namespace != nil {
+		e.Namespace = s.option.namespace.Name()
+	}
+	if cacheInfo != nil {
+		e.Key = cacheInfo.BaseInfo().Key
+		if c, ok := cacheInfo.(*common.HashCache); ok {
+			e.SubKey = c.SubKey
+		}
+	}
+	s.option.observer.Observe(e)
+}
+
+// parseRdsValue 解析从redis中获取的存储值, 根据第一个值来判断是否需要直接返回结果
+// 超过软过期时间时返回旧数据并在后台刷新缓存; 否则按XFetch算法判断是否需要提前刷新
+func (s *mCacheService) parseRdsValue(
+	cacheInfo common.ICacheInfo, raw string, model ICacheModel, option *MCOption) (bool, error) {
+	envelope, err := common.DecodeEnvelope(raw)
+	if err != nil {
+		return true, err
+	}
+	if envelope.NoData() && envelope.Expired() {
+		// 数据不存在超过单独指定的过期时间(hash类型的field), 视为缓存不存在
+		return false, nil
+	}
+	if envelope.SoftExpired(option.softTTL) {
+		s.refreshInBackground(cacheInfo, model, option)
+		if option.stale != nil {
+			*option.stale = true
+		}
+	} else if envelope.ShouldRefreshEarly(option.earlyRefreshBeta) {
+		// 按XFetch算法提前刷新, 缓存即将过期时少量请求提前回源, 热key过期时不会集中回源
+		return false, nil
+	}
+	return true, s.parseEnvelope(envelope, model)
+}
+
+// refreshInBackground 在后台回源并刷新缓存, 相同key同时只有一个后台刷新
+// 调用方返回后ctx可能被取消, 后台刷新不使用调用方的ctx; 回源失败时不更新缓存, 旧数据继续生效直至硬过期
+// 调用方返回后仍会读写model、缓存信息及可选项, 后台刷新使用它们的拷贝
+func (s *mCacheService) refreshInBackground(cacheInfo common.ICacheInfo, model ICacheModel, option *MCOption) {
+	cacheInfo, model = common.CopyCacheInfo(cacheInfo), snapshotModel(model)
+	refreshOption := *option
+	refreshOption.stale, refreshOption.lease = nil, nil
+	s.refreshing.Go(common.FullKey(cacheInfo), func() {
+		ctx := context.Background()
+		if _, err := s.create(ctx, cacheInfo, model, &refreshOption); err != nil && err != rdscache.ErrNoData {
+			s.log(ctx, logging.LevelError, "sponge: refresh in background fail", cacheInfo, err)
+		}
+	}, func(p interface{}) {
+		s.log(context.Background(), logging.LevelError, "sponge: refresh in background panic",
+			cacheInfo, fmt.Errorf("panic: %v", p))
+	})
+}
+
+// snapshotModel 后台刷新使用的model拷贝, 优先使用Clone(ICanMGetModel), 否则浅拷贝model指向的结构体
+// 回源(GetOri)只读取model的字段, 浅拷贝即可避免和调用方反序列化到model中并发读写
+func snapshotModel(model ICacheModel) ICacheModel {
+	if m, ok := model.(ICanMGetModel); ok {
+		if c, ok := m.Clone().(ICacheModel); ok {
+			return c
+		}
+	}
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return model
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	if ret, ok := c.Interface().(ICacheModel); ok {
+		return ret
+	}
+	return model
+}
+
+// parseValue 解析存储值并反序列化到model中, 缓存了空返回无数据异常
+func (s *mCacheService) parseValue(raw string, model ICacheModel) error {
+	envelope, err := common.DecodeEnvelope(raw)
+	if err != nil {
+		return err
+	}
+	return s.parseEnvelope(envelope, model)
+}
+
+// parseEnvelope 将信封中的数据反序列化到model中, 缓存了空返回无数据异常
+func (s *mCacheService) parseEnvelope(envelope *common.Envelope, model ICacheModel) error {
+	if envelope.NoData() {
+		return rdscache.ErrNoData
+	}
+	return model.UnMarshal(envelope.Value)
+}
+
+// encodeValue 将model序列化后的内容转换为存储值, 开启信封格式、提前刷新或软过期时写入信封并记录过期时间
+// 否则写入原始的序列化内容, 数据不存在时写入CacheEmptyValue
+func (s *mCacheService) encodeValue(envelope *common.Envelope, expTime time.Duration, needEnvelope bool) string {
+	if !s.option.envelope && !needEnvelope {
+		if envelope.NoData() {
+			return common.CacheEmptyValue
+		}
+		return envelope.Value
+	}
+	if expTime > 0 {
+		envelope.ExpireAt = envelope.CreatedAt.Add(expTime)
+	}
+	return envelope.Encode()
+}
+
 func (s *mCacheService) getFromRds(ctx context.Context, cacheInfo common.ICacheInfo) (string, error) {
 	switch cacheInfo := cacheInfo.(type) {
 	case *common.StringCache:
@@ -364,20 +930,34 @@ func (s *mCacheService) getFromRds(ctx context.Context, cacheInfo common.ICacheI
 }
 
 func (s *mCacheService) getFromString(ctx context.Context, key string) (string, error) {
-	return s.rds.Get(key).Result()
+	return s.store.Get(ctx, key)
 }
 
 func (s *mCacheService) getFromHash(ctx context.Context, key string, subKey string) (string, error) {
-	return s.rds.HGet(key, subKey).Result()
+	return s.store.HGet(ctx, key, subKey)
 }
 
 // set 在redis中缓存数据
-func (s *mCacheService) set(ctx context.Context, cacheInfo common.ICacheInfo, res string, option *MCOption) error {
-	var err error
+func (s *mCacheService) set(
+	ctx context.Context, cacheInfo common.ICacheInfo, envelope *common.Envelope, option *MCOption) error {
+	// 过期时间增加随机抖动, 防止同时写入的缓存同时过期
+	expTime := cacheInfo.BaseInfo().JitterExpTime(s.option.jitter)
+	// 数据不存在时使用单独指定的过期时间, hash类型的field共用key的过期时间, 因此记录在信封中
+	var noDataTTL time.Duration
+	if option != nil {
+		noDataTTL = option.noDataTTL
+	}
+	noDataTTL = s.noDataTTL(noDataTTL)
+	valueExpTime, needEnvelope := expTime, option.needEnvelope()
+	if envelope.NoData() && noDataTTL > 0 {
+		valueExpTime, needEnvelope = cacheInfo.BaseInfo().NoDataExpTime(noDataTTL, s.option.jitter), true
+	}
+	res := s.encodeValue(envelope, valueExpTime, needEnvelope)
+	// 首先判断是否需要进行hot key处理
+	needSetToLocalCache := false
+	var hotKeyOption *common.HotKeyOption
 	if option != nil {
-		// 首先判断是否需要进行hot key处理
-		needSetToLocalCache := false
-		hotKeyOption := option.hotKeyOption
+		hotKeyOption = option.hotKeyOption
 		if hotKeyOption != nil && hotKeyOption.IsHotKey() {
 			// 优先考虑使用本地缓存解决
 			if hotKeyOption.UseLocalCache() {
@@ -387,32 +967,99 @@ func (s *mCacheService) set(ctx context.Context, cacheInfo common.ICacheInfo, re
 				cacheInfo.UpdateCacheKey(hotKeyOption.GetShardingKey())
 			}
 		}
+	}
+
+	// 先记录标签再写入缓存, 防止两者之间删除标签时遗漏本次写入的缓存
+	if err := common.RecordTags(ctx, s.store, common.TagRecord{CacheInfo: cacheInfo, ExpTime: expTime}); err != nil {
+		return err
+	}
+
+	// 使用租约时, 租约已被撤销或过期代表数据已变更, redis及本地缓存均不写入
+	if option != nil && option.lease != nil {
+		ok, err := s.setWithLease(ctx, cacheInfo, option.lease, res, valueExpTime, expTime)
+		if err != nil || !ok {
+			return err
+		}
 		if needSetToLocalCache {
-			_ = hotKeyOption.SetToLocalCache(res)
+			s.setToLocalCache(ctx, cacheInfo, hotKeyOption, res, envelope.NoData(), noDataTTL)
+		}
+		return nil
+	}
+
+	if needSetToLocalCache {
+		s.setToLocalCache(ctx, cacheInfo, hotKeyOption, res, envelope.NoData(), noDataTTL)
+	}
+	return s.setToRds(ctx, cacheInfo, res, valueExpTime, expTime)
+}
+
+// setToLocalCache 将存储值写入本地缓存, 数据不存在时使用单独指定的过期时间
+// 写入本地缓存失败不影响写入redis, 只记录日志, 下次读取时从redis同步至本地缓存
+func (s *mCacheService) setToLocalCache(ctx context.Context, cacheInfo common.ICacheInfo,
+	hotKeyOption *common.HotKeyOption, res string, noData bool, noDataTTL time.Duration) {
+	var err error
+	if noData {
+		err = hotKeyOption.SetNoDataToLocalCacheWithJitter(res, noDataTTL, s.option.jitter)
+	} else {
+		err = hotKeyOption.SetToLocalCacheWithJitter(res, s.option.jitter)
+	}
+	if err != nil {
+		s.log(ctx, logging.LevelWarn, "sponge: set local cache fail", cacheInfo, err)
+	}
+}
+
+// setToRds 在redis中写入存储值, string类型使用valueExpTime, hash类型的field共用key的过期时间expTime
+func (s *mCacheService) setToRds(
+	ctx context.Context, cacheInfo common.ICacheInfo, res string, valueExpTime, expTime time.Duration) error {
+	switch cacheInfo := cacheInfo.(type) {
+	case *common.StringCache:
+		return s.setToString(ctx, cacheInfo.Key, res, valueExpTime)
+	case *common.HashCache:
+		return s.setToHash(ctx, cacheInfo.Key, cacheInfo.SubKey, res, expTime)
+	default:
+		return errors.New("unknown KT")
+	}
+}
+
+// setWithLease 租约仍有效时在redis中写入存储值并删除租约, 返回是否写入
+func (s *mCacheService) setWithLease(ctx context.Context, cacheInfo common.ICacheInfo,
+	lease *dlock.Mutex, res string, valueExpTime, expTime time.Duration) (bool, error) {
+	key := cacheInfo.BaseInfo().Key
+	if leaseKey(cacheInfo, key) != lease.Key() {
+		// 使用分片方案时写入的分片key和租约不在同一个slot中, 校验并删除租约后再写入, 无法保证原子性
+		ok, err := s.store.CompareAndDel(ctx, lease.Key(), lease.Token())
+		if err != nil || !ok {
+			return false, err
 		}
+		return true, s.setToRds(ctx, cacheInfo, res, valueExpTime, expTime)
 	}
 
 	switch cacheInfo := cacheInfo.(type) {
 	case *common.StringCache:
-		err = s.setToString(ctx, cacheInfo.Key, res, cacheInfo.ExpTime)
+		return s.store.LeaseSet(ctx, lease.Key(), lease.Token(), key, res, valueExpTime)
 	case *common.HashCache:
-		err = s.setToHash(ctx, cacheInfo.Key, cacheInfo.SubKey, res, cacheInfo.ExpTime)
+		return s.store.LeaseHSet(ctx, lease.Key(), lease.Token(), key, cacheInfo.SubKey, res, expTime)
 	default:
-		err = errors.New("unknown KT")
+		return false, errors.New("unknown KT")
 	}
-	return err
+}
+
+// noDataTTL 数据不存在的过期时间, 优先使用单次调用指定的callTTL, 均未指定时为0
+func (s *mCacheService) noDataTTL(callTTL time.Duration) time.Duration {
+	if callTTL > 0 {
+		return callTTL
+	}
+	return s.option.noDataTTL
 }
 
 // setToString 向string中设置缓存数据
 func (s *mCacheService) setToString(ctx context.Context, key string, res string, expTime time.Duration) error {
-	_, err := s.rds.Set(key, res, expTime).Result()
-	return err
+	return s.store.Set(ctx, key, res, expTime)
 }
 
 // setToHash 向hash中设置缓存数据
 func (s *mCacheService) setToHash(
 	ctx context.Context, key string, subKey string, res string, expTime time.Duration) error {
-	_, err := s.rds.HSet(key, subKey, res).Result()
+	err := s.store.HSet(ctx, key, subKey, res)
 	if err != nil {
 		return err
 	}
@@ -420,10 +1067,32 @@ func (s *mCacheService) setToHash(
 	if expTime <= 0 {
 		return nil
 	}
-	_, err = s.rds.Expire(key, expTime).Result()
-	return err
+	return s.store.Expire(ctx, key, expTime)
+}
+
+func NewModelCacheSvc(rds *redis.Client, opts ...MCSvcOptionWrap) *mCacheService {
+	return NewModelCacheSvcWithBackend(backend.NewRedisBackend(rds), opts...)
 }
 
-func NewModelCacheSvc(rds *redis.Client) *mCacheService {
-	return &mCacheService{rds: rds}
+// NewModelCacheSvcWithBackend 使用指定的存储后端创建model缓存服务, 例如redis集群、哨兵等
+func NewModelCacheSvcWithBackend(store backend.IBackend, opts ...MCSvcOptionWrap) *mCacheService {
+	option := newMCacheSvcOption(opts...)
+	if option.scheduler == nil {
+		option.scheduler, option.ownScheduler = common.NewDelayScheduler(defaultMaxDelayTasks), true
+	}
+	// 链路追踪在最内层, span中记录的是实际访问存储后端的key
+	store = tracing.NewBackend(store, option.tracer)
+	// 先包装key空间再包装命名空间, 实际的key为: key空间前缀 命名空间前缀 key
+	if option.keySpace != nil {
+		store = backend.NewPrefixBackend(store, option.keySpace)
+	}
+	if option.namespace != nil {
+		store = backend.NewPrefixBackend(store, option.namespace)
+	}
+	return &mCacheService{
+		store:      backend.NewTransformBackend(store, option.transformers()...),
+		option:     option,
+		flight:     common.NewSingleFlight(),
+		refreshing: common.NewSingleFlight(),
+	}
 }
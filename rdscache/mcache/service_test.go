@@ -5,17 +5,30 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
 	"github.com/693490554/sponge/rdscache/common"
+	"github.com/693490554/sponge/rdscache/compress"
+	"github.com/693490554/sponge/rdscache/dlock"
+	"github.com/693490554/sponge/rdscache/encrypt"
+	"github.com/693490554/sponge/rdscache/invalidate"
+	"github.com/693490554/sponge/rdscache/logging"
+	"github.com/693490554/sponge/rdscache/namespace"
+	"github.com/693490554/sponge/rdscache/observe"
+	"github.com/693490554/sponge/rdscache/tracing"
 	"github.com/allegro/bigcache"
 	. "github.com/glycerine/goconvey/convey"
 	"github.com/go-redis/redis"
 	json "github.com/json-iterator/go"
 	goCache "github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -43,6 +56,28 @@ func delTestData() {
 	}
 }
 
+// raceModel 回源时读取自身字段的model, 用于检测后台刷新和调用方并发读写model
+type raceModel struct {
+	ID int `json:"id"`
+	A  int `json:"a"`
+}
+
+func (m *raceModel) CacheInfo() common.ICacheInfo {
+	return common.NewStringCache(key, time.Hour)
+}
+
+func (m *raceModel) Marshal() (string, error) {
+	return json.MarshalToString(m)
+}
+
+func (m *raceModel) UnMarshal(value string) error {
+	return json.UnmarshalFromString(value, m)
+}
+
+func (m *raceModel) GetOri(ctx context.Context) (ICacheModel, error) {
+	return &raceModel{ID: m.ID, A: m.ID * 10}, nil
+}
+
 type TestStringModel struct {
 	A int `json:"a"`
 }
@@ -51,7 +86,7 @@ func (m *TestStringModel) CacheInfo() common.ICacheInfo {
 	return common.NewStringCache(key, expTime)
 }
 
-func (m *TestStringModel) GetOri() (ICacheModel, error) {
+func (m *TestStringModel) GetOri(ctx context.Context) (ICacheModel, error) {
 
 	return &TestStringModel{A: testModelAValue}, nil
 }
@@ -72,7 +107,7 @@ func (m *TestHashModel) CacheInfo() common.ICacheInfo {
 	return common.NewHashCache(key, subKey, expTime)
 }
 
-func (m *TestHashModel) GetOri() (ICacheModel, error) {
+func (m *TestHashModel) GetOri(ctx context.Context) (ICacheModel, error) {
 	return nil, rdscache.ErrNoData
 }
 
@@ -84,6 +119,30 @@ func (m *TestHashModel) UnMarshal(value string) error {
 	return json.UnmarshalFromString(value, m)
 }
 
+// TestSingleFlightModel 回源较慢并记录回源次数的model
+type TestSingleFlightModel struct {
+	A      int    `json:"a"`
+	oriCnt *int32 // 回源次数
+}
+
+func (m *TestSingleFlightModel) CacheInfo() common.ICacheInfo {
+	return common.NewStringCache(key, expTime)
+}
+
+func (m *TestSingleFlightModel) GetOri(ctx context.Context) (ICacheModel, error) {
+	atomic.AddInt32(m.oriCnt, 1)
+	time.Sleep(time.Millisecond * 100)
+	return &TestSingleFlightModel{A: testModelAValue}, nil
+}
+
+func (m *TestSingleFlightModel) Marshal() (string, error) {
+	return json.MarshalToString(m)
+}
+
+func (m *TestSingleFlightModel) UnMarshal(value string) error {
+	return json.UnmarshalFromString(value, m)
+}
+
 func TestMain(m *testing.M) {
 	code := m.Run()
 	delTestData()
@@ -176,8 +235,9 @@ func Test_mCacheService_GetOrCreate(t *testing.T) {
 			lock.Lock()
 			newCtx, cancel := context.WithTimeout(context.Background(), time.Second*2) // 两秒后超时
 			defer cancel()
+			errCh := make(chan error, 1)
 			go func() {
-				_ = mcSvc.GetOrCreate(newCtx, data, WithLock(lock))
+				errCh <- mcSvc.GetOrCreate(newCtx, data, WithLock(lock))
 			}()
 			startTs := time.Now().Unix()
 			for range newCtx.Done() {
@@ -188,12 +248,9 @@ func Test_mCacheService_GetOrCreate(t *testing.T) {
 				So(err, ShouldEqual, redis.Nil)
 				So(endTs-startTs, ShouldBeGreaterThan, 1)
 			}
-			// 释放锁, 释放锁后函数会继续运行
+			// 等待锁时ctx超时, 函数直接返回ctx的错误, 不会继续回源
+			So(<-errCh, ShouldEqual, context.DeadlineExceeded)
 			lock.Unlock()
-			// 等待函数运行完毕后再清数据
-			time.Sleep(time.Second)
-			// 因为ctx取消后函数内部并没有实现中断, 清理数据假定为中断没继续运行``
-			delTestData()
 			err := mcSvc.GetOrCreate(ctx, data, WithLock(lock))
 			So(err, ShouldBeNil)
 			// 缓存中有数据
@@ -483,6 +540,21 @@ func (m *TestMGetStringModel) Clone() ICanMGetModel {
 	}
 }
 
+// TestTaggedMGetModel 打上了标签的批量获取model
+type TestTaggedMGetModel struct {
+	TestMGetStringModel
+}
+
+func (m *TestTaggedMGetModel) CacheInfo() common.ICacheInfo {
+	cacheInfo := m.TestMGetStringModel.CacheInfo().(*common.StringCache)
+	cacheInfo.Tags = []string{"tag"}
+	return cacheInfo
+}
+
+func (m *TestTaggedMGetModel) Clone() ICanMGetModel {
+	return &TestTaggedMGetModel{TestMGetStringModel{A: m.A, B: m.B}}
+}
+
 type TestMGetHashModel struct {
 	A int `json:"a"`
 	B int `json:"b"`
@@ -897,3 +969,747 @@ func Test_mCacheService_MGetOrCreate(t *testing.T) {
 		})
 	})
 }
+
+func Test_mCacheService_MemoryBackend(t *testing.T) {
+	memStore := backend.NewMemoryBackend()
+	memSvc := NewModelCacheSvcWithBackend(memStore)
+
+	Convey("使用进程内存储后端, 无需redis", t, func() {
+		memStore.Flush()
+
+		Convey("GetOrCreate:首次回源放入缓存, 再次获取直接从缓存中获取", func() {
+			expTime = 10 * time.Second
+			m := &TestStringModel{}
+			So(memSvc.GetOrCreate(ctx, m), ShouldBeNil)
+			v, err := memStore.Get(ctx, key)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, `{"a":1}`)
+			So(memStore.TTL(key), ShouldBeGreaterThan, 9*time.Second)
+
+			_ = memStore.Set(ctx, key, `{"a":100}`, 0)
+			m = &TestStringModel{}
+			So(memSvc.GetOrCreate(ctx, m), ShouldBeNil)
+			So(m.A, ShouldEqual, 100)
+			expTime = 0 // 还原全局变量
+		})
+
+		Convey("GetOrCreate:等待锁时ctx超时直接返回", func() {
+			lock.Lock()
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+			defer cancel()
+			So(memSvc.GetOrCreate(timeoutCtx, &TestStringModel{}, WithLock(lock)), ShouldEqual, context.DeadlineExceeded)
+			lock.Unlock()
+			_, err := memStore.Get(ctx, key)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		})
+
+		Convey("GetOrCreate:hash缓存无数据, 预防缓存穿透", func() {
+			m := &TestHashModel{}
+			So(memSvc.GetOrCreate(ctx, m, WithNeedCacheNoData()), ShouldEqual, rdscache.ErrNoData)
+			v, err := memStore.HGet(ctx, key, subKey)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, common.CacheEmptyValue)
+			So(memSvc.GetOrCreate(ctx, m), ShouldEqual, rdscache.ErrNoData)
+		})
+
+		Convey("删除及刷新缓存", func() {
+			// 刷新: 重新获取数据源并反序列化到model中
+			_ = memStore.Set(ctx, key, `{"a":100}`, 0)
+			m := &TestStringModel{}
+			So(memSvc.Refresh(ctx, m), ShouldBeNil)
+			So(m.A, ShouldEqual, testModelAValue)
+			v, _ := memStore.Get(ctx, key)
+			So(v, ShouldEqual, fmt.Sprintf(`{"a":%d}`, testModelAValue))
+
+			So(memSvc.Delete(ctx, m.CacheInfo()), ShouldBeNil)
+			So(memStore.TTL(key), ShouldEqual, -2*time.Second)
+
+			// hash类型只删除subKey对应的field, 数据不存在时刷新后缓存被删除
+			_ = memStore.HSet(ctx, key, subKey, `{"a":100}`)
+			_ = memStore.HSet(ctx, key, "other", "v")
+			So(memSvc.Refresh(ctx, &TestHashModel{}), ShouldEqual, rdscache.ErrNoData)
+			_, err := memStore.HGet(ctx, key, subKey)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			// 批量删除
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 1), "v", 0)
+			_ = memStore.HSet(ctx, key, subKey, "v")
+			So(memSvc.MDelete(ctx, (&TestMGetStringModel{A: 1}).CacheInfo(), (&TestHashModel{}).CacheInfo()), ShouldBeNil)
+			So(memStore.TTL(fmt.Sprintf(keyForMGet, 1)), ShouldEqual, -2*time.Second)
+			_, err = memStore.HGet(ctx, key, subKey)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			v, _ = memStore.HGet(ctx, key, "other")
+			So(v, ShouldEqual, "v")
+		})
+
+		Convey("延迟双删, string及hash类型均删除两次", func() {
+			svc := NewModelCacheSvcWithBackend(memStore)
+			for _, m := range []ICacheModel{&TestStringModel{}, &TestHashModel{}} {
+				cacheInfo := m.CacheInfo()
+				_ = svc.Set(ctx, cacheInfo, `{"a":1}`, nil)
+				So(svc.DoubleDelete(ctx, cacheInfo, time.Millisecond*50), ShouldBeNil)
+				_, err := svc.getFromRds(ctx, cacheInfo)
+				So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+				// 模拟并发读取的请求在第一次删除后写入了旧数据
+				_ = svc.Set(ctx, cacheInfo, `{"a":1}`, nil)
+				time.Sleep(time.Millisecond * 100)
+				_, err = svc.getFromRds(ctx, cacheInfo)
+				So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			}
+
+			// 关闭时未到期的第二次删除立即执行, 关闭后只执行第一次删除
+			cacheInfo := (&TestStringModel{}).CacheInfo()
+			So(svc.DoubleDelete(ctx, cacheInfo, time.Minute), ShouldBeNil)
+			_ = svc.Set(ctx, cacheInfo, `{"a":1}`, nil)
+			So(svc.Shutdown(ctx), ShouldBeNil)
+			_, err := svc.getFromRds(ctx, cacheInfo)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+			So(svc.DoubleDelete(ctx, cacheInfo, time.Minute), ShouldEqual, rdscache.ErrSchedulerClosed)
+
+			// 指定的调度器可能被多个服务共用, 服务的Shutdown不关闭该调度器
+			scheduler := common.NewDelayScheduler(0)
+			sharedSvc := NewModelCacheSvcWithBackend(memStore, WithSvcDelayScheduler(scheduler))
+			So(sharedSvc.Shutdown(ctx), ShouldBeNil)
+			So(sharedSvc.DoubleDelete(ctx, cacheInfo, time.Minute), ShouldBeNil)
+			So(scheduler.Pending(), ShouldEqual, 1)
+			So(scheduler.Shutdown(ctx), ShouldBeNil)
+		})
+
+		Convey("按标签批量删除缓存, 包括批量写入的缓存", func() {
+			cacheInfo := (&TestStringModel{}).CacheInfo()
+			cacheInfo.(*common.StringCache).Tags = []string{"tag"}
+			So(memSvc.Set(ctx, cacheInfo, `{"a":1}`, nil), ShouldBeNil)
+
+			So(memSvc.MGetOrCreate(ctx, []ICanMGetModel{
+				&TestTaggedMGetModel{TestMGetStringModel{A: 1}}, &TestTaggedMGetModel{TestMGetStringModel{A: 2}}},
+				func(ctx context.Context, models []ICanMGetModel) ([]ICanMGetModel, error) {
+					return models, nil
+				}), ShouldBeNil)
+			members, _ := memStore.SMembers(ctx, common.TagKey("tag"))
+			So(members, ShouldHaveLength, 3)
+
+			So(memSvc.InvalidateTags(ctx, "tag"), ShouldBeNil)
+			So(memStore.TTL(key), ShouldEqual, -2*time.Second)
+			for i := 1; i <= 2; i++ {
+				So(memStore.TTL(fmt.Sprintf(keyForMGet, i)), ShouldEqual, -2*time.Second)
+			}
+			So(memStore.TTL(common.TagKey("tag")), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("命名空间:递增代数后缓存全部失效, 重新回源", func() {
+			ns := namespace.MustNew(memStore, "test", namespace.WithLocalTTL(0))
+			nsSvc := NewModelCacheSvcWithBackend(memStore, WithSvcNamespace(ns))
+			So(nsSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldBeNil)
+			_ = memStore.Set(ctx, "test:0:"+key, `{"a":100}`, 0)
+			m := &TestStringModel{}
+			So(nsSvc.GetOrCreate(ctx, m), ShouldBeNil)
+			So(m.A, ShouldEqual, 100)
+			So(memStore.TTL(key), ShouldEqual, -2*time.Second)
+
+			_, _ = ns.Bump(ctx)
+			So(nsSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldBeNil)
+			v, _ := memStore.Get(ctx, "test:1:"+key)
+			So(v, ShouldEqual, fmt.Sprintf(`{"a":%d}`, testModelAValue))
+		})
+
+		Convey("key空间:服务读写的所有key加上环境及前缀, 前缀在命名空间之外", func() {
+			space := common.MustKeySpace("app", common.WithKeyEnv("prod"))
+			ns := namespace.MustNew(memStore, "test", namespace.WithLocalTTL(0))
+			spaceSvc := NewModelCacheSvcWithBackend(memStore, WithSvcKeySpace(space), WithSvcNamespace(ns))
+			So(spaceSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldBeNil)
+			v, _ := memStore.Get(ctx, "prod:app:test:0:"+key)
+			So(v, ShouldEqual, fmt.Sprintf(`{"a":%d}`, testModelAValue))
+			So(memStore.TTL(key), ShouldEqual, -2*time.Second)
+		})
+
+		Convey("更新热key时通知其它实例删除本地缓存", func() {
+			pubSub := invalidate.NewMemoryPubSub()
+			bus, _ := invalidate.NewBus(ctx, pubSub)
+			defer func() { _ = bus.Close() }()
+			otherLocalCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+			otherBus, _ := invalidate.NewBus(ctx, pubSub, invalidate.WithLocalCaches(otherLocalCache))
+			defer func() { _ = otherBus.Close() }()
+
+			svc := NewModelCacheSvcWithBackend(memStore, WithSvcInvalidationBus(bus))
+			localCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+			hotKeyOption, _ := common.NewHotKeyOption(
+				common.WithLocalCache(localCache, common.NewCacheBase(key, time.Minute)))
+			_ = otherLocalCache.Set(common.NewCacheBase(key, time.Minute), `{"a":1}`)
+
+			m := &TestStringModel{}
+			So(svc.Set(ctx, m.CacheInfo(), `{"a":2}`, NewMCOption(WithHotKeyOption(hotKeyOption))), ShouldBeNil)
+			time.Sleep(time.Millisecond * 50)
+			_, err := otherLocalCache.Get(key)
+			So(err, ShouldEqual, rdscache.ErrLocalCacheNoData)
+			So(bus.Stats().Published, ShouldEqual, 1)
+
+			// 未使用本地缓存时不发布
+			So(svc.Set(ctx, m.CacheInfo(), `{"a":3}`, nil), ShouldBeNil)
+			So(bus.Stats().Published, ShouldEqual, 1)
+		})
+
+		Convey("观察者:批量获取时逐个通知命中及未命中, 按批次通知回源及写入", func() {
+			var events []observe.Event
+			obsSvc := NewModelCacheSvcWithBackend(memStore, WithSvcEnvelope(),
+				WithSvcObserver(observe.ObserverFunc(func(e observe.Event) {
+					events = append(events, e)
+				})))
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 1), `{"a":1,"b":1}`, 0)
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{nil}, nil
+			}
+			So(obsSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}},
+				mGetOriginFunc, WithMGetNeedCacheNoData()), ShouldBeNil)
+			So(events, ShouldHaveLength, 5)
+			So(events[0].Type, ShouldEqual, observe.EventBatchGet)
+			So(events[0].Size, ShouldEqual, 2)
+			So(events[0].Keys, ShouldResemble, []string{fmt.Sprintf(keyForMGet, 1), fmt.Sprintf(keyForMGet, 2)})
+			So(events[1].Type, ShouldEqual, observe.EventHit)
+			So(events[1].Key, ShouldEqual, fmt.Sprintf(keyForMGet, 1))
+			So(events[2].Type, ShouldEqual, observe.EventMiss)
+			So(events[2].Key, ShouldEqual, fmt.Sprintf(keyForMGet, 2))
+			So(events[3].Type, ShouldEqual, observe.EventLoad)
+			So(events[3].Key, ShouldEqual, "")
+			So(events[3].Keys, ShouldResemble, []string{fmt.Sprintf(keyForMGet, 2)})
+			So(events[4].Type, ShouldEqual, observe.EventSet)
+			So(events[4].Keys, ShouldResemble, []string{fmt.Sprintf(keyForMGet, 2)})
+
+			// hash类型同时记录subKey
+			events = nil
+			So(obsSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetHashModel{A: 1}}, func(
+				ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{nil}, nil
+			}), ShouldBeNil)
+			So(events[0].Keys, ShouldResemble, []string{key})
+			So(events[0].SubKeys, ShouldResemble, []string{fmt.Sprintf(keyForMGet, 1)})
+
+			events = nil
+			So(obsSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 2}}, mGetOriginFunc), ShouldBeNil)
+			So(events, ShouldHaveLength, 2)
+			So(events[1].Type, ShouldEqual, observe.EventNoDataHit)
+
+			events = nil
+			So(obsSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldBeNil)
+			So(events, ShouldHaveLength, 3)
+			So(events[2].Type, ShouldEqual, observe.EventSet)
+		})
+
+		Convey("链路追踪:以调用方的span为父span, 记录命中层级、批量获取的数量及回源", func() {
+			r := &spanRecorder{}
+			traceSvc := NewModelCacheSvcWithBackend(memStore, WithSvcTracing(r))
+			parentCtx, parent := r.Start(ctx, "parent")
+
+			So(traceSvc.GetOrCreate(parentCtx, &TestStringModel{}), ShouldBeNil)
+			span := r.last("sponge.mcache.GetOrCreate")
+			So(span.parent, ShouldEqual, parent)
+			So(span.attrs[tracing.AttrKey], ShouldEqual, key)
+			So(span.attrs[tracing.AttrHitTier], ShouldEqual, tracing.TierOrigin)
+			So(r.last("sponge.mcache.Load").parent, ShouldEqual, span)
+			So(r.last("sponge.backend.Get").parent, ShouldEqual, span)
+
+			So(traceSvc.GetOrCreate(parentCtx, &TestStringModel{}), ShouldBeNil)
+			So(r.last("sponge.mcache.GetOrCreate").attrs[tracing.AttrHitTier], ShouldEqual, tracing.TierRds)
+
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 1), `{"a":1,"b":1}`, 0)
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				So(trace.SpanFromContext(ctx), ShouldEqual, r.last("sponge.mcache.MLoad"))
+				return []ICanMGetModel{nil}, nil
+			}
+			So(traceSvc.MGetOrCreate(parentCtx, []ICanMGetModel{&TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}},
+				mGetOriginFunc), ShouldBeNil)
+			span = r.last("sponge.mcache.MGetOrCreate")
+			So(span.attrs[tracing.AttrBatchSize], ShouldEqual, int64(2))
+			So(span.attrs[tracing.AttrMissCount], ShouldEqual, int64(1))
+			So(r.last("sponge.mcache.MLoad").parent, ShouldEqual, span)
+			So(r.last("sponge.mcache.MLoad").attrs[tracing.AttrBatchSize], ShouldEqual, int64(1))
+		})
+
+		Convey("日志:批量获取时反序列化失败记录错误日志及缓存key", func() {
+			var logs []string
+			logSvc := NewModelCacheSvcWithBackend(memStore, WithSvcLogger(
+				logging.LoggerFunc(func(ctx context.Context, level logging.Level, msg string, fields ...logging.Field) {
+					logs = append(logs, fmt.Sprint(level, msg, fields))
+				})))
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 1), "not json", 0)
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 2), `{"a":2,"b":2}`, 0)
+			err := logSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}},
+				func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+					return []ICanMGetModel{nil}, nil
+				})
+			So(err, ShouldEqual, rdscache.ErrMGetHaveSomeUnMarshalFail)
+			So(logs, ShouldHaveLength, 1)
+			So(logs[0], ShouldContainSubstring, "ERROR")
+			So(logs[0], ShouldContainSubstring, fmt.Sprintf(keyForMGet, 1))
+		})
+
+		Convey("MGetOrCreate:部分数据回源, 回源后放入缓存", func() {
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 1), `{"a":1,"b":1}`, 0)
+			var oriCnt int
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				oriCnt = len(noCacheModels)
+				return []ICanMGetModel{&TestMGetStringModel{A: 2, B: 2}, nil}, nil
+			}
+			m1, m2, m3 := &TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}, &TestMGetStringModel{A: 3}
+			err := memSvc.MGetOrCreate(
+				ctx, []ICanMGetModel{m1, m2, m3}, mGetOriginFunc, WithMGetNeedCacheNoData())
+			So(err, ShouldBeNil)
+			So(oriCnt, ShouldEqual, 2)
+			So(m1.B, ShouldEqual, 1)
+			So(m2.B, ShouldEqual, 2)
+			So(m3.A, ShouldEqual, 0)
+
+			ret, _ := memStore.MGet(ctx, fmt.Sprintf(keyForMGet, 2), fmt.Sprintf(keyForMGet, 3))
+			So(ret[0], ShouldEqual, `{"a":2,"b":2}`)
+			So(ret[1], ShouldEqual, common.CacheEmptyValue)
+			So(memStore.TTL(fmt.Sprintf(keyForMGet, 3)), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("数据不存在使用单独指定的过期时间", func() {
+			svc := NewModelCacheSvcWithBackend(memStore, WithSvcNoDataTTL(time.Minute))
+			var oriCnt int
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				oriCnt += len(noCacheModels)
+				return []ICanMGetModel{nil}, nil
+			}
+
+			// string类型直接作为key的过期时间, 单次调用指定的优先
+			So(svc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 2}}, mGetOriginFunc,
+				WithMGetNeedCacheNoData(), WithMGetNoDataTTL(time.Second)), ShouldBeNil)
+			So(memStore.TTL(fmt.Sprintf(keyForMGet, 2)), ShouldBeBetweenOrEqual, time.Millisecond*900, time.Second)
+
+			// hash类型的field共用key的过期时间, 数据不存在的field过期时间记录在信封中, 过期后重新回源
+			oriCnt = 0
+			for i := 0; i < 2; i++ {
+				So(svc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetHashModel{A: 1}}, mGetOriginFunc,
+					WithMGetNeedCacheNoData()), ShouldBeNil)
+			}
+			So(oriCnt, ShouldEqual, 1)
+
+			field := fmt.Sprintf(keyForMGet, 1)
+			v, _ := memStore.HGet(ctx, key, field)
+			envelope, err := common.DecodeEnvelope(v)
+			So(err, ShouldBeNil)
+			So(envelope.NoData(), ShouldBeTrue)
+			So(envelope.ExpireAt.Sub(time.Now()), ShouldBeBetweenOrEqual, time.Second*59, time.Minute)
+			envelope.ExpireAt = time.Now()
+			_ = memStore.HSet(ctx, key, field, envelope.Encode())
+			So(svc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetHashModel{A: 1}}, mGetOriginFunc,
+				WithMGetNeedCacheNoData()), ShouldBeNil)
+			So(oriCnt, ShouldEqual, 2)
+		})
+
+		Convey("存储值超过阈值时压缩", func() {
+			compressSvc := NewModelCacheSvcWithBackend(memStore, WithSvcCompress(compress.NewGzipCompressor(), 100))
+			bigValue := fmt.Sprintf(`{"a":1,"b":1,"pad":"%s"}`, strings.Repeat("x", 1000))
+			So(compressSvc.Set(ctx, (&TestStringModel{}).CacheInfo(), bigValue, nil), ShouldBeNil)
+			raw, _ := memStore.Get(ctx, key)
+			So(len(raw), ShouldBeLessThan, len(bigValue))
+
+			// 读取时自动解压, 未配置压缩的服务读取到的是压缩后的数据
+			m := &TestStringModel{}
+			So(compressSvc.GetOrCreate(ctx, m), ShouldBeNil)
+			So(m.A, ShouldEqual, 1)
+			So(memSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldNotBeNil)
+
+			// 批量获取
+			mGetCacheInfo := (&TestMGetStringModel{A: 1}).CacheInfo()
+			So(compressSvc.Set(ctx, mGetCacheInfo, bigValue, nil), ShouldBeNil)
+			m1 := &TestMGetStringModel{A: 1}
+			So(compressSvc.MGetOrCreate(ctx, []ICanMGetModel{m1}, nil), ShouldBeNil)
+			So(m1.B, ShouldEqual, 1)
+		})
+
+		Convey("加密存储值, 同步至本地缓存的数据为解密后的数据", func() {
+			keyring, _ := encrypt.NewKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef")})
+			encryptSvc := NewModelCacheSvcWithBackend(
+				memStore, WithSvcCompress(compress.NewGzipCompressor(), 100), WithSvcEncrypt(keyring))
+			So(encryptSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldBeNil)
+			raw, _ := memStore.Get(ctx, key)
+			So(raw, ShouldNotContainSubstring, `"a"`)
+
+			localCache := common.NewWrapGoCache(goCache.New(time.Minute, time.Minute))
+			hotKeyOption, _ := common.NewHotKeyOption(
+				common.WithLocalCache(localCache, common.NewCacheBase(key, time.Minute)))
+			m := &TestStringModel{}
+			So(encryptSvc.GetOrCreate(ctx, m, WithHotKeyOption(hotKeyOption)), ShouldBeNil)
+			So(m.A, ShouldEqual, testModelAValue)
+			v, err := localCache.Get(key)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, `{"a":1}`)
+
+			// 批量写入及获取
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{&TestMGetStringModel{A: 1, B: 1}, nil}, nil
+			}
+			So(encryptSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}},
+				mGetOriginFunc, WithMGetNeedCacheNoData()), ShouldBeNil)
+			ret, _ := memStore.MGet(ctx, fmt.Sprintf(keyForMGet, 1), fmt.Sprintf(keyForMGet, 2))
+			So(ret[0], ShouldNotEqual, `{"a":1,"b":1}`)
+			So(ret[1], ShouldNotEqual, common.CacheEmptyValue)
+			m1, m2 := &TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}
+			So(encryptSvc.MGetOrCreate(ctx, []ICanMGetModel{m1, m2}, nil), ShouldBeNil)
+			So(m1.B, ShouldEqual, 1)
+			So(m2.A, ShouldEqual, 0)
+
+			// 绕过加密直接写入redis的数据不会被读取
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 1), `{"a":1,"b":100}`, 0)
+			_ = memStore.Set(ctx, key, `{"a":100}`, 0)
+			So(encryptSvc.GetOrCreate(ctx, &TestStringModel{}), ShouldEqual, rdscache.ErrValueNotEncrypted)
+			m1 = &TestMGetStringModel{A: 1}
+			So(encryptSvc.MGetOrCreate(ctx, []ICanMGetModel{m1}, func(
+				ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{&TestMGetStringModel{A: 1, B: 1}}, nil
+			}), ShouldBeNil)
+			So(m1.B, ShouldEqual, 1)
+		})
+
+		Convey("MGetOrCreate:hash缓存", func() {
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{&TestMGetHashModel{A: 1, B: 1}, nil}, nil
+			}
+			m1, m2 := &TestMGetHashModel{A: 1}, &TestMGetHashModel{A: 2}
+			So(memSvc.MGetOrCreate(ctx, []ICanMGetModel{m1, m2}, mGetOriginFunc), ShouldBeNil)
+			So(m1.B, ShouldEqual, 1)
+			So(m2.A, ShouldEqual, 0)
+			v, _ := memStore.HGet(ctx, key, fmt.Sprintf(keyForMGet, 1))
+			So(v, ShouldEqual, `{"a":1,"b":1}`)
+			So(memStore.TTL(key), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("GetOrCreate:按缓存key合并并发的回源请求", func() {
+			var oriCnt int32
+			wg := sync.WaitGroup{}
+			models := make([]*TestSingleFlightModel, 10)
+			for i := 0; i < 10; i++ {
+				models[i] = &TestSingleFlightModel{oriCnt: &oriCnt}
+				wg.Add(1)
+				go func(m *TestSingleFlightModel) {
+					defer wg.Done()
+					_ = memSvc.GetOrCreate(ctx, m, WithSingleFlight())
+				}(models[i])
+			}
+			wg.Wait()
+			So(atomic.LoadInt32(&oriCnt), ShouldEqual, 1)
+			// 共享回源结果的请求均反序列化到了各自的model中
+			for _, m := range models {
+				So(m.A, ShouldEqual, testModelAValue)
+			}
+		})
+
+		Convey("GetOrCreate:多实例使用分布式锁, 只有一个请求回源", func() {
+			var oriCnt int32
+			wg := sync.WaitGroup{}
+			models := make([]*TestSingleFlightModel, 10)
+			for i := 0; i < 10; i++ {
+				models[i] = &TestSingleFlightModel{oriCnt: &oriCnt}
+				// 每个服务模拟一个实例, 共享同一个存储后端
+				instance := NewModelCacheSvcWithBackend(memStore)
+				wg.Add(1)
+				go func(m *TestSingleFlightModel) {
+					defer wg.Done()
+					_ = instance.GetOrCreate(ctx, m, WithDistributedLock(dlock.WithPollInterval(time.Millisecond*10)))
+				}(models[i])
+			}
+			wg.Wait()
+			So(atomic.LoadInt32(&oriCnt), ShouldEqual, 1)
+			// 等待锁的请求均从缓存中获取到了数据
+			cnt := 0
+			for _, m := range models {
+				if m.A == testModelAValue {
+					cnt++
+				}
+			}
+			So(cnt, ShouldBeGreaterThanOrEqualTo, 9)
+		})
+
+		Convey("GetOrCreate:租约, 只有拿到租约的请求回源, 回源期间缓存被删除时不写入旧数据", func() {
+			leaseOpt := WithLease(dlock.WithPollInterval(time.Millisecond * 10))
+			var oriCnt int32
+			wg := sync.WaitGroup{}
+			for i := 0; i < 10; i++ {
+				instance := NewModelCacheSvcWithBackend(memStore)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = instance.GetOrCreate(ctx, &TestSingleFlightModel{oriCnt: &oriCnt}, leaseOpt)
+				}()
+			}
+			wg.Wait()
+			So(atomic.LoadInt32(&oriCnt), ShouldEqual, 1)
+			lKey := leaseKey(common.NewStringCache(key, 0), key)
+			So(memStore.TTL(lKey), ShouldEqual, -2*time.Second)
+
+			// 回源期间数据变更并删除缓存, 回源的请求持有的租约被撤销
+			So(memSvc.Delete(ctx, common.NewStringCache(key, 0)), ShouldBeNil)
+			m := &TestSingleFlightModel{oriCnt: &oriCnt}
+			done := make(chan error)
+			go func() { done <- memSvc.GetOrCreate(ctx, m, leaseOpt) }()
+			time.Sleep(time.Millisecond * 30)
+			So(memStore.TTL(lKey), ShouldBeGreaterThan, 0)
+			So(memSvc.Delete(ctx, m.CacheInfo()), ShouldBeNil)
+			So(<-done, ShouldBeNil)
+			_, err := memStore.Get(ctx, key)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			// 等待租约超时, 降级为直接回源且不写入缓存
+			_, _ = memStore.SetNX(ctx, lKey, "other", time.Minute)
+			m = &TestSingleFlightModel{oriCnt: &oriCnt}
+			So(memSvc.GetOrCreate(ctx, m, WithLease(dlock.WithWaitTimeout(time.Millisecond*50))), ShouldBeNil)
+			So(m.A, ShouldEqual, testModelAValue)
+			_, err = memStore.Get(ctx, key)
+			So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+
+			// 调用方共用的可选项切片有剩余容量时, 获取租约不会写入该切片的底层数组, 并发调用时不会竞争
+			_ = memStore.Del(ctx, lKey)
+			sharedOpts := append(make([]dlock.OptionWrap, 0, 2), dlock.WithPollInterval(time.Millisecond*10))
+			So(memSvc.GetOrCreate(ctx, &TestSingleFlightModel{oriCnt: &oriCnt}, WithLease(sharedOpts...)), ShouldBeNil)
+			So(sharedOpts[:2][1], ShouldBeNil)
+			_ = memStore.Del(ctx, key)
+
+			// hash类型同样支持
+			_ = memStore.Del(ctx, lKey)
+			hm := &TestHashModel{}
+			So(memSvc.GetOrCreate(ctx, hm, WithLease(), WithNeedCacheNoData()), ShouldEqual, rdscache.ErrNoData)
+			v, _ := memStore.HGet(ctx, key, subKey)
+			So(v, ShouldEqual, common.CacheEmptyValue)
+		})
+
+		Convey("租约:使用命名空间及key空间时, 租约key和加了前缀的缓存key在同一个slot中", func() {
+			recorder := &leaseRecordBackend{IBackend: memStore}
+			ns := namespace.MustNew(memStore, "user", namespace.WithLocalTTL(0))
+			prefixSvc := NewModelCacheSvcWithBackend(recorder,
+				WithSvcKeySpace(common.MustKeySpace("app")), WithSvcNamespace(ns))
+			So(prefixSvc.GetOrCreate(ctx, &TestStringModel{}, WithLease()), ShouldBeNil)
+			_ = memStore.Del(ctx, "app:user:0:"+key)
+			So(prefixSvc.GetOrCreate(ctx, &TestHashModel{}, WithLease(), WithNeedCacheNoData()), ShouldEqual, rdscache.ErrNoData)
+			So(recorder.keys, ShouldResemble, []string{"app:user:0:" + key, "app:user:0:" + key})
+			for i, lKey := range recorder.leaseKeys {
+				So(backend.KeySlot(lKey), ShouldEqual, backend.KeySlot(recorder.keys[i]))
+			}
+			// 加锁及删除时使用相同的租约key
+			So(recorder.lockKeys, ShouldResemble, recorder.leaseKeys)
+		})
+
+		Convey("MGetOrCreate:批量写入时每个key的过期时间单独抖动", func() {
+			jitterSvc := NewModelCacheSvcWithBackend(
+				memStore, WithSvcTTLJitter(common.NewRangeJitter(time.Minute, time.Hour)))
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{&TestMGetStringModel{A: 1, B: 1}, &TestMGetStringModel{A: 2, B: 2}}, nil
+			}
+			So(jitterSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}},
+				mGetOriginFunc), ShouldBeNil)
+			ttl1, ttl2 := memStore.TTL(fmt.Sprintf(keyForMGet, 1)), memStore.TTL(fmt.Sprintf(keyForMGet, 2))
+			So(ttl1, ShouldBeGreaterThan, mGetExpTime+time.Minute-time.Second)
+			So(ttl2, ShouldBeGreaterThan, mGetExpTime+time.Minute-time.Second)
+			So(ttl1, ShouldNotEqual, ttl2)
+		})
+
+		Convey("GetOrCreate:提前刷新, 即将过期时提前回源", func() {
+			expTime = time.Hour
+			m := &TestStringModel{}
+			So(memSvc.GetOrCreate(ctx, m, WithEarlyRefresh(1)), ShouldBeNil)
+			raw, _ := memStore.Get(ctx, key)
+			envelope, err := common.DecodeEnvelope(raw)
+			So(err, ShouldBeNil)
+			So(envelope.ExpireAt.IsZero(), ShouldBeFalse)
+
+			// 缓存的数据已被修改, 距离过期还很久时直接从缓存中获取
+			envelope.Value = `{"a":100}`
+			_ = memStore.Set(ctx, key, envelope.Encode(), time.Hour)
+			So(memSvc.GetOrCreate(ctx, m, WithEarlyRefresh(1)), ShouldBeNil)
+			So(m.A, ShouldEqual, 100)
+
+			// 即将过期时提前回源, 缓存被刷新为回源数据
+			envelope.Delta = time.Second
+			envelope.ExpireAt = time.Now()
+			_ = memStore.Set(ctx, key, envelope.Encode(), time.Hour)
+			So(memSvc.GetOrCreate(ctx, m, WithEarlyRefresh(1)), ShouldBeNil)
+			raw, _ = memStore.Get(ctx, key)
+			envelope, _ = common.DecodeEnvelope(raw)
+			So(envelope.Value, ShouldEqual, `{"a":1}`)
+			expTime = 0 // 还原全局变量
+		})
+
+		Convey("GetOrCreate:软过期, 返回旧数据并在后台刷新", func() {
+			expTime = time.Hour
+			m := &TestStringModel{}
+			stale := true
+			So(memSvc.GetOrCreate(ctx, m, WithStaleWhileRevalidate(time.Minute, &stale)), ShouldBeNil)
+			So(stale, ShouldBeFalse)
+
+			// 模拟缓存的旧数据已超过软过期时间
+			raw, _ := memStore.Get(ctx, key)
+			envelope, err := common.DecodeEnvelope(raw)
+			So(err, ShouldBeNil)
+			envelope.Value = `{"a":100}`
+			envelope.CreatedAt = time.Now().Add(-time.Hour)
+			_ = memStore.Set(ctx, key, envelope.Encode(), time.Hour)
+			m = &TestStringModel{}
+			So(memSvc.GetOrCreate(ctx, m, WithStaleWhileRevalidate(time.Minute, &stale)), ShouldBeNil)
+			So(m.A, ShouldEqual, 100)
+			So(stale, ShouldBeTrue)
+
+			// 后台刷新完成后获取到回源数据
+			time.Sleep(time.Millisecond * 50)
+			m = &TestStringModel{}
+			So(memSvc.GetOrCreate(ctx, m, WithStaleWhileRevalidate(time.Minute, &stale)), ShouldBeNil)
+			So(m.A, ShouldEqual, testModelAValue)
+			So(stale, ShouldBeFalse)
+			expTime = 0 // 还原全局变量
+		})
+
+		Convey("GetOrCreate:软过期后台刷新使用model的拷贝, 不和调用方并发读写model", func() {
+			// 模拟缓存的旧数据已超过软过期时间
+			envelope := common.NewEnvelope(`{"id":1,"a":1}`, false)
+			envelope.CreatedAt = time.Now().Add(-time.Hour)
+			_ = memStore.Set(ctx, key, envelope.Encode(), time.Hour)
+
+			m := &raceModel{ID: 1}
+			stale := false
+			So(memSvc.GetOrCreate(ctx, m, WithStaleWhileRevalidate(time.Minute, &stale)), ShouldBeNil)
+			So(stale, ShouldBeTrue)
+			// 调用方返回后继续修改model, 后台回源读取的是拷贝
+			m.ID, m.A = 2, 2
+
+			time.Sleep(time.Millisecond * 50)
+			raw, _ := memStore.Get(ctx, key)
+			envelope, err := common.DecodeEnvelope(raw)
+			So(err, ShouldBeNil)
+			So(envelope.Value, ShouldEqual, `{"id":1,"a":10}`)
+		})
+
+		Convey("信封格式:缓存了空数据, 兼容历史的原始存储值", func() {
+			envelopeSvc := NewModelCacheSvcWithBackend(memStore, WithSvcEnvelope())
+			m := &TestHashModel{}
+			for i := 0; i < 2; i++ {
+				So(envelopeSvc.GetOrCreate(ctx, m, WithNeedCacheNoData()), ShouldEqual, rdscache.ErrNoData)
+			}
+			v, _ := memStore.HGet(ctx, key, subKey)
+			So(v, ShouldNotEqual, common.CacheEmptyValue)
+			envelope, err := common.DecodeEnvelope(v)
+			So(err, ShouldBeNil)
+			So(envelope.NoData(), ShouldBeTrue)
+
+			_ = memStore.Set(ctx, key, `{"a":100}`, 0)
+			sm := &TestStringModel{}
+			So(envelopeSvc.GetOrCreate(ctx, sm), ShouldBeNil)
+			So(sm.A, ShouldEqual, 100)
+
+			// 批量获取时, 空数据通过UpdateSelf(nil)标示
+			mGetOriginFunc := func(ctx context.Context, noCacheModels []ICanMGetModel) ([]ICanMGetModel, error) {
+				return []ICanMGetModel{&TestMGetStringModel{A: 1, B: 1}, nil}, nil
+			}
+			So(envelopeSvc.MGetOrCreate(ctx, []ICanMGetModel{&TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2}},
+				mGetOriginFunc, WithMGetNeedCacheNoData()), ShouldBeNil)
+			m1, m2 := &TestMGetStringModel{A: 1}, &TestMGetStringModel{A: 2, B: 2}
+			So(envelopeSvc.MGetOrCreate(ctx, []ICanMGetModel{m1, m2}, nil), ShouldBeNil)
+			So(m1.B, ShouldEqual, 1)
+			So(m2.A, ShouldEqual, 0)
+
+			// 历史的原始存储值
+			_ = memStore.Set(ctx, fmt.Sprintf(keyForMGet, 3), `{"a":3,"b":3}`, 0)
+			m3 := &TestMGetStringModel{A: 3}
+			So(envelopeSvc.MGetOrCreate(ctx, []ICanMGetModel{m3}, nil), ShouldBeNil)
+			So(m3.B, ShouldEqual, 3)
+		})
+
+		Convey("信封格式:SetValue缓存空字符串的真实数据, SetNoData缓存数据不存在, Set兼容历史用法", func() {
+			envelopeSvc := NewModelCacheSvcWithBackend(memStore, WithSvcEnvelope())
+			cacheInfo := (&TestStringModel{}).CacheInfo()
+			decode := func() *common.Envelope {
+				raw, _ := memStore.Get(ctx, key)
+				envelope, err := common.DecodeEnvelope(raw)
+				So(err, ShouldBeNil)
+				return envelope
+			}
+			So(envelopeSvc.SetValue(ctx, cacheInfo, common.CacheEmptyValue, nil), ShouldBeNil)
+			envelope := decode()
+			So(envelope.NoData(), ShouldBeFalse)
+			So(envelope.Value, ShouldEqual, "")
+
+			So(envelopeSvc.SetNoData(ctx, cacheInfo, nil), ShouldBeNil)
+			So(decode().NoData(), ShouldBeTrue)
+
+			So(envelopeSvc.Set(ctx, cacheInfo, `{"a":1}`, nil), ShouldBeNil)
+			So(decode().NoData(), ShouldBeFalse)
+			So(envelopeSvc.Set(ctx, cacheInfo, common.CacheEmptyValue, nil), ShouldBeNil)
+			So(decode().NoData(), ShouldBeTrue)
+
+			// 未开启信封格式时写入原始值
+			So(memSvc.SetNoData(ctx, cacheInfo, nil), ShouldBeNil)
+			v, _ := memStore.Get(ctx, key)
+			So(v, ShouldEqual, common.CacheEmptyValue)
+		})
+	})
+}
+
+// leaseRecordBackend 记录获取租约及租约写入时实际访问存储后端的key
+type leaseRecordBackend struct {
+	backend.IBackend
+	lockKeys  []string
+	leaseKeys []string
+	keys      []string
+}
+
+func (b *leaseRecordBackend) SetNX(ctx context.Context, key, value string, expTime time.Duration) (bool, error) {
+	b.lockKeys = append(b.lockKeys, key)
+	return b.IBackend.SetNX(ctx, key, value, expTime)
+}
+
+func (b *leaseRecordBackend) LeaseSet(
+	ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (bool, error) {
+	b.leaseKeys, b.keys = append(b.leaseKeys, leaseKey), append(b.keys, key)
+	return b.IBackend.LeaseSet(ctx, leaseKey, token, key, value, expTime)
+}
+
+func (b *leaseRecordBackend) LeaseHSet(
+	ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (bool, error) {
+	b.leaseKeys, b.keys = append(b.leaseKeys, leaseKey), append(b.keys, key)
+	return b.IBackend.LeaseHSet(ctx, leaseKey, token, key, field, value, expTime)
+}
+
+// recordSpan 记录名称、父span及属性的span
+type recordSpan struct {
+	trace.Span
+	name   string
+	parent trace.Span
+	attrs  map[attribute.Key]interface{}
+}
+
+func (s *recordSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value.AsInterface()
+	}
+}
+
+// spanRecorder 记录创建的所有span的TracerProvider
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordSpan
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer { return r }
+
+func (r *spanRecorder) Start(
+	ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordSpan{Span: trace.SpanFromContext(context.Background()), name: name,
+		parent: trace.SpanFromContext(ctx), attrs: map[attribute.Key]interface{}{}}
+	span.SetAttributes(trace.NewSpanStartConfig(opts...).Attributes()...)
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// last 最后创建的名称为name的span
+func (r *spanRecorder) last(name string) *recordSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.spans) - 1; i >= 0; i-- {
+		if r.spans[i].name == name {
+			return r.spans[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/observe"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	resultOK     = "ok"
+	resultNoData = "no_data"
+	resultError  = "error"
+)
+
+// Collector 缓存指标, 实现了observe.IObserver, 通过服务的WithSvcObserver使用, 各服务的指标名称及标签保持一致
+// 所有指标均带有namespace标签(缓存的命名空间名称, 未使用命名空间时为空), 可按命名空间及缓存层级统计命中率
+type Collector struct {
+	requests          *prometheus.CounterVec   // 读取缓存的次数, 按缓存层级及结果(hit/miss/no_data_hit/error)
+	redisDuration     *prometheus.HistogramVec // 读取redis的耗时, 按操作(get/mget)
+	batchSize         *prometheus.HistogramVec // 批量获取的数量
+	loadDuration      *prometheus.HistogramVec // 回源耗时, 按结果(ok/no_data/error)
+	sets              *prometheus.CounterVec   // 回源后写入缓存的次数, 按结果(ok/error)
+	unmarshalFailures *prometheus.CounterVec   // 反序列化失败的次数
+	lockWait          *prometheus.HistogramVec // 等待锁的耗时, 按结果(ok/error), 可用于观察锁竞争
+}
+
+// NewCollector 创建缓存指标并注册到reg, reg为nil时注册到prometheus.DefaultRegisterer
+// 同一个reg中注册多个时需通过WithConstLabels区分, 否则返回重复注册的错误
+func NewCollector(reg prometheus.Registerer, opts ...OptionWrap) (*Collector, error) {
+	option := NewOption(opts...)
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	c := &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "requests_total",
+			Help: "Cache lookups by tier and result.", ConstLabels: option.constLabels,
+		}, []string{"namespace", "tier", "result"}),
+		redisDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "redis_duration_seconds",
+			Help: "Latency of cache reads from redis.", ConstLabels: option.constLabels, Buckets: option.buckets,
+		}, []string{"namespace", "op"}),
+		batchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "batch_size",
+			Help: "Number of keys per batch get.", ConstLabels: option.constLabels, Buckets: option.sizeBuckets,
+		}, []string{"namespace"}),
+		loadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "load_duration_seconds",
+			Help: "Latency of origin loads by result.", ConstLabels: option.constLabels, Buckets: option.buckets,
+		}, []string{"namespace", "result"}),
+		sets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "sets_total",
+			Help: "Cache writes after origin loads by result.", ConstLabels: option.constLabels,
+		}, []string{"namespace", "result"}),
+		unmarshalFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "unmarshal_failures_total",
+			Help: "Cached values that failed to unmarshal.", ConstLabels: option.constLabels,
+		}, []string{"namespace"}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: option.metricNamespace, Subsystem: "cache", Name: "lock_wait_seconds",
+			Help: "Time spent waiting for locks on cache misses by result.", ConstLabels: option.constLabels,
+			Buckets: option.buckets,
+		}, []string{"namespace", "result"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		c.requests, c.redisDuration, c.batchSize, c.loadDuration, c.sets, c.unmarshalFailures, c.lockWait} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Observe 按事件更新指标
+func (c *Collector) Observe(e observe.Event) {
+	ns := e.Namespace
+	switch e.Type {
+	case observe.EventHit, observe.EventMiss, observe.EventNoDataHit:
+		result := e.Type.String()
+		if e.Err != nil {
+			result = resultError
+		}
+		c.requests.WithLabelValues(ns, e.Tier.String(), result).Inc()
+		if e.Tier == observe.TierRds && e.Duration > 0 {
+			c.redisDuration.WithLabelValues(ns, "get").Observe(e.Duration.Seconds())
+		}
+	case observe.EventBatchGet:
+		c.batchSize.WithLabelValues(ns).Observe(float64(e.Size))
+		c.redisDuration.WithLabelValues(ns, "mget").Observe(e.Duration.Seconds())
+	case observe.EventLoad:
+		result := resultOK
+		if e.Err == rdscache.ErrNoData {
+			result = resultNoData
+		} else if e.Err != nil {
+			result = resultError
+		}
+		c.loadDuration.WithLabelValues(ns, result).Observe(e.Duration.Seconds())
+	case observe.EventSet:
+		c.sets.WithLabelValues(ns, errResult(e.Err)).Inc()
+	case observe.EventUnmarshalFail:
+		c.unmarshalFailures.WithLabelValues(ns).Inc()
+	case observe.EventLockWait:
+		c.lockWait.WithLabelValues(ns, errResult(e.Err)).Observe(e.Duration.Seconds())
+	}
+}
+
+func errResult(err error) string {
+	if err != nil {
+		return resultError
+	}
+	return resultOK
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/observe"
+	. "github.com/glycerine/goconvey/convey"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	Convey("缓存指标", t, func() {
+		reg := prometheus.NewRegistry()
+		c, err := NewCollector(reg)
+		So(err, ShouldBeNil)
+
+		Convey("按命名空间、缓存层级及结果统计读取次数, 记录redis耗时", func() {
+			c.Observe(observe.Event{Type: observe.EventHit, Tier: observe.TierLocal, Namespace: "user"})
+			c.Observe(observe.Event{Type: observe.EventHit, Tier: observe.TierRds, Namespace: "user", Duration: time.Millisecond})
+			c.Observe(observe.Event{Type: observe.EventMiss, Tier: observe.TierRds, Namespace: "user", Duration: time.Millisecond})
+			c.Observe(observe.Event{Type: observe.EventMiss, Tier: observe.TierRds, Namespace: "user",
+				Duration: time.Millisecond, Err: errors.New("timeout")})
+
+			So(testutil.ToFloat64(c.requests.WithLabelValues("user", "local", "hit")), ShouldEqual, 1)
+			So(testutil.ToFloat64(c.requests.WithLabelValues("user", "redis", "hit")), ShouldEqual, 1)
+			So(testutil.ToFloat64(c.requests.WithLabelValues("user", "redis", "miss")), ShouldEqual, 1)
+			So(testutil.ToFloat64(c.requests.WithLabelValues("user", "redis", "error")), ShouldEqual, 1)
+			So(testutil.CollectAndCount(c.redisDuration), ShouldEqual, 1)
+		})
+
+		Convey("回源、写入、反序列化失败、等待锁及批量获取", func() {
+			c.Observe(observe.Event{Type: observe.EventLoad, Duration: time.Millisecond})
+			c.Observe(observe.Event{Type: observe.EventLoad, Duration: time.Millisecond, Err: rdscache.ErrNoData})
+			c.Observe(observe.Event{Type: observe.EventSet, Err: errors.New("set fail")})
+			c.Observe(observe.Event{Type: observe.EventUnmarshalFail})
+			c.Observe(observe.Event{Type: observe.EventLockWait, Err: rdscache.ErrLockWaitTimeout})
+			c.Observe(observe.Event{Type: observe.EventBatchGet, Size: 10, Duration: time.Millisecond})
+
+			So(testutil.CollectAndCount(c.loadDuration), ShouldEqual, 2)
+			So(testutil.ToFloat64(c.sets.WithLabelValues("", "error")), ShouldEqual, 1)
+			So(testutil.ToFloat64(c.unmarshalFailures.WithLabelValues("")), ShouldEqual, 1)
+			So(testutil.CollectAndCount(c.lockWait), ShouldEqual, 1)
+			So(testutil.CollectAndCount(c.batchSize), ShouldEqual, 1)
+			So(testutil.CollectAndCount(c.redisDuration), ShouldEqual, 1)
+		})
+
+		Convey("同一个registry中重复注册时需通过共有的标签区分", func() {
+			_, err = NewCollector(reg)
+			So(err, ShouldNotBeNil)
+			_, err = NewCollector(reg, WithConstLabels(prometheus.Labels{"service": "order"}))
+			So(err, ShouldBeNil)
+		})
+	})
+}
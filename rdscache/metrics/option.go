@@ -0,0 +1,59 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const defaultMetricNamespace = "sponge"
+
+// Option 指标可选项
+type Option struct {
+	metricNamespace string            // 指标名称的前缀, 和缓存的命名空间无关
+	constLabels     prometheus.Labels // 所有指标共有的标签, 例如服务名
+	buckets         []float64         // 耗时直方图的分桶, 单位秒
+	sizeBuckets     []float64         // 批量获取数量直方图的分桶
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{
+		metricNamespace: defaultMetricNamespace,
+		buckets:         prometheus.DefBuckets,
+		sizeBuckets:     prometheus.ExponentialBuckets(1, 2, 10),
+	}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithMetricNamespace 指定指标名称的前缀, 默认为sponge
+func WithMetricNamespace(ns string) OptionWrap {
+	return func(o *Option) {
+		o.metricNamespace = ns
+	}
+}
+
+// WithConstLabels 指定所有指标共有的标签, 同一进程中的多个服务可通过不同的标签值区分
+func WithConstLabels(labels prometheus.Labels) OptionWrap {
+	return func(o *Option) {
+		o.constLabels = labels
+	}
+}
+
+// WithBuckets 指定耗时直方图的分桶(单位秒), 默认为prometheus.DefBuckets
+func WithBuckets(buckets []float64) OptionWrap {
+	return func(o *Option) {
+		if len(buckets) > 0 {
+			o.buckets = buckets
+		}
+	}
+}
+
+// WithSizeBuckets 指定批量获取数量直方图的分桶, 默认为1到512的指数分桶
+func WithSizeBuckets(buckets []float64) OptionWrap {
+	return func(o *Option) {
+		if len(buckets) > 0 {
+			o.sizeBuckets = buckets
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package namespace
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+)
+
+// Namespace 带代数的命名空间, 命名空间中缓存的实际key为: 名称:代数:key
+// 递增代数后命名空间中的缓存全部失效(使用新的key), 旧的key在过期后自动删除, 无需SCAN/DEL
+// 适用于数据结构变更等需要丢弃某一类缓存的场景, 实现了backend.IKeyPrefix, 可通过服务的WithSvcNamespace使用
+type Namespace struct {
+	store  backend.IBackend // 存储代数的存储后端, 不可使用加了该命名空间前缀的存储后端
+	name   string
+	key    string // 代数在存储后端中的key
+	option *Option
+
+	mu       sync.Mutex
+	gen      int64
+	expireAt time.Time // 本地缓存的代数的过期时间
+}
+
+// New 创建命名空间, 名称中不可包含{}, 防止集群模式下改变缓存key的hash tag, 包含时返回ErrNamespaceInvalid
+func New(store backend.IBackend, name string, opts ...OptionWrap) (*Namespace, error) {
+	if strings.ContainsAny(name, "{}") {
+		return nil, rdscache.ErrNamespaceInvalid
+	}
+	option := NewOption(opts...)
+	return &Namespace{store: store, name: name, key: option.keyPrefix + name, option: option}, nil
+}
+
+// MustNew 同New, 名称中包含{}时panic, 可用于包级别变量声明
+func MustNew(store backend.IBackend, name string, opts ...OptionWrap) *Namespace {
+	n, err := New(store, name, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Name 命名空间名称
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// Generation 获取当前代数, 优先使用本地缓存的代数, 从未递增过时为0
+func (n *Namespace) Generation(ctx context.Context) (int64, error) {
+	n.mu.Lock()
+	if time.Now().Before(n.expireAt) {
+		gen := n.gen
+		n.mu.Unlock()
+		return gen, nil
+	}
+	n.mu.Unlock()
+
+	var gen int64
+	v, err := n.store.Get(ctx, n.key)
+	switch {
+	case err == rdscache.ErrCacheNotExist:
+	case err != nil:
+		return 0, err
+	default:
+		if gen, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n.setGeneration(gen)
+	return gen, nil
+}
+
+// Bump 递增代数, 命名空间中的缓存全部失效, 返回新的代数
+// 当前实例立即使用新的代数, 其它实例在本地缓存的代数过期后使用
+func (n *Namespace) Bump(ctx context.Context) (int64, error) {
+	gen, err := n.store.Incr(ctx, n.key)
+	if err != nil {
+		return 0, err
+	}
+	n.setGeneration(gen)
+	return gen, nil
+}
+
+// Prefix 命名空间中缓存的key前缀: 名称:代数:
+func (n *Namespace) Prefix(ctx context.Context) (string, error) {
+	gen, err := n.Generation(ctx)
+	if err != nil {
+		return "", err
+	}
+	return n.name + ":" + strconv.FormatInt(gen, 10) + ":", nil
+}
+
+// setGeneration 更新本地缓存的代数, 并发获取时不会使用比已缓存的更旧的代数
+func (n *Namespace) setGeneration(gen int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if gen < n.gen {
+		gen = n.gen
+	}
+	n.gen = gen
+	n.expireAt = time.Now().Add(n.option.localTTL)
+}
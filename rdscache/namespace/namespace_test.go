@@ -0,0 +1,70 @@
+package namespace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+	. "github.com/glycerine/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestNamespace(t *testing.T) {
+	Convey("带代数的命名空间", t, func() {
+		store := backend.NewMemoryBackend()
+
+		Convey("从未递增过时代数为0, 递增后使用新的前缀", func() {
+			ns := MustNew(store, "user")
+			prefix, err := ns.Prefix(ctx)
+			So(err, ShouldBeNil)
+			So(prefix, ShouldEqual, "user:0:")
+
+			gen, err := ns.Bump(ctx)
+			So(err, ShouldBeNil)
+			So(gen, ShouldEqual, 1)
+			prefix, _ = ns.Prefix(ctx)
+			So(prefix, ShouldEqual, "user:1:")
+			v, _ := store.Get(ctx, defaultKeyPrefix+"user")
+			So(v, ShouldEqual, "1")
+		})
+
+		Convey("其它实例在本地缓存的代数过期后使用新的代数", func() {
+			ns1 := MustNew(store, "user", WithLocalTTL(time.Millisecond*100))
+			ns2 := MustNew(store, "user", WithLocalTTL(time.Millisecond*100))
+			gen, _ := ns2.Generation(ctx)
+			So(gen, ShouldEqual, 0)
+
+			_, _ = ns1.Bump(ctx)
+			gen, _ = ns2.Generation(ctx)
+			So(gen, ShouldEqual, 0)
+			time.Sleep(time.Millisecond * 150)
+			gen, _ = ns2.Generation(ctx)
+			So(gen, ShouldEqual, 1)
+		})
+
+		Convey("名称中不可包含{}", func() {
+			for _, name := range []string{"{user}", "user{", "}"} {
+				_, err := New(store, name)
+				So(err, ShouldEqual, rdscache.ErrNamespaceInvalid)
+			}
+			So(func() { MustNew(store, "{user}") }, ShouldPanic)
+		})
+
+		Convey("包装存储后端, 递增代数后原有的缓存不可见", func() {
+			ns := MustNew(store, "user", WithKeyPrefix("gen:"), WithLocalTTL(0))
+			nsStore := backend.NewPrefixBackend(store, ns)
+			So(nsStore.Set(ctx, "k", "v", time.Minute), ShouldBeNil)
+			v, _ := nsStore.Get(ctx, "k")
+			So(v, ShouldEqual, "v")
+
+			_, _ = ns.Bump(ctx)
+			_, err := nsStore.Get(ctx, "k")
+			So(err, ShouldNotBeNil)
+			// 旧的key在过期后自动删除
+			So(store.TTL("user:0:k"), ShouldBeGreaterThan, 0)
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package namespace
+
+import "time"
+
+const (
+	defaultKeyPrefix = "sponge:ns:"
+	defaultLocalTTL  = time.Second
+)
+
+// Option 命名空间可选项
+type Option struct {
+	keyPrefix string // 代数在存储后端中的key前缀, 代数的key为前缀+命名空间名称
+	// localTTL 代数在本地缓存的时间, 其它实例递增代数后, 当前实例最多localTTL后使用新的代数, <=0代表不缓存
+	localTTL time.Duration
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{keyPrefix: defaultKeyPrefix, localTTL: defaultLocalTTL}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithKeyPrefix 指定代数在存储后端中的key前缀, 默认为sponge:ns:
+func WithKeyPrefix(prefix string) OptionWrap {
+	return func(o *Option) {
+		o.keyPrefix = prefix
+	}
+}
+
+// WithLocalTTL 指定代数在本地缓存的时间, 默认1s, 越短多实例之间越快使用新的代数, 访问存储后端的次数也越多
+func WithLocalTTL(ttl time.Duration) OptionWrap {
+	return func(o *Option) {
+		o.localTTL = ttl
+	}
+}
@@ -0,0 +1,68 @@
+package observe
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncObserver 异步观察者, 事件放入有界队列后由固定数量的协程交给inner处理, 不阻塞处理请求的协程
+// 队列已满或已关闭时丢弃事件并计数, 替代每次回调都创建协程的方式, 防止观察者处理慢时协程数无限增长
+type AsyncObserver struct {
+	inner  IObserver
+	events chan Event
+	wg     sync.WaitGroup
+
+	mu      sync.RWMutex // 保护closed, 防止向已关闭的队列发送事件
+	closed  bool
+	dropped uint64
+}
+
+// NewAsyncObserver 创建异步观察者, 不再使用时需调用Close
+func NewAsyncObserver(inner IObserver, opts ...OptionWrap) *AsyncObserver {
+	option := NewOption(opts...)
+	o := &AsyncObserver{inner: inner, events: make(chan Event, option.bufferSize)}
+	o.wg.Add(option.workers)
+	for i := 0; i < option.workers; i++ {
+		go o.run()
+	}
+	return o
+}
+
+func (o *AsyncObserver) Observe(e Event) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		atomic.AddUint64(&o.dropped, 1)
+		return
+	}
+	select {
+	case o.events <- e:
+	default:
+		atomic.AddUint64(&o.dropped, 1)
+	}
+}
+
+// Dropped 因队列已满或已关闭丢弃的事件数
+func (o *AsyncObserver) Dropped() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
+
+// Close 不再接收新的事件, 等待队列中的事件处理完成
+func (o *AsyncObserver) Close() {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return
+	}
+	o.closed = true
+	close(o.events)
+	o.mu.Unlock()
+	o.wg.Wait()
+}
+
+func (o *AsyncObserver) run() {
+	defer o.wg.Done()
+	for e := range o.events {
+		o.inner.Observe(e)
+	}
+}
@@ -0,0 +1,70 @@
+package observe
+
+import "time"
+
+// EventType 事件类型
+type EventType uint8
+
+const (
+	EventHit           EventType = iota + 1 // 命中缓存, Tier为命中的层级
+	EventMiss                               // 未命中缓存, Tier为未命中的层级, 访问redis异常时Err不为nil
+	EventNoDataHit                          // 命中了缓存的数据不存在(预防缓存穿透), Tier为命中的层级
+	EventLoad                               // 回源, Duration为回源耗时, Err为回源的错误, 数据不存在时为ErrNoData
+	EventSet                                // 回源后写入缓存, Err为写入的错误
+	EventUnmarshalFail                      // 缓存内容反序列化失败, Err为反序列化的错误
+	EventLockWait                           // 预防缓存击穿时等待锁(本地锁或分布式锁), Duration为等待耗时, Err为等待失败的原因
+	EventBatchGet                           // 批量从redis中获取, Size为批量获取的数量, Duration为访问redis的耗时
+)
+
+var eventTypeNames = map[EventType]string{
+	EventHit:           "hit",
+	EventMiss:          "miss",
+	EventNoDataHit:     "no_data_hit",
+	EventLoad:          "load",
+	EventSet:           "set",
+	EventUnmarshalFail: "unmarshal_fail",
+	EventLockWait:      "lock_wait",
+	EventBatchGet:      "batch_get",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Tier 缓存层级
+type Tier uint8
+
+const (
+	TierLocal Tier = iota + 1 // 本地缓存(热key)
+	TierRds                   // redis(缓存存储后端)
+)
+
+func (t Tier) String() string {
+	switch t {
+	case TierLocal:
+		return "local"
+	case TierRds:
+		return "redis"
+	default:
+		return ""
+	}
+}
+
+// Event 缓存事件
+type Event struct {
+	Type      EventType
+	Tier      Tier   // 缓存层级, 只有命中及未命中的事件有
+	Namespace string // 服务使用的命名空间名称, 未使用命名空间时为空
+	Key       string // 缓存的key, 使用分片方案处理热key时为分片的key; 批量获取、回源及写入时为空, 见Keys
+	SubKey    string // hash类型的subKey
+	// Keys 批量获取、回源及写入时涉及的缓存key, 和SubKeys一一对应; string类型时SubKeys为空
+	Keys    []string
+	SubKeys []string
+	// Duration 耗时, 读取redis时为访问redis的耗时, 读取本地缓存及批量获取时为0
+	Duration time.Duration
+	Size     int // 批量获取、回源及写入的数量
+	Err      error
+}
@@ -0,0 +1,14 @@
+package observe
+
+// IObserver 缓存事件观察者, 可用于监控、热key统计等
+// 服务在处理请求的协程中同步调用Observe, 耗时的处理需使用AsyncObserver异步执行; Observe不可panic
+type IObserver interface {
+	Observe(e Event)
+}
+
+// ObserverFunc 函数形式的观察者
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
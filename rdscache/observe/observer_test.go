@@ -0,0 +1,43 @@
+package observe
+
+import (
+	"sync/atomic"
+	"testing"
+
+	. "github.com/glycerine/goconvey/convey"
+)
+
+func TestAsyncObserver(t *testing.T) {
+	Convey("异步观察者", t, func() {
+
+		Convey("队列已满或已关闭时丢弃事件, 关闭时等待队列中的事件处理完成", func() {
+			var handled int32
+			started, release := make(chan struct{}), make(chan struct{})
+			o := NewAsyncObserver(ObserverFunc(func(e Event) {
+				if atomic.AddInt32(&handled, 1) == 1 {
+					close(started)
+					<-release
+				}
+			}), WithBufferSize(1))
+
+			o.Observe(Event{Type: EventHit})
+			<-started
+			o.Observe(Event{Type: EventMiss}) // 放入队列
+			o.Observe(Event{Type: EventLoad}) // 队列已满
+			So(o.Dropped(), ShouldEqual, 1)
+
+			close(release)
+			o.Close()
+			So(atomic.LoadInt32(&handled), ShouldEqual, 2)
+			o.Observe(Event{Type: EventHit})
+			So(o.Dropped(), ShouldEqual, 2)
+			o.Close()
+		})
+
+		Convey("事件类型及缓存层级名称", func() {
+			So(EventNoDataHit.String(), ShouldEqual, "no_data_hit")
+			So(EventType(0).String(), ShouldEqual, "unknown")
+			So(TierRds.String(), ShouldEqual, "redis")
+		})
+	})
+}
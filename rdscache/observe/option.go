@@ -0,0 +1,40 @@
+package observe
+
+const (
+	defaultBufferSize = 1024
+	defaultWorkers    = 1
+)
+
+// Option 异步观察者可选项
+type Option struct {
+	bufferSize int // 未处理的事件数上限, 达到上限后丢弃新的事件
+	workers    int // 处理事件的协程数, 大于1时事件的处理顺序不确定
+}
+
+func NewOption(opts ...OptionWrap) *Option {
+	o := &Option{bufferSize: defaultBufferSize, workers: defaultWorkers}
+	for _, op := range opts {
+		op(o)
+	}
+	return o
+}
+
+type OptionWrap func(o *Option)
+
+// WithBufferSize 指定未处理的事件数上限, 默认1024
+func WithBufferSize(size int) OptionWrap {
+	return func(o *Option) {
+		if size > 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithWorkers 指定处理事件的协程数, 默认1
+func WithWorkers(workers int) OptionWrap {
+	return func(o *Option) {
+		if workers > 0 {
+			o.workers = workers
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/693490554/sponge/rdscache/backend"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingBackend 为每次访问存储后端(redis往返)创建span的存储后端
+type tracingBackend struct {
+	inner  backend.IBackend
+	tracer *Tracer
+}
+
+// NewBackend 包装存储后端, 每次访问inner时创建span, 管道在Exec时创建span; tracer为nil时直接返回inner
+func NewBackend(inner backend.IBackend, tracer *Tracer) backend.IBackend {
+	if tracer == nil {
+		return inner
+	}
+	return &tracingBackend{inner: inner, tracer: tracer}
+}
+
+// start 创建访问存储后端的span, 记录操作、第一个key及key的数量
+func (b *tracingBackend) start(ctx context.Context, op string, keys ...string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{AttrOperation.String(op)}
+	if len(keys) > 0 {
+		attrs = append(attrs, AttrKey.String(keys[0]))
+	}
+	if len(keys) > 1 {
+		attrs = append(attrs, AttrBatchSize.Int(len(keys)))
+	}
+	return b.tracer.start(ctx, "sponge.backend."+op, trace.SpanKindClient, attrs...)
+}
+
+func (b *tracingBackend) Get(ctx context.Context, key string) (v string, err error) {
+	ctx, span := b.start(ctx, "Get", key)
+	defer func() { End(span, err) }()
+	return b.inner.Get(ctx, key)
+}
+
+func (b *tracingBackend) Set(ctx context.Context, key, value string, expTime time.Duration) (err error) {
+	ctx, span := b.start(ctx, "Set", key)
+	defer func() { End(span, err) }()
+	return b.inner.Set(ctx, key, value, expTime)
+}
+
+func (b *tracingBackend) HGet(ctx context.Context, key, field string) (v string, err error) {
+	ctx, span := b.start(ctx, "HGet", key)
+	defer func() { End(span, err) }()
+	return b.inner.HGet(ctx, key, field)
+}
+
+func (b *tracingBackend) HSet(ctx context.Context, key, field, value string) (err error) {
+	ctx, span := b.start(ctx, "HSet", key)
+	defer func() { End(span, err) }()
+	return b.inner.HSet(ctx, key, field, value)
+}
+
+func (b *tracingBackend) MGet(ctx context.Context, keys ...string) (v []interface{}, err error) {
+	ctx, span := b.start(ctx, "MGet", keys...)
+	defer func() { End(span, err) }()
+	return b.inner.MGet(ctx, keys...)
+}
+
+func (b *tracingBackend) HMGet(ctx context.Context, key string, fields ...string) (v []interface{}, err error) {
+	ctx, span := b.start(ctx, "HMGet", key)
+	span.SetAttributes(AttrBatchSize.Int(len(fields)))
+	defer func() { End(span, err) }()
+	return b.inner.HMGet(ctx, key, fields...)
+}
+
+func (b *tracingBackend) Expire(ctx context.Context, key string, expTime time.Duration) (err error) {
+	ctx, span := b.start(ctx, "Expire", key)
+	defer func() { End(span, err) }()
+	return b.inner.Expire(ctx, key, expTime)
+}
+
+func (b *tracingBackend) Del(ctx context.Context, keys ...string) (err error) {
+	ctx, span := b.start(ctx, "Del", keys...)
+	defer func() { End(span, err) }()
+	return b.inner.Del(ctx, keys...)
+}
+
+func (b *tracingBackend) HDel(ctx context.Context, key string, fields ...string) (err error) {
+	ctx, span := b.start(ctx, "HDel", key)
+	defer func() { End(span, err) }()
+	return b.inner.HDel(ctx, key, fields...)
+}
+
+func (b *tracingBackend) Incr(ctx context.Context, key string) (v int64, err error) {
+	ctx, span := b.start(ctx, "Incr", key)
+	defer func() { End(span, err) }()
+	return b.inner.Incr(ctx, key)
+}
+
+func (b *tracingBackend) SAddWithExpire(
+	ctx context.Context, key string, expTime time.Duration, members ...string) (err error) {
+	ctx, span := b.start(ctx, "SAddWithExpire", key)
+	defer func() { End(span, err) }()
+	return b.inner.SAddWithExpire(ctx, key, expTime, members...)
+}
+
+func (b *tracingBackend) SMembers(ctx context.Context, key string) (v []string, err error) {
+	ctx, span := b.start(ctx, "SMembers", key)
+	defer func() { End(span, err) }()
+	return b.inner.SMembers(ctx, key)
+}
+
+func (b *tracingBackend) SScan(
+	ctx context.Context, key string, cursor uint64, count int64) (v []string, next uint64, err error) {
+	ctx, span := b.start(ctx, "SScan", key)
+	defer func() { End(span, err) }()
+	return b.inner.SScan(ctx, key, cursor, count)
+}
+
+func (b *tracingBackend) SRem(ctx context.Context, key string, members ...string) (err error) {
+	ctx, span := b.start(ctx, "SRem", key)
+	defer func() { End(span, err) }()
+	return b.inner.SRem(ctx, key, members...)
+}
+
+func (b *tracingBackend) SetNX(ctx context.Context, key, value string, expTime time.Duration) (ok bool, err error) {
+	ctx, span := b.start(ctx, "SetNX", key)
+	defer func() { End(span, err) }()
+	return b.inner.SetNX(ctx, key, value, expTime)
+}
+
+func (b *tracingBackend) CompareAndDel(ctx context.Context, key, value string) (ok bool, err error) {
+	ctx, span := b.start(ctx, "CompareAndDel", key)
+	defer func() { End(span, err) }()
+	return b.inner.CompareAndDel(ctx, key, value)
+}
+
+func (b *tracingBackend) CompareAndExpire(
+	ctx context.Context, key, value string, expTime time.Duration) (ok bool, err error) {
+	ctx, span := b.start(ctx, "CompareAndExpire", key)
+	defer func() { End(span, err) }()
+	return b.inner.CompareAndExpire(ctx, key, value, expTime)
+}
+
+func (b *tracingBackend) LeaseSet(
+	ctx context.Context, leaseKey, token, key, value string, expTime time.Duration) (ok bool, err error) {
+	ctx, span := b.start(ctx, "LeaseSet", key)
+	defer func() { End(span, err) }()
+	return b.inner.LeaseSet(ctx, leaseKey, token, key, value, expTime)
+}
+
+func (b *tracingBackend) LeaseHSet(
+	ctx context.Context, leaseKey, token, key, field, value string, expTime time.Duration) (ok bool, err error) {
+	ctx, span := b.start(ctx, "LeaseHSet", key)
+	defer func() { End(span, err) }()
+	return b.inner.LeaseHSet(ctx, leaseKey, token, key, field, value, expTime)
+}
+
+func (b *tracingBackend) Pipeline(ctx context.Context) backend.IPipeline {
+	return &tracingPipeline{IPipeline: b.inner.Pipeline(ctx), ctx: ctx, backend: b}
+}
+
+// tracingPipeline 记录管道中的命令数, Exec时创建span
+type tracingPipeline struct {
+	backend.IPipeline
+	ctx     context.Context
+	backend *tracingBackend
+	cmds    int
+}
+
+func (p *tracingPipeline) Set(key, value string, expTime time.Duration) {
+	p.cmds++
+	p.IPipeline.Set(key, value, expTime)
+}
+
+func (p *tracingPipeline) HSet(key, field, value string) {
+	p.cmds++
+	p.IPipeline.HSet(key, field, value)
+}
+
+func (p *tracingPipeline) HMSet(key string, fields map[string]interface{}) {
+	p.cmds++
+	p.IPipeline.HMSet(key, fields)
+}
+
+func (p *tracingPipeline) Expire(key string, expTime time.Duration) {
+	p.cmds++
+	p.IPipeline.Expire(key, expTime)
+}
+
+func (p *tracingPipeline) Del(keys ...string) {
+	p.cmds++
+	p.IPipeline.Del(keys...)
+}
+
+func (p *tracingPipeline) HDel(key string, fields ...string) {
+	p.cmds++
+	p.IPipeline.HDel(key, fields...)
+}
+
+func (p *tracingPipeline) SAddWithExpire(key string, expTime time.Duration, members ...string) {
+	p.cmds++
+	p.IPipeline.SAddWithExpire(key, expTime, members...)
+}
+
+func (p *tracingPipeline) Exec() (err error) {
+	_, span := p.backend.start(p.ctx, "Pipeline")
+	span.SetAttributes(AttrBatchSize.Int(p.cmds))
+	defer func() { End(span, err) }()
+	return p.IPipeline.Exec()
+}
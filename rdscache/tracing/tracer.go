@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/common"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/693490554/sponge/rdscache"
+
+// span的属性
+const (
+	AttrKey       = attribute.Key("cache.key")
+	AttrSubKey    = attribute.Key("cache.sub_key")
+	AttrType      = attribute.Key("cache.type")       // 缓存类型: string/hash
+	AttrHitTier   = attribute.Key("cache.hit_tier")   // 命中的缓存层级: local/redis/origin(回源)
+	AttrBatchSize = attribute.Key("cache.batch_size") // 批量获取的数量或管道中的命令数
+	AttrMissCount = attribute.Key("cache.miss_count") // 批量获取时未命中的数量
+	AttrOperation = attribute.Key("db.operation")     // 存储后端的操作
+)
+
+// 命中的缓存层级
+const (
+	TierLocal  = "local"
+	TierRds    = "redis"
+	TierOrigin = "origin"
+)
+
+// noopSpan 未开启链路追踪时返回的span, 不记录任何数据
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// Tracer 缓存操作的链路追踪, 以调用方ctx中的span为父span创建span; 为nil代表未开启, 所有方法均可在nil上调用
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer 使用tp创建链路追踪, tp为nil时使用otel全局的TracerProvider
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Start 创建span, 未开启时返回ctx及不记录的span
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.start(ctx, name, trace.SpanKindInternal, attrs...)
+}
+
+// StartCache 创建span并记录缓存信息的属性, 未开启时返回ctx及不记录的span
+func (t *Tracer) StartCache(ctx context.Context, name string, cacheInfo common.ICacheInfo) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, noopSpan
+	}
+	return t.start(ctx, name, trace.SpanKindInternal, CacheAttributes(cacheInfo)...)
+}
+
+func (t *Tracer) start(
+	ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, noopSpan
+	}
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// SetAttributes 在ctx中的span上记录属性, 未开启时不记录, 防止修改调用方的span
+func (t *Tracer) SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	if t == nil {
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// End 记录错误并结束span, 数据不存在(ErrNoData)及缓存不存在(ErrCacheNotExist)不视为错误
+func End(span trace.Span, err error) {
+	if err != nil && err != rdscache.ErrNoData && err != rdscache.ErrCacheNotExist {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// CacheAttributes 缓存信息对应的属性, 包括key及缓存类型, hash类型包含subKey
+func CacheAttributes(cacheInfo common.ICacheInfo) []attribute.KeyValue {
+	switch c := cacheInfo.(type) {
+	case *common.StringCache:
+		return []attribute.KeyValue{AttrKey.String(c.Key), AttrType.String("string")}
+	case *common.HashCache:
+		return []attribute.KeyValue{AttrKey.String(c.Key), AttrSubKey.String(c.SubKey), AttrType.String("hash")}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/693490554/sponge/rdscache"
+	"github.com/693490554/sponge/rdscache/backend"
+	"github.com/693490554/sponge/rdscache/common"
+	. "github.com/glycerine/goconvey/convey"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpan 记录名称、父span、属性及错误的span
+type recordSpan struct {
+	trace.Span // 不记录的span, 未覆盖的方法直接调用
+	name       string
+	parent     *recordSpan
+	kind       trace.SpanKind
+	attrs      map[attribute.Key]interface{}
+	err        error
+	code       codes.Code
+	ended      bool
+}
+
+func (s *recordSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value.AsInterface()
+	}
+}
+
+func (s *recordSpan) RecordError(err error, _ ...trace.EventOption) { s.err = err }
+
+func (s *recordSpan) SetStatus(code codes.Code, _ string) { s.code = code }
+
+func (s *recordSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+// recorder 记录创建的所有span
+type recorder struct {
+	mu    sync.Mutex
+	spans []*recordSpan
+}
+
+func (r *recorder) Tracer(string, ...trace.TracerOption) trace.Tracer { return r }
+
+func (r *recorder) Start(
+	ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	parent, _ := trace.SpanFromContext(ctx).(*recordSpan)
+	span := &recordSpan{Span: noopSpan, name: name, parent: parent, kind: cfg.SpanKind(),
+		attrs: map[attribute.Key]interface{}{}}
+	span.SetAttributes(cfg.Attributes()...)
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("未开启时不创建span且不修改调用方的span", t, func() {
+		var tracer *Tracer
+		r := &recorder{}
+		parentCtx, parent := r.Start(ctx, "parent")
+		spanCtx, span := tracer.StartCache(parentCtx, "child", common.NewStringCache("k", 0))
+		So(spanCtx, ShouldEqual, parentCtx)
+		So(span.IsRecording(), ShouldBeFalse)
+		tracer.SetAttributes(parentCtx, AttrHitTier.String(TierRds))
+		So(parent.(*recordSpan).attrs, ShouldBeEmpty)
+		So(r.spans, ShouldHaveLength, 1)
+	})
+
+	Convey("以ctx中的span为父span创建span, 记录缓存信息的属性", t, func() {
+		r := &recorder{}
+		tracer := NewTracer(r)
+		parentCtx, parent := r.Start(ctx, "parent")
+		spanCtx, span := tracer.StartCache(parentCtx, "child", common.NewHashCache("k", "sk", 0))
+		tracer.SetAttributes(spanCtx, AttrHitTier.String(TierLocal))
+		End(span, nil)
+
+		child := span.(*recordSpan)
+		So(child.parent, ShouldEqual, parent)
+		So(child.ended, ShouldBeTrue)
+		So(child.kind, ShouldEqual, trace.SpanKindInternal)
+		So(child.attrs[AttrKey], ShouldEqual, "k")
+		So(child.attrs[AttrSubKey], ShouldEqual, "sk")
+		So(child.attrs[AttrType], ShouldEqual, "hash")
+		So(child.attrs[AttrHitTier], ShouldEqual, TierLocal)
+	})
+
+	Convey("数据不存在及缓存不存在不视为错误", t, func() {
+		r := &recorder{}
+		tracer := NewTracer(r)
+		for _, err := range []error{rdscache.ErrNoData, rdscache.ErrCacheNotExist} {
+			_, span := tracer.Start(ctx, "noData")
+			End(span, err)
+			So(span.(*recordSpan).err, ShouldBeNil)
+			So(span.(*recordSpan).code, ShouldEqual, codes.Unset)
+		}
+		fail := errors.New("fail")
+		_, span := tracer.Start(ctx, "fail")
+		End(span, fail)
+		So(span.(*recordSpan).err, ShouldEqual, fail)
+		So(span.(*recordSpan).code, ShouldEqual, codes.Error)
+	})
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("未开启时直接返回原存储后端", t, func() {
+		store := backend.NewMemoryBackend()
+		So(NewBackend(store, nil), ShouldEqual, store)
+	})
+
+	Convey("每次访问存储后端创建span, 管道在Exec时创建span并记录命令数", t, func() {
+		r := &recorder{}
+		store := NewBackend(backend.NewMemoryBackend(), NewTracer(r))
+		parentCtx, parent := r.Start(ctx, "parent")
+
+		_, err := store.Get(parentCtx, "k")
+		So(err, ShouldEqual, rdscache.ErrCacheNotExist)
+		So(store.Set(parentCtx, "k", "v", time.Minute), ShouldBeNil)
+		ret, err := store.MGet(parentCtx, "k", "k2")
+		So(err, ShouldBeNil)
+		So(ret, ShouldResemble, []interface{}{"v", nil})
+
+		p := store.Pipeline(parentCtx)
+		p.Set("k3", "v", time.Minute)
+		p.Del("k")
+		So(p.Exec(), ShouldBeNil)
+
+		So(r.spans, ShouldHaveLength, 5)
+		get, mGet, pipe := r.spans[1], r.spans[3], r.spans[4]
+		So(get.name, ShouldEqual, "sponge.backend.Get")
+		So(get.parent, ShouldEqual, parent)
+		So(get.kind, ShouldEqual, trace.SpanKindClient)
+		So(get.attrs[AttrKey], ShouldEqual, "k")
+		So(get.err, ShouldBeNil)
+		So(get.ended, ShouldBeTrue)
+		So(mGet.attrs[AttrBatchSize], ShouldEqual, int64(2))
+		So(pipe.name, ShouldEqual, "sponge.backend.Pipeline")
+		So(pipe.parent, ShouldEqual, parent)
+		So(pipe.attrs[AttrBatchSize], ShouldEqual, int64(2))
+	})
+}